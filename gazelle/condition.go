@@ -0,0 +1,322 @@
+package python
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+// condition represents a comparison guarding an import statement, e.g.
+// `if sys.version_info >= (3, 11):`.
+type condition struct {
+	// The compared subject, one of "python_version", "python_version_major",
+	// "python_version_minor", "sys_platform", "platform_system" or
+	// "platform_machine".
+	Subject string `json:"subject"`
+	// The comparison operator, e.g. ">=".
+	Op string `json:"op"`
+	// The value the subject is compared to, e.g. "3.11" for python_version,
+	// "2" for python_version_major or "Linux" for platform_system.
+	Value string `json:"value"`
+}
+
+// holds returns whether the condition holds for the given Python version,
+// represented by its major and minor components. Conditions that can't be
+// evaluated, e.g. the platform comparisons, are considered to hold.
+func (c condition) holds(version []int) bool {
+	var subject []int
+	switch c.Subject {
+	case "python_version":
+		subject = version
+	case "python_version_major":
+		subject = version[:1]
+	case "python_version_minor":
+		subject = version[1:]
+	default:
+		return true
+	}
+	value, err := parseVersionComponents(c.Value)
+	if err != nil {
+		return true
+	}
+	// The version components that are not known on both sides, e.g. the micro
+	// version, are ignored.
+	if len(value) < len(subject) {
+		subject = subject[:len(value)]
+	} else {
+		value = value[:len(subject)]
+	}
+	cmp := 0
+	for i := range subject {
+		if subject[i] != value[i] {
+			if subject[i] < value[i] {
+				cmp = -1
+			} else {
+				cmp = 1
+			}
+			break
+		}
+	}
+	switch c.Op {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	default:
+		return true
+	}
+}
+
+// conditionsHold returns whether all the conditions hold for the given Python
+// version, in the `major.minor` form. An empty version holds for any
+// conditions.
+func conditionsHold(pythonVersion string, conditions []condition) bool {
+	if pythonVersion == "" {
+		return true
+	}
+	version, err := parsePythonVersion(pythonVersion)
+	if err != nil {
+		return true
+	}
+	for _, c := range conditions {
+		if !c.holds(version) {
+			return false
+		}
+	}
+	return true
+}
+
+// parsePythonVersion parses a Python version in the `major.minor` form.
+func parsePythonVersion(pythonVersion string) ([]int, error) {
+	version, err := parseVersionComponents(pythonVersion)
+	if err != nil {
+		return nil, err
+	}
+	if len(version) != 2 {
+		return nil, fmt.Errorf("expected a version in the major.minor form, e.g. 3.11")
+	}
+	return version, nil
+}
+
+func parseVersionComponents(value string) ([]int, error) {
+	parts := strings.Split(value, ".")
+	components := make([]int, 0, len(parts))
+	for _, part := range parts {
+		component, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %q: %w", value, err)
+		}
+		components = append(components, component)
+	}
+	return components, nil
+}
+
+// platformOSes maps the values of sys.platform and platform.system() to the
+// operating systems known by Gazelle.
+var platformOSes = map[string]map[string]string{
+	"sys_platform": {
+		"darwin":  "darwin",
+		"freebsd": "freebsd",
+		"linux":   "linux",
+		"win32":   "windows",
+	},
+	"platform_system": {
+		"Darwin":  "darwin",
+		"FreeBSD": "freebsd",
+		"Linux":   "linux",
+		"Windows": "windows",
+	},
+}
+
+// platformArchs maps the values of platform.machine() to the architectures
+// known by Gazelle.
+var platformArchs = map[string]string{
+	"AMD64":   "amd64",
+	"aarch64": "arm64",
+	"amd64":   "amd64",
+	"arm64":   "arm64",
+	"i386":    "386",
+	"i686":    "386",
+	"ppc64le": "ppc64le",
+	"s390x":   "s390x",
+	"x86_64":  "amd64",
+}
+
+// bazelOSes maps the operating systems known by Gazelle to the constraint
+// values of `@platforms//os`.
+var bazelOSes = map[string]string{
+	"darwin":  "osx",
+	"freebsd": "freebsd",
+	"linux":   "linux",
+	"windows": "windows",
+}
+
+// bazelCPUs maps the architectures known by Gazelle to the constraint values of
+// `@platforms//cpu`.
+var bazelCPUs = map[string]string{
+	"386":     "x86_32",
+	"amd64":   "x86_64",
+	"arm64":   "aarch64",
+	"ppc64le": "ppc64le",
+	"s390x":   "s390x",
+}
+
+func init() {
+	// Gazelle tells the selects it can merge apart by the names of their keys,
+	// which must be operating systems or architectures known by Go.
+	for _, os := range bazelOSes {
+		rule.KnownOSSet[os] = true
+	}
+	for _, cpu := range bazelCPUs {
+		rule.KnownArchSet[cpu] = true
+	}
+}
+
+// osConstraint returns the label of the constraint value of the operating
+// system, e.g. `@platforms//os:osx` for darwin.
+func osConstraint(goos string) string {
+	if os, ok := bazelOSes[goos]; ok {
+		return "@platforms//os:" + os
+	}
+	return "@platforms//os:" + goos
+}
+
+// cpuConstraint returns the label of the constraint value of the architecture,
+// e.g. `@platforms//cpu:x86_64` for amd64.
+func cpuConstraint(goarch string) string {
+	if cpu, ok := bazelCPUs[goarch]; ok {
+		return "@platforms//cpu:" + cpu
+	}
+	return "@platforms//cpu:" + goarch
+}
+
+// knownOSes returns the sorted operating systems the platform checks are mapped
+// to.
+func knownOSes() []string {
+	set := make(map[string]bool)
+	for _, goos := range platformOSes["sys_platform"] {
+		set[goos] = true
+	}
+	for _, goos := range platformOSes["platform_system"] {
+		set[goos] = true
+	}
+	return strings.Split(joinSorted(set), ",")
+}
+
+// knownArchs returns the sorted architectures the platform checks are mapped
+// to.
+func knownArchs() []string {
+	set := make(map[string]bool)
+	for _, goarch := range platformArchs {
+		set[goarch] = true
+	}
+	return strings.Split(joinSorted(set), ",")
+}
+
+// platformSelection is the set of platforms an import is needed on, i.e. the
+// platform, as the operating system, the architecture or both, it's restricted
+// to, or the operating systems or the architectures it's excluded from. The
+// excluded ones are sorted and comma-separated so the selection can be a map
+// key. The zero value selects all the platforms.
+type platformSelection struct {
+	rule.Platform
+	ExcludedOS   string
+	ExcludedArch string
+}
+
+// isAll returns whether the selection is all the platforms.
+func (s platformSelection) isAll() bool {
+	return s == platformSelection{}
+}
+
+// excludedOS returns the operating systems excluded by the selection.
+func (s platformSelection) excludedOS() []string {
+	if s.ExcludedOS == "" {
+		return nil
+	}
+	return strings.Split(s.ExcludedOS, ",")
+}
+
+// excludedArch returns the architectures excluded by the selection.
+func (s platformSelection) excludedArch() []string {
+	if s.ExcludedArch == "" {
+		return nil
+	}
+	return strings.Split(s.ExcludedArch, ",")
+}
+
+// platformConstraint returns the platforms the conditions restrict an import
+// to, and false if the import can't happen on any known platform, i.e. the
+// conditions compare the platform for equality with an unknown value or
+// conflict. The inequality comparisons exclude the operating system or the
+// architecture from the platforms, unless the import is already restricted to
+// some. The inequality comparisons with unknown values are ignored, as well as
+// the excluded architectures if any operating system is excluded, so the import
+// may be needed on a superset of the platforms it's actually needed on.
+func platformConstraint(conditions []condition) (platformSelection, bool) {
+	var platform rule.Platform
+	excludedOS := make(map[string]bool)
+	excludedArch := make(map[string]bool)
+	for _, c := range conditions {
+		if c.Op != "==" && c.Op != "!=" {
+			continue
+		}
+		switch c.Subject {
+		case "sys_platform", "platform_system":
+			goos, ok := platformOSes[c.Subject][c.Value]
+			if c.Op == "!=" {
+				if ok {
+					excludedOS[goos] = true
+				}
+				continue
+			}
+			if !ok || (platform.OS != "" && platform.OS != goos) {
+				return platformSelection{}, false
+			}
+			platform.OS = goos
+		case "platform_machine":
+			goarch, ok := platformArchs[c.Value]
+			if c.Op == "!=" {
+				if ok {
+					excludedArch[goarch] = true
+				}
+				continue
+			}
+			if !ok || (platform.Arch != "" && platform.Arch != goarch) {
+				return platformSelection{}, false
+			}
+			platform.Arch = goarch
+		}
+	}
+	if excludedOS[platform.OS] || excludedArch[platform.Arch] {
+		return platformSelection{}, false
+	}
+	if platform.OS != "" || platform.Arch != "" {
+		return platformSelection{Platform: platform}, true
+	}
+	if len(excludedOS) > 0 {
+		return platformSelection{ExcludedOS: joinSorted(excludedOS)}, true
+	}
+	return platformSelection{ExcludedArch: joinSorted(excludedArch)}, true
+}
+
+// joinSorted returns the sorted comma-separated keys of the set.
+func joinSorted(set map[string]bool) string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
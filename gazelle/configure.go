@@ -1,16 +1,23 @@
 package python
 
 import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 
 	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
 	"github.com/bazelbuild/bazel-gazelle/rule"
+	yaml "gopkg.in/yaml.v2"
 
 	"github.com/bazelbuild/rules_python/gazelle/manifest"
 	"github.com/bazelbuild/rules_python/gazelle/pythonconfig"
@@ -24,12 +31,25 @@ type Configurer struct{}
 // method is called once with the root configuration when Gazelle
 // starts. RegisterFlags may set an initial values in Config.Exts. When flags
 // are set, they should modify these values.
-func (py *Configurer) RegisterFlags(fs *flag.FlagSet, cmd string, c *config.Config) {}
+func (py *Configurer) RegisterFlags(fs *flag.FlagSet, cmd string, c *config.Config) {
+	if isDryRun() && fs.Lookup(modeFlag) != nil {
+		// The BUILD files are diffed rather than rewritten by default, the
+		// flags of Gazelle itself being registered first.
+		if err := fs.Set(modeFlag, "diff"); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
 
 // CheckFlags validates the configuration after command line flags are parsed.
 // This is called once with the root configuration when Gazelle starts.
 // CheckFlags may set default values in flags or make implied changes.
 func (py *Configurer) CheckFlags(fs *flag.FlagSet, c *config.Config) error {
+	if isDryRun() {
+		if mode := fs.Lookup(modeFlag); mode != nil && mode.Value.String() == "fix" {
+			return fmt.Errorf("%s=1 can't rewrite the BUILD files with -%s=fix", dryRunEnv, modeFlag)
+		}
+	}
 	return nil
 }
 
@@ -48,6 +68,60 @@ func (py *Configurer) KnownDirectives() []string {
 		pythonconfig.LibraryNamingConvention,
 		pythonconfig.BinaryNamingConvention,
 		pythonconfig.TestNamingConvention,
+		pythonconfig.IndexExportedOnlyDirective,
+		pythonconfig.LazySubmodulesRegistryDirective,
+		pythonconfig.PythonVersionDirective,
+		pythonconfig.TestHelpersDirective,
+		pythonconfig.PublicImportsDirective,
+		pythonconfig.ResolveWithRemoteCacheDirective,
+		pythonconfig.ResolveStarImportsDirective,
+		pythonconfig.LibraryEntrypointFilenameDirective,
+		pythonconfig.ResolveOverridesDirDirective,
+		pythonconfig.DistributionNameOverrideDirective,
+		pythonconfig.InjectedGlobalsDirective,
+		pythonconfig.ThirdPartyPrefixDirective,
+		pythonconfig.VersionPipRepositoryDirective,
+		pythonconfig.ShebangScriptsDirective,
+		pythonconfig.DeprioritizedTagDirective,
+		pythonconfig.FirstPartyNamespacesDirective,
+		pythonconfig.ModuleNameTransformDirective,
+		pythonconfig.ImplicitRelativeImportsDirective,
+		pythonconfig.MaxDepsDirective,
+		pythonconfig.CrossResolveLanguagesDirective,
+		pythonconfig.RequirementLabelsFileDirective,
+		pythonconfig.DepsAttributeDirective,
+		pythonconfig.MovedModulesBaselineDirective,
+		pythonconfig.ConditionalAlternativesDirective,
+		pythonconfig.DynamicImportsMinConfidenceDirective,
+		pythonconfig.LabelConventionDirective,
+		pythonconfig.ResolveRelativeImportsDirective,
+		pythonconfig.BackportDirective,
+		pythonconfig.EnforcePrivateImportsDirective,
+		pythonconfig.StubsRootDirective,
+		pythonconfig.PackageAliasDirective,
+		pythonconfig.TestFixturesDirective,
+		pythonconfig.FrozenModulesDirective,
+		pythonconfig.ResolutionOrderDirective,
+		pythonconfig.MigrationShimDirective,
+		pythonconfig.PipRepositoryForPathDirective,
+		pythonconfig.DeprecatedStdlibAliasDirective,
+		pythonconfig.AllowedThirdPartyDirective,
+		pythonconfig.ResolveManyDirective,
+		pythonconfig.PropagateStarReexportsDirective,
+		pythonconfig.NamespacePackagesDirective,
+		pythonconfig.ModuleDistributionDirective,
+		pythonconfig.GeneratedCodeRootDirective,
+		pythonconfig.OptionalImportsCommentDirective,
+		pythonconfig.LazyImportHelpersDirective,
+		pythonconfig.FirstPartyPrefixDirective,
+		pythonconfig.TargetRequirementsSubsetDirective,
+		pythonconfig.TypeOnlyImportsAsTypeDepsDirective,
+		pythonconfig.ResolveFileDirective,
+		pythonconfig.DefaultVisibilityDirective,
+		pythonconfig.IgnoreDistributionDirective,
+		pythonconfig.ResolvePreferClosestDirective,
+		pythonconfig.GroupDepsDirective,
+		pythonconfig.IndexCythonDirective,
 	}
 }
 
@@ -136,6 +210,513 @@ func (py *Configurer) Configure(c *config.Config, rel string, f *rule.File) {
 			config.SetBinaryNamingConvention(strings.TrimSpace(d.Value))
 		case pythonconfig.TestNamingConvention:
 			config.SetTestNamingConvention(strings.TrimSpace(d.Value))
+		case pythonconfig.IndexExportedOnlyDirective:
+			v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+			if err != nil {
+				log.Fatal(err)
+			}
+			config.SetIndexExportedOnly(v)
+		case pythonconfig.LazySubmodulesRegistryDirective:
+			config.SetLazySubmodulesRegistry(strings.TrimSpace(d.Value))
+		case pythonconfig.PythonVersionDirective:
+			version := strings.TrimSpace(d.Value)
+			if version != "" {
+				if _, err := parsePythonVersion(version); err != nil {
+					err := fmt.Errorf("invalid value for directive %q: %s: %w",
+						pythonconfig.PythonVersionDirective, d.Value, err)
+					log.Fatal(err)
+				}
+			}
+			config.SetPythonVersion(version)
+		case pythonconfig.TestHelpersDirective:
+			var patterns []string
+			for _, pattern := range strings.Split(d.Value, ",") {
+				pattern = strings.TrimSpace(pattern)
+				if pattern == "" {
+					continue
+				}
+				if _, err := filepath.Match(pattern, ""); err != nil {
+					err := fmt.Errorf("invalid value for directive %q: %s: %w",
+						pythonconfig.TestHelpersDirective, d.Value, err)
+					log.Fatal(err)
+				}
+				patterns = append(patterns, pattern)
+			}
+			config.SetTestHelperPatterns(patterns)
+		case pythonconfig.PublicImportsDirective:
+			for _, publicImport := range strings.Split(d.Value, ",") {
+				if strings.TrimSpace(publicImport) == "" {
+					continue
+				}
+				config.AddPublicImport(publicImport)
+			}
+		case pythonconfig.ResolveWithRemoteCacheDirective:
+			v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+			if err != nil {
+				log.Fatal(err)
+			}
+			config.SetResolveWithRemoteCache(v)
+		case pythonconfig.ResolveStarImportsDirective:
+			v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+			if err != nil {
+				log.Fatal(err)
+			}
+			config.SetResolveStarImports(v)
+		case pythonconfig.LibraryEntrypointFilenameDirective:
+			filename := strings.TrimSpace(d.Value)
+			if filename == "" {
+				filename = pyLibraryEntrypointFilename
+			}
+			if filepath.Ext(filename) != ".py" || filepath.Base(filename) != filename {
+				err := fmt.Errorf("invalid value for directive %q: %s: expected a Python filename, e.g. __init__.py",
+					pythonconfig.LibraryEntrypointFilenameDirective, d.Value)
+				log.Fatal(err)
+			}
+			config.SetLibraryEntrypointFilename(filename)
+		case pythonconfig.ResolveOverridesDirDirective:
+			overridesDir := strings.TrimSpace(d.Value)
+			if overridesDir == "" {
+				config.SetResolveOverrides(nil)
+				break
+			}
+			overrides, err := py.loadResolveOverrides(filepath.Join(c.RepoRoot, overridesDir))
+			if err != nil {
+				log.Fatal(err)
+			}
+			config.SetResolveOverrides(overrides)
+		case pythonconfig.DistributionNameOverrideDirective:
+			fields := strings.Fields(d.Value)
+			if len(fields) != 2 {
+				err := fmt.Errorf("invalid value for directive %q: %s: expected a distribution followed by its name, e.g. PyYAML PyYAML",
+					pythonconfig.DistributionNameOverrideDirective, d.Value)
+				log.Fatal(err)
+			}
+			config.AddDistributionNameOverride(fields[0], fields[1])
+		case pythonconfig.InjectedGlobalsDirective:
+			for _, injectedGlobal := range strings.Split(d.Value, ",") {
+				if strings.TrimSpace(injectedGlobal) == "" {
+					continue
+				}
+				parts := strings.SplitN(injectedGlobal, "=", 2)
+				if len(parts) != 2 {
+					err := fmt.Errorf("invalid value for directive %q: %s: expected name=label pairs, e.g. db=//app:db",
+						pythonconfig.InjectedGlobalsDirective, d.Value)
+					log.Fatal(err)
+				}
+				lbl, err := label.Parse(strings.TrimSpace(parts[1]))
+				if err != nil {
+					err := fmt.Errorf("invalid value for directive %q: %s: %w",
+						pythonconfig.InjectedGlobalsDirective, d.Value, err)
+					log.Fatal(err)
+				}
+				config.AddInjectedGlobal(strings.TrimSpace(parts[0]), lbl)
+			}
+		case pythonconfig.ThirdPartyPrefixDirective:
+			for _, prefix := range strings.Split(d.Value, ",") {
+				if strings.TrimSpace(prefix) == "" {
+					continue
+				}
+				config.AddThirdPartyPrefix(prefix)
+			}
+		case pythonconfig.VersionPipRepositoryDirective:
+			fields := strings.Fields(d.Value)
+			if len(fields) != 2 {
+				err := fmt.Errorf("invalid value for directive %q: %s: expected a Python version followed by a pip repository name, e.g. 3.11 pip_311",
+					pythonconfig.VersionPipRepositoryDirective, d.Value)
+				log.Fatal(err)
+			}
+			if _, err := parsePythonVersion(fields[0]); err != nil {
+				err := fmt.Errorf("invalid value for directive %q: %s: %w",
+					pythonconfig.VersionPipRepositoryDirective, d.Value, err)
+				log.Fatal(err)
+			}
+			config.AddVersionPipRepository(fields[0], fields[1])
+		case pythonconfig.ShebangScriptsDirective:
+			v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+			if err != nil {
+				log.Fatal(err)
+			}
+			config.SetShebangScripts(v)
+		case pythonconfig.DeprioritizedTagDirective:
+			config.SetDeprioritizedTag(strings.TrimSpace(d.Value))
+		case pythonconfig.FirstPartyNamespacesDirective:
+			for _, namespace := range strings.Split(d.Value, ",") {
+				if strings.TrimSpace(namespace) == "" {
+					continue
+				}
+				config.AddFirstPartyNamespace(namespace)
+			}
+		case pythonconfig.ModuleNameTransformDirective:
+			fields := strings.Fields(d.Value)
+			if len(fields) != 1 && len(fields) != 2 {
+				err := fmt.Errorf("invalid value for directive %q: %s: expected a regular expression followed by its replacement",
+					pythonconfig.ModuleNameTransformDirective, d.Value)
+				log.Fatal(err)
+			}
+			pattern, err := regexp.Compile(fields[0])
+			if err != nil {
+				err := fmt.Errorf("invalid value for directive %q: %s: %w",
+					pythonconfig.ModuleNameTransformDirective, d.Value, err)
+				log.Fatal(err)
+			}
+			var replacement string
+			if len(fields) == 2 {
+				replacement = fields[1]
+			}
+			config.AddModuleNameTransform(pattern, replacement)
+		case pythonconfig.ImplicitRelativeImportsDirective:
+			v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+			if err != nil {
+				log.Fatal(err)
+			}
+			config.SetImplicitRelativeImports(v)
+		case pythonconfig.MaxDepsDirective:
+			fields := strings.Fields(d.Value)
+			if len(fields) != 1 && len(fields) != 2 {
+				err := fmt.Errorf("invalid value for directive %q: %s: expected a number optionally followed by warn or error",
+					pythonconfig.MaxDepsDirective, d.Value)
+				log.Fatal(err)
+			}
+			maxDeps, err := strconv.Atoi(fields[0])
+			if err != nil || maxDeps < 0 {
+				err := fmt.Errorf("invalid value for directive %q: %s: expected a non-negative number",
+					pythonconfig.MaxDepsDirective, d.Value)
+				log.Fatal(err)
+			}
+			isError := false
+			if len(fields) == 2 {
+				switch fields[1] {
+				case "warn":
+				case "error":
+					isError = true
+				default:
+					err := fmt.Errorf("invalid value for directive %q: %s: expected warn or error, got %q",
+						pythonconfig.MaxDepsDirective, d.Value, fields[1])
+					log.Fatal(err)
+				}
+			}
+			config.SetMaxDeps(maxDeps, isError)
+		case pythonconfig.CrossResolveLanguagesDirective:
+			var langs []string
+			for _, lang := range strings.Split(d.Value, ",") {
+				if lang = strings.TrimSpace(lang); lang != "" && lang != languageName {
+					langs = append(langs, lang)
+				}
+			}
+			config.SetCrossResolveLanguages(langs)
+		case pythonconfig.RequirementLabelsFileDirective:
+			requirementLabelsFile := strings.TrimSpace(d.Value)
+			if requirementLabelsFile == "" {
+				config.SetRequirementLabels(nil)
+				break
+			}
+			requirementLabels, err := py.loadRequirementLabels(filepath.Join(c.RepoRoot, requirementLabelsFile))
+			if err != nil {
+				log.Fatal(err)
+			}
+			config.SetRequirementLabels(requirementLabels)
+		case pythonconfig.DepsAttributeDirective:
+			fields := strings.Fields(d.Value)
+			if len(fields) != 2 {
+				err := fmt.Errorf("invalid value for directive %q: %s: expected a rule kind followed by an attribute, e.g. py_binary runtime_deps",
+					pythonconfig.DepsAttributeDirective, d.Value)
+				log.Fatal(err)
+			}
+			config.AddDepsAttribute(fields[0], fields[1])
+			kind := fields[0]
+			for fromKind, mappedKind := range c.KindMap {
+				if mappedKind.KindName == kind {
+					kind = fromKind
+				}
+			}
+			addResolveAttr(kind, fields[1])
+		case pythonconfig.MovedModulesBaselineDirective:
+			baselineFile := strings.TrimSpace(d.Value)
+			if baselineFile == "" {
+				config.SetMovedModulesBaseline(nil)
+				break
+			}
+			baseline, err := py.loadMovedModulesBaseline(filepath.Join(c.RepoRoot, baselineFile))
+			if err != nil {
+				log.Fatal(err)
+			}
+			config.SetMovedModulesBaseline(baseline)
+		case pythonconfig.ConditionalAlternativesDirective:
+			switch policy := pythonconfig.ConditionalAlternativesType(strings.TrimSpace(d.Value)); policy {
+			case pythonconfig.ConditionalAlternativesAll,
+				pythonconfig.ConditionalAlternativesFirst,
+				pythonconfig.ConditionalAlternativesNone:
+				config.SetConditionalAlternatives(policy)
+			default:
+				err := fmt.Errorf("invalid value for directive %q: %s",
+					pythonconfig.ConditionalAlternativesDirective, d.Value)
+				log.Fatal(err)
+			}
+		case pythonconfig.DynamicImportsMinConfidenceDirective:
+			switch confidence := pythonconfig.DynamicImportsConfidenceType(strings.TrimSpace(d.Value)); confidence {
+			case pythonconfig.DynamicImportsConfidenceNone,
+				pythonconfig.DynamicImportsConfidenceHigh,
+				pythonconfig.DynamicImportsConfidenceMedium:
+				config.SetDynamicImportsMinConfidence(confidence)
+			default:
+				err := fmt.Errorf("invalid value for directive %q: %s",
+					pythonconfig.DynamicImportsMinConfidenceDirective, d.Value)
+				log.Fatal(err)
+			}
+		case pythonconfig.LabelConventionDirective:
+			switch convention := pythonconfig.LabelConventionType(strings.TrimSpace(d.Value)); convention {
+			case pythonconfig.LabelConventionLegacyPypi,
+				pythonconfig.LabelConventionPipHub,
+				pythonconfig.LabelConventionPerPackageHub:
+				config.SetLabelConvention(convention)
+			default:
+				err := fmt.Errorf("invalid value for directive %q: %s",
+					pythonconfig.LabelConventionDirective, d.Value)
+				log.Fatal(err)
+			}
+		case pythonconfig.ResolveRelativeImportsDirective:
+			v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+			if err != nil {
+				log.Fatal(err)
+			}
+			config.SetResolveRelativeImports(v)
+		case pythonconfig.BackportDirective:
+			fields := strings.Fields(d.Value)
+			if len(fields) != 2 {
+				err := fmt.Errorf("invalid value for directive %q: %s: expected a module followed by its distribution, e.g. typing_extensions typing_extensions",
+					pythonconfig.BackportDirective, d.Value)
+				log.Fatal(err)
+			}
+			config.AddBackport(fields[0], fields[1])
+		case pythonconfig.EnforcePrivateImportsDirective:
+			switch enforcement := pythonconfig.EnforcePrivateImportsType(strings.TrimSpace(d.Value)); enforcement {
+			case pythonconfig.EnforcePrivateImportsOff,
+				pythonconfig.EnforcePrivateImportsWarn,
+				pythonconfig.EnforcePrivateImportsError:
+				config.SetEnforcePrivateImports(enforcement)
+			default:
+				err := fmt.Errorf("invalid value for directive %q: %s",
+					pythonconfig.EnforcePrivateImportsDirective, d.Value)
+				log.Fatal(err)
+			}
+		case pythonconfig.StubsRootDirective:
+			stubsRoot := strings.TrimSpace(d.Value)
+			if stubsRoot != "" {
+				stubsRoot = filepath.ToSlash(filepath.Clean(stubsRoot))
+			}
+			config.SetStubsRoot(stubsRoot)
+		case pythonconfig.PackageAliasDirective:
+			fields := strings.Fields(d.Value)
+			if len(fields) != 2 || strings.Contains(fields[0], ".") {
+				err := fmt.Errorf("invalid value for directive %q: %s: expected a top-level import alias followed by a directory, e.g. app services/app/src",
+					pythonconfig.PackageAliasDirective, d.Value)
+				log.Fatal(err)
+			}
+			config.AddPackageAlias(fields[0], filepath.ToSlash(filepath.Clean(fields[1])))
+		case pythonconfig.TestFixturesDirective:
+			v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+			if err != nil {
+				log.Fatal(err)
+			}
+			config.SetTestFixtures(v)
+		case pythonconfig.FrozenModulesDirective:
+			for _, frozenModule := range strings.Split(d.Value, ",") {
+				if strings.TrimSpace(frozenModule) != "" {
+					config.AddFrozenModule(frozenModule)
+				}
+			}
+		case pythonconfig.ResolutionOrderDirective:
+			var order []pythonconfig.ResolutionStrategyType
+			for _, strategy := range strings.Split(d.Value, ",") {
+				order = append(order, pythonconfig.ResolutionStrategyType(strings.TrimSpace(strategy)))
+			}
+			if err := config.SetResolutionOrder(order); err != nil {
+				err := fmt.Errorf("invalid value for directive %q: %s: %w",
+					pythonconfig.ResolutionOrderDirective, d.Value, err)
+				log.Fatal(err)
+			}
+		case pythonconfig.MigrationShimDirective:
+			fields := strings.Fields(d.Value)
+			if len(fields) != 2 {
+				err := fmt.Errorf("invalid value for directive %q: %s: expected a shim package followed by its preferred backing target, e.g. old.api //new/api",
+					pythonconfig.MigrationShimDirective, d.Value)
+				log.Fatal(err)
+			}
+			lbl, err := label.Parse(fields[1])
+			if err != nil {
+				err := fmt.Errorf("invalid value for directive %q: %s: %w",
+					pythonconfig.MigrationShimDirective, d.Value, err)
+				log.Fatal(err)
+			}
+			config.AddMigrationShim(fields[0], lbl)
+		case pythonconfig.PipRepositoryForPathDirective:
+			fields := strings.Fields(d.Value)
+			if len(fields) != 2 {
+				err := fmt.Errorf("invalid value for directive %q: %s: expected a path prefix followed by a pip repository name, e.g. services/py311 pip_311",
+					pythonconfig.PipRepositoryForPathDirective, d.Value)
+				log.Fatal(err)
+			}
+			prefix := strings.Trim(filepath.ToSlash(filepath.Clean(fields[0])), "/")
+			if prefix == "." {
+				prefix = ""
+			}
+			config.AddPipRepositoryForPath(prefix, fields[1])
+		case pythonconfig.DeprecatedStdlibAliasDirective:
+			fields := strings.Fields(d.Value)
+			switch len(fields) {
+			case 1:
+				config.AddDeprecatedStdlibAlias(fields[0], "")
+			case 2:
+				config.AddDeprecatedStdlibAlias(fields[0], fields[1])
+			default:
+				err := fmt.Errorf("invalid value for directive %q: %s: expected a deprecated alias followed by its replacement, e.g. collections.Mapping collections.abc.Mapping",
+					pythonconfig.DeprecatedStdlibAliasDirective, d.Value)
+				log.Fatal(err)
+			}
+		case pythonconfig.AllowedThirdPartyDirective:
+			var modNames []string
+			for _, modName := range strings.Split(d.Value, ",") {
+				if modName = strings.TrimSpace(modName); modName != "" {
+					modNames = append(modNames, modName)
+				}
+			}
+			config.SetAllowedThirdParty(modNames)
+		case pythonconfig.ResolveManyDirective:
+			fields := strings.Fields(d.Value)
+			if len(fields) < 3 || fields[0] != languageName {
+				err := fmt.Errorf("invalid value for directive %q: %s: expected the py language followed by an import and its labels, e.g. py vendored.shim //vendored:shim_stub //vendored:shim",
+					pythonconfig.ResolveManyDirective, d.Value)
+				log.Fatal(err)
+			}
+			labels := make([]label.Label, 0, len(fields)-2)
+			for _, field := range fields[2:] {
+				lbl, err := label.Parse(field)
+				if err != nil {
+					err := fmt.Errorf("invalid value for directive %q: %s: %w",
+						pythonconfig.ResolveManyDirective, d.Value, err)
+					log.Fatal(err)
+				}
+				labels = append(labels, lbl)
+			}
+			config.AddResolveMany(fields[1], labels)
+		case pythonconfig.PropagateStarReexportsDirective:
+			v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+			if err != nil {
+				log.Fatal(err)
+			}
+			config.SetPropagateStarReexports(v)
+		case pythonconfig.NamespacePackagesDirective:
+			v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+			if err != nil {
+				log.Fatal(err)
+			}
+			config.SetNamespacePackages(v)
+		case pythonconfig.ModuleDistributionDirective:
+			fields := strings.Fields(d.Value)
+			if len(fields) != 2 {
+				err := fmt.Errorf("invalid value for directive %q: %s: expected a module followed by its authoritative distribution, e.g. Crypto pycryptodome",
+					pythonconfig.ModuleDistributionDirective, d.Value)
+				log.Fatal(err)
+			}
+			config.AddModuleDistribution(fields[0], fields[1])
+		case pythonconfig.GeneratedCodeRootDirective:
+			generatedCodeRoot := strings.TrimSpace(d.Value)
+			if generatedCodeRoot == "" {
+				err := fmt.Errorf("invalid value for directive %q: expected a directory, e.g. proto/gen",
+					pythonconfig.GeneratedCodeRootDirective)
+				log.Fatal(err)
+			}
+			config.AddGeneratedCodeRoot(filepath.ToSlash(filepath.Clean(generatedCodeRoot)))
+		case pythonconfig.OptionalImportsCommentDirective:
+			v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+			if err != nil {
+				log.Fatal(err)
+			}
+			config.SetOptionalImportsComment(v)
+		case pythonconfig.LazyImportHelpersDirective:
+			for _, helper := range strings.Split(d.Value, ",") {
+				if strings.TrimSpace(helper) == "" {
+					continue
+				}
+				config.AddLazyImportHelper(strings.TrimSpace(helper))
+			}
+		case pythonconfig.FirstPartyPrefixDirective:
+			prefix := strings.TrimSpace(d.Value)
+			if prefix == "" || strings.HasPrefix(prefix, ".") || strings.HasSuffix(prefix, ".") {
+				err := fmt.Errorf("invalid value for directive %q: %q: expected an import prefix, e.g. gen.protos",
+					pythonconfig.FirstPartyPrefixDirective, d.Value)
+				log.Fatal(err)
+			}
+			config.AddFirstPartyPrefix(prefix)
+		case pythonconfig.TargetRequirementsSubsetDirective:
+			fields := strings.Fields(d.Value)
+			if len(fields) != 2 {
+				err := fmt.Errorf("invalid value for directive %q: %s: expected a target name followed by its distributions, e.g. app requests,PyYAML",
+					pythonconfig.TargetRequirementsSubsetDirective, d.Value)
+				log.Fatal(err)
+			}
+			var distributions []string
+			for _, distribution := range strings.Split(fields[1], ",") {
+				if distribution = strings.TrimSpace(distribution); distribution != "" {
+					distributions = append(distributions, distribution)
+				}
+			}
+			config.SetRequirementsSubset(fields[0], distributions)
+		case pythonconfig.TypeOnlyImportsAsTypeDepsDirective:
+			v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+			if err != nil {
+				log.Fatal(err)
+			}
+			config.SetTypeOnlyImportsAsTypeDeps(v)
+		case pythonconfig.ResolveFileDirective:
+			resolveFile := strings.TrimSpace(d.Value)
+			if resolveFile == "" {
+				config.SetResolveFileOverrides(nil)
+				break
+			}
+			overrides, err := py.loadResolveFile(filepath.Join(c.RepoRoot, resolveFile))
+			if err != nil {
+				log.Fatal(err)
+			}
+			config.SetResolveFileOverrides(overrides)
+		case pythonconfig.DefaultVisibilityDirective:
+			fields := strings.Fields(d.Value)
+			if len(fields) == 0 {
+				config.SetDefaultVisibility(nil)
+				break
+			}
+			for _, field := range fields {
+				if _, err := label.Parse(field); err != nil {
+					err := fmt.Errorf("invalid value for directive %q: %s: %w",
+						pythonconfig.DefaultVisibilityDirective, d.Value, err)
+					log.Fatal(err)
+				}
+			}
+			config.SetDefaultVisibility(fields)
+		case pythonconfig.IgnoreDistributionDirective:
+			for _, distribution := range strings.Split(d.Value, ",") {
+				if strings.TrimSpace(distribution) != "" {
+					config.AddIgnoredDistribution(distribution)
+				}
+			}
+		case pythonconfig.ResolvePreferClosestDirective:
+			v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+			if err != nil {
+				log.Fatal(err)
+			}
+			config.SetResolvePreferClosest(v)
+		case pythonconfig.GroupDepsDirective:
+			v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+			if err != nil {
+				log.Fatal(err)
+			}
+			config.SetGroupDeps(v)
+		case pythonconfig.IndexCythonDirective:
+			v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+			if err != nil {
+				log.Fatal(err)
+			}
+			config.SetIndexCython(v)
 		}
 	}
 
@@ -160,5 +741,150 @@ func (py *Configurer) loadGazelleManifest(gazelleManifestPath string) (*manifest
 	if err := manifestFile.Decode(gazelleManifestPath); err != nil {
 		return nil, fmt.Errorf("failed to load Gazelle manifest at %q: %w", gazelleManifestPath, err)
 	}
+	for goos := range manifestFile.Manifest.PlatformPipRepositories {
+		if !rule.KnownOSSet[goos] {
+			return nil, fmt.Errorf("failed to load Gazelle manifest at %q: unknown operating system %q in platform_pip_repositories",
+				gazelleManifestPath, goos)
+		}
+	}
 	return manifestFile.Manifest, nil
 }
+
+// resolveOverridesFile represents a YAML file mapping imports to the labels
+// overriding their resolution.
+type resolveOverridesFile struct {
+	Resolve map[string]string `yaml:"resolve"`
+}
+
+// loadResolveOverrides loads all the *.yaml files under the given directory.
+// The files are merged in the lexical order of their paths, so that the
+// entries of later files take precedence over the ones of earlier files.
+func (py *Configurer) loadResolveOverrides(overridesDir string) (map[string]label.Label, error) {
+	overrides := make(map[string]label.Label)
+	err := filepath.Walk(overridesDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != ".yaml" {
+			return nil
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var overridesFile resolveOverridesFile
+		if err := yaml.UnmarshalStrict(data, &overridesFile); err != nil {
+			return fmt.Errorf("%q: %w", path, err)
+		}
+		for imp, value := range overridesFile.Resolve {
+			lbl, err := label.Parse(value)
+			if err != nil {
+				return fmt.Errorf("%q: invalid label for %q: %w", path, imp, err)
+			}
+			overrides[imp] = lbl
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load resolve overrides at %q: %w", overridesDir, err)
+	}
+	return overrides, nil
+}
+
+// loadResolveFile loads the given file mapping imports to labels, either a JSON
+// object or a CSV file of `import,label` records depending on its extension.
+func (py *Configurer) loadResolveFile(resolveFilePath string) (map[string]label.Label, error) {
+	data, err := ioutil.ReadFile(resolveFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load resolve file at %q: %w", resolveFilePath, err)
+	}
+	values := make(map[string]string)
+	switch filepath.Ext(resolveFilePath) {
+	case ".json":
+		if err := json.Unmarshal(data, &values); err != nil {
+			return nil, fmt.Errorf("failed to load resolve file at %q: %w", resolveFilePath, err)
+		}
+	case ".csv":
+		reader := csv.NewReader(bytes.NewReader(data))
+		reader.FieldsPerRecord = 2
+		reader.TrimLeadingSpace = true
+		reader.Comment = '#'
+		records, err := reader.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load resolve file at %q: %w", resolveFilePath, err)
+		}
+		for _, record := range records {
+			values[record[0]] = record[1]
+		}
+	default:
+		return nil, fmt.Errorf("failed to load resolve file at %q: expected a .json or .csv file", resolveFilePath)
+	}
+	overrides := make(map[string]label.Label, len(values))
+	for imp, value := range values {
+		if strings.Contains(strings.TrimSuffix(imp, ".*"), "*") {
+			return nil, fmt.Errorf("failed to load resolve file at %q: invalid import %q: "+
+				"only a trailing `.*` is supported", resolveFilePath, imp)
+		}
+		lbl, err := label.Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load resolve file at %q: invalid label for %q: %w",
+				resolveFilePath, imp, err)
+		}
+		overrides[imp] = lbl
+	}
+	return overrides, nil
+}
+
+// requirementLabelsFile represents a YAML file mapping requirements to the
+// labels of the targets providing them.
+type requirementLabelsFile struct {
+	Labels map[string]string `yaml:"labels"`
+}
+
+// loadRequirementLabels loads the given YAML file mapping requirements to
+// labels. The requirement names are sanitized in the same way as the
+// distribution names of the Gazelle manifest.
+func (py *Configurer) loadRequirementLabels(requirementLabelsPath string) (map[string]label.Label, error) {
+	data, err := ioutil.ReadFile(requirementLabelsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load requirement labels at %q: %w", requirementLabelsPath, err)
+	}
+	var labelsFile requirementLabelsFile
+	if err := yaml.UnmarshalStrict(data, &labelsFile); err != nil {
+		return nil, fmt.Errorf("failed to load requirement labels at %q: %w", requirementLabelsPath, err)
+	}
+	requirementLabels := make(map[string]label.Label, len(labelsFile.Labels))
+	for requirement, value := range labelsFile.Labels {
+		lbl, err := label.Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load requirement labels at %q: invalid label for %q: %w",
+				requirementLabelsPath, requirement, err)
+		}
+		requirementLabels[manifest.SanitizeDistributionName(requirement)] = lbl
+	}
+	return requirementLabels, nil
+}
+
+// movedModulesBaselineFile represents a YAML file mapping the module names to
+// the SHA-256 hashes of their contents recorded at a baseline.
+type movedModulesBaselineFile struct {
+	Modules map[string]string `yaml:"modules"`
+}
+
+// loadMovedModulesBaseline loads the given YAML file recording the hashes of
+// the contents of the modules.
+func (py *Configurer) loadMovedModulesBaseline(baselinePath string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(baselinePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load moved modules baseline at %q: %w", baselinePath, err)
+	}
+	var baselineFile movedModulesBaselineFile
+	if err := yaml.UnmarshalStrict(data, &baselineFile); err != nil {
+		return nil, fmt.Errorf("failed to load moved modules baseline at %q: %w", baselinePath, err)
+	}
+	baseline := make(map[string]string, len(baselineFile.Modules))
+	for modName, contentHash := range baselineFile.Modules {
+		baseline[modName] = strings.ToLower(contentHash)
+	}
+	return baseline, nil
+}
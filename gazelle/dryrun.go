@@ -0,0 +1,130 @@
+package python
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+	"github.com/emirpasic/gods/sets/treeset"
+	godsutils "github.com/emirpasic/gods/utils"
+)
+
+// dryRunEnv is the environment variable that, set to "1", makes Gazelle diff
+// the BUILD files instead of rewriting them, and the resolution report the
+// changes of the deps of the targets, e.g. to preview them in CI.
+const dryRunEnv = "GAZELLE_PYTHON_DRY_RUN"
+
+// modeFlag is the flag of Gazelle selecting what it does with the updated
+// BUILD files, i.e. "fix", "print" or "diff".
+const modeFlag = "mode"
+
+// Actions of the reported changes of the deps.
+const (
+	addDepAction    = "add"
+	removeDepAction = "remove"
+)
+
+// isDryRun returns whether the BUILD files are left as they are.
+func isDryRun() bool {
+	return os.Getenv(dryRunEnv) == "1"
+}
+
+// reportDepsChanges logs the dependencies the resolution adds to and removes
+// from the deps of the existing rule with the given label, one per line. The
+// deps, or any of them, marked with a "# keep" comment aren't changed by
+// Gazelle, so they're not reported.
+func (py *Resolver) reportDepsChanges(
+	r *rule.Rule,
+	from label.Label,
+	depsAttr string,
+	deps *treeset.Set,
+	platformDeps map[platformSelection]*treeset.Set,
+) {
+	generated := treeset.NewWith(godsutils.StringComparator, deps.Values()...)
+	for _, depsOnPlatform := range platformDeps {
+		generated.Add(depsOnPlatform.Values()...)
+	}
+	var existing bzl.Expr
+	if f, ok := py.buildFiles[from.Pkg]; ok {
+		for _, fr := range f.Rules {
+			if fr.Name() != from.Name || fr == r {
+				continue
+			}
+			if fr.ShouldKeep() || attrKept(f, from.Name, depsAttr) {
+				return
+			}
+			existing = fr.Attr(depsAttr)
+			break
+		}
+	}
+	existingDeps, keptDeps := exprStrings(existing)
+	for _, line := range depsChanges(from, depsAttr, existingDeps, keptDeps, generated) {
+		log.Println(line)
+	}
+}
+
+// depsChanges returns the lines reporting the dependencies added to and removed
+// from the existing deps of the target, e.g.
+// `DRY-RUN: add //app deps @pip//pypi__requests`. The kept dependencies are
+// never removed.
+func depsChanges(from label.Label, depsAttr string, existing, kept []string, generated *treeset.Set) []string {
+	existingSet := treeset.NewWith(godsutils.StringComparator)
+	for _, dep := range existing {
+		existingSet.Add(dep)
+	}
+	keptSet := treeset.NewWith(godsutils.StringComparator)
+	for _, dep := range kept {
+		keptSet.Add(dep)
+	}
+	var lines []string
+	it := existingSet.Iterator()
+	for it.Next() {
+		if !generated.Contains(it.Value()) && !keptSet.Contains(it.Value()) {
+			lines = append(lines, fmt.Sprintf("DRY-RUN: %s %s %s %s", removeDepAction, from.String(), depsAttr, it.Value()))
+		}
+	}
+	it = generated.Iterator()
+	for it.Next() {
+		if !existingSet.Contains(it.Value()) {
+			lines = append(lines, fmt.Sprintf("DRY-RUN: %s %s %s %s", addDepAction, from.String(), depsAttr, it.Value()))
+		}
+	}
+	return lines
+}
+
+// exprStrings returns the strings of the given expression of dependencies,
+// i.e. a list possibly concatenated with selects, along with the ones marked
+// with a "# keep" comment.
+func exprStrings(expr bzl.Expr) (strs, kept []string) {
+	switch expr := expr.(type) {
+	case *bzl.StringExpr:
+		strs = append(strs, expr.Value)
+		if rule.ShouldKeep(expr) {
+			kept = append(kept, expr.Value)
+		}
+	case *bzl.ListExpr:
+		for _, elem := range expr.List {
+			elemStrs, elemKept := exprStrings(elem)
+			strs, kept = append(strs, elemStrs...), append(kept, elemKept...)
+		}
+	case *bzl.BinaryExpr:
+		if expr.Op == "+" {
+			xStrs, xKept := exprStrings(expr.X)
+			yStrs, yKept := exprStrings(expr.Y)
+			strs, kept = append(xStrs, yStrs...), append(xKept, yKept...)
+		}
+	case *bzl.CallExpr:
+		if fn, ok := expr.X.(*bzl.Ident); ok && fn.Name == "select" && len(expr.List) == 1 {
+			if dict, ok := expr.List[0].(*bzl.DictExpr); ok {
+				for _, kv := range dict.List {
+					valueStrs, valueKept := exprStrings(kv.Value)
+					strs, kept = append(strs, valueStrs...), append(kept, valueKept...)
+				}
+			}
+		}
+	}
+	return strs, kept
+}
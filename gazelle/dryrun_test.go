@@ -0,0 +1,40 @@
+package python
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	bzl "github.com/bazelbuild/buildtools/build"
+	"github.com/emirpasic/gods/sets/treeset"
+	godsutils "github.com/emirpasic/gods/utils"
+)
+
+func TestDepsChanges(t *testing.T) {
+	f, err := bzl.ParseBuild("BUILD", []byte(`py_library(
+    name = "app",
+    deps = [
+        "//lib",
+        "//legacy",
+        "//vendored",  # keep
+    ] + select({
+        "@platforms//os:linux": ["@pip//pypi__uvloop"],
+        "//conditions:default": [],
+    }),
+)
+`))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	call := f.Stmt[0].(*bzl.CallExpr)
+	existing, kept := exprStrings(call.List[1].(*bzl.AssignExpr).RHS)
+	generated := treeset.NewWith(godsutils.StringComparator, "//lib", "@pip//pypi__requests", "@pip//pypi__uvloop")
+	got := depsChanges(label.New("", "app", "app"), "deps", existing, kept, generated)
+	want := []string{
+		"DRY-RUN: remove //app deps //legacy",
+		"DRY-RUN: add //app deps @pip//pypi__requests",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected changes %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,95 @@
+package python
+
+import (
+	"log"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+)
+
+// resolutionErrors collects the fatal resolution errors of all the targets, so
+// that they're reported together, grouped by target, rather than exiting on
+// the first target with errors. Gazelle has no hook running once all the
+// targets are resolved, so the labels of the generated targets are recorded,
+// and the errors are flushed once the last of them is resolved. The
+// resolution of the targets that weren't generated, e.g. in unit tests, isn't
+// counted.
+type resolutionErrors struct {
+	mu      sync.Mutex
+	pending map[label.Label]bool
+	errs    map[string][]error
+	// exit ends the run once the errors are flushed, i.e. os.Exit.
+	exit func(code int)
+}
+
+// newResolutionErrors returns a collector ending the run with the given exit
+// function.
+func newResolutionErrors(exit func(code int)) *resolutionErrors {
+	return &resolutionErrors{
+		pending: make(map[label.Label]bool),
+		errs:    make(map[string][]error),
+		exit:    exit,
+	}
+}
+
+// fatalErrors is the collector of the fatal resolution errors of the run.
+var fatalErrors = newResolutionErrors(os.Exit)
+
+// expect adds the generated target with the given label to resolve.
+func (e *resolutionErrors) expect(lbl label.Label) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.pending[lbl] = true
+}
+
+// add records a fatal error resolving the given target.
+func (e *resolutionErrors) add(from label.Label, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.errs[from.String()] = append(e.errs[from.String()], err)
+}
+
+// resolved marks the target with the given label as resolved. Once all the
+// expected targets are resolved, the collected errors are flushed and, if any,
+// the run exits with a non-zero code. The targets that weren't expected, or
+// are already resolved, are ignored.
+func (e *resolutionErrors) resolved(from label.Label) {
+	e.mu.Lock()
+	if !e.pending[from] {
+		e.mu.Unlock()
+		return
+	}
+	delete(e.pending, from)
+	done := len(e.pending) == 0
+	e.mu.Unlock()
+	if done && e.flush() > 0 {
+		e.exit(1)
+	}
+}
+
+// flush logs the collected errors, grouped by target, and forgets them. It
+// returns the number of flushed errors.
+func (e *resolutionErrors) flush() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.errs) == 0 {
+		return 0
+	}
+	targets := make([]string, 0, len(e.errs))
+	count := 0
+	for target, errs := range e.errs {
+		targets = append(targets, target)
+		count += len(errs)
+	}
+	sort.Strings(targets)
+	for _, target := range targets {
+		for _, err := range e.errs[target] {
+			log.Println("ERROR: ", err)
+		}
+	}
+	log.Printf("ERROR: the resolution failed with %d error(s) in %d target(s)\n", count, len(targets))
+	e.errs = make(map[string][]error)
+	return count
+}
@@ -0,0 +1,71 @@
+package python
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+)
+
+func TestResolutionErrors(t *testing.T) {
+	var logs bytes.Buffer
+	output := log.Writer()
+	log.SetOutput(&logs)
+	defer log.SetOutput(output)
+	flags := log.Flags()
+	log.SetFlags(0)
+	defer log.SetFlags(flags)
+
+	var exitCodes []int
+	e := newResolutionErrors(func(code int) { exitCodes = append(exitCodes, code) })
+	app, lib := label.New("", "app", "app"), label.New("", "lib", "lib")
+	e.expect(app)
+	e.expect(lib)
+
+	e.add(lib, errors.New(`"yaml" doesn't resolve`))
+	e.resolved(lib)
+	// Neither the targets that weren't expected, nor the ones already
+	// resolved, are counted.
+	e.resolved(label.New("", "other", "other"))
+	e.resolved(lib)
+	if len(exitCodes) != 0 || logs.Len() != 0 {
+		t.Fatalf("expected no exit before the last target is resolved, got exit codes %v and logs:\n%s", exitCodes, logs.String())
+	}
+
+	e.add(app, errors.New(`"requests" doesn't resolve`))
+	e.resolved(app)
+	if len(exitCodes) != 1 || exitCodes[0] != 1 {
+		t.Fatalf("expected a single exit with code 1, got exit codes %v", exitCodes)
+	}
+	want := strings.Join([]string{
+		`ERROR:  "requests" doesn't resolve`,
+		`ERROR:  "yaml" doesn't resolve`,
+		`ERROR: the resolution failed with 2 error(s) in 2 target(s)`,
+		``,
+	}, "\n")
+	if got := logs.String(); got != want {
+		t.Errorf("expected logs:\n%s\ngot:\n%s", want, got)
+	}
+
+	if n := e.flush(); n != 0 {
+		t.Errorf("expected the flushed errors to be forgotten, got %d errors", n)
+	}
+	e.resolved(app)
+	if len(exitCodes) != 1 {
+		t.Errorf("expected no exit once all the targets are resolved, got exit codes %v", exitCodes)
+	}
+}
+
+func TestResolutionErrorsWithoutErrors(t *testing.T) {
+	exited := false
+	e := newResolutionErrors(func(int) { exited = true })
+	app := label.New("", "app", "app")
+	e.expect(app)
+	e.resolved(app)
+	if exited {
+		t.Errorf("expected no exit without errors")
+	}
+}
@@ -1,15 +1,19 @@
 package python
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/bazelbuild/bazel-gazelle/config"
 	"github.com/bazelbuild/bazel-gazelle/label"
 	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/merger"
 	"github.com/bazelbuild/bazel-gazelle/rule"
 	"github.com/bmatcuk/doublestar"
 	"github.com/emirpasic/gods/lists/singlylinkedlist"
@@ -53,7 +57,7 @@ func (py *Python) GenerateRules(args language.GenerateArgs) language.GenerateRes
 			if parent != nil && parent.CoarseGrainedGeneration() {
 				return language.GenerateResult{}
 			}
-		} else if !hasEntrypointFile(args.Dir) {
+		} else if !hasEntrypointFile(args.Dir, cfg.LibraryEntrypointFilename()) {
 			return language.GenerateResult{}
 		}
 	}
@@ -64,6 +68,12 @@ func (py *Python) GenerateRules(args language.GenerateArgs) language.GenerateRes
 
 	pyLibraryFilenames := treeset.NewWith(godsutils.StringComparator)
 	pyTestFilenames := treeset.NewWith(godsutils.StringComparator)
+	// pyTestHelperFilenames are the test helpers embedded into the py_test
+	// target, if any is generated.
+	pyTestHelperFilenames := treeset.NewWith(godsutils.StringComparator)
+	// pyScriptFilenames are the extensionless executable scripts with a Python
+	// shebang, each generating a py_binary target.
+	pyScriptFilenames := treeset.NewWith(godsutils.StringComparator)
 
 	// hasPyBinary controls whether a py_binary target should be generated for
 	// this package or not.
@@ -85,8 +95,12 @@ func (py *Python) GenerateRules(args language.GenerateArgs) language.GenerateRes
 			hasPyTestFile = true
 		} else if strings.HasSuffix(f, "_test.py") || (strings.HasPrefix(f, "test_") && ext == ".py") {
 			pyTestFilenames.Add(f)
-		} else if ext == ".py" {
+		} else if ext == ".py" && cfg.IsTestHelper(f) {
+			pyTestHelperFilenames.Add(f)
+		} else if ext == ".py" || cfg.IsStubFile(filepath.Join(args.Rel, f)) {
 			pyLibraryFilenames.Add(f)
+		} else if ext == "" && cfg.ShebangScripts() && hasPythonShebang(filepath.Join(args.Dir, f)) {
+			pyScriptFilenames.Add(f)
 		}
 	}
 
@@ -134,14 +148,14 @@ func (py *Python) GenerateRules(args language.GenerateArgs) language.GenerateRes
 						return nil
 					}
 
-					if !cfg.CoarseGrainedGeneration() && hasEntrypointFile(path) {
+					if !cfg.CoarseGrainedGeneration() && hasEntrypointFile(path, cfg.LibraryEntrypointFilename()) {
 						return errHaltDigging
 					}
 
 					return nil
 				}
 				if filepath.Ext(path) == ".py" {
-					if cfg.CoarseGrainedGeneration() || !isEntrypointFile(path) {
+					if cfg.CoarseGrainedGeneration() || !isEntrypointFile(path, cfg.LibraryEntrypointFilename()) {
 						f, _ := filepath.Rel(args.Dir, path)
 						excludedPatterns := cfg.ExcludedPatterns()
 						if excludedPatterns != nil {
@@ -160,10 +174,14 @@ func (py *Python) GenerateRules(args language.GenerateArgs) language.GenerateRes
 						baseName := filepath.Base(path)
 						if strings.HasSuffix(baseName, "_test.py") || strings.HasPrefix(baseName, "test_") {
 							pyTestFilenames.Add(f)
+						} else if cfg.IsTestHelper(baseName) {
+							pyTestHelperFilenames.Add(f)
 						} else {
 							pyLibraryFilenames.Add(f)
 						}
 					}
+				} else if f, _ := filepath.Rel(args.Dir, path); cfg.IsStubFile(filepath.Join(args.Rel, f)) {
+					pyLibraryFilenames.Add(f)
 				}
 				return nil
 			},
@@ -174,8 +192,11 @@ func (py *Python) GenerateRules(args language.GenerateArgs) language.GenerateRes
 		}
 	}
 
-	parser := newPython3Parser(args.Config.RepoRoot, args.Rel, cfg.IgnoresDependency)
-	visibility := fmt.Sprintf("//%s:__subpackages__", pythonProjectRoot)
+	parser := newPython3Parser(args.Config.RepoRoot, args.Rel, cfg.IgnoresDependency, cfg.LazySubmodulesRegistry(), cfg.InjectedGlobals(), cfg.LazyImportHelpers())
+	visibility := []string{fmt.Sprintf("//%s:__subpackages__", pythonProjectRoot)}
+	if defaultVisibility, ok := cfg.DefaultVisibility(); ok {
+		visibility = defaultVisibility
+	}
 
 	var result language.GenerateResult
 	result.Gen = make([]*rule.Rule, 0)
@@ -187,11 +208,23 @@ func (py *Python) GenerateRules(args language.GenerateArgs) language.GenerateRes
 		for it.Next() {
 			pyLibraryFilenames.Add(it.Value())
 		}
+		// Without a py_test target to embed them, the test helpers remain
+		// regular library sources.
+		it = pyTestHelperFilenames.Iterator()
+		for it.Next() {
+			pyLibraryFilenames.Add(it.Value())
+		}
+		pyTestHelperFilenames.Clear()
+	} else {
+		it := pyTestHelperFilenames.Iterator()
+		for it.Next() {
+			pyTestFilenames.Add(it.Value())
+		}
 	}
 
 	var pyLibrary *rule.Rule
 	if !pyLibraryFilenames.Empty() {
-		deps, err := parser.parse(pyLibraryFilenames)
+		res, err := parser.parse(pyLibraryFilenames)
 		if err != nil {
 			log.Fatalf("ERROR: %v\n", err)
 		}
@@ -215,20 +248,39 @@ func (py *Python) GenerateRules(args language.GenerateArgs) language.GenerateRes
 			}
 		}
 
-		pyLibrary = newTargetBuilder(pyLibraryKind, pyLibraryTargetName, pythonProjectRoot, args.Rel).
+		pyLibraryTarget := newTargetBuilder(pyLibraryKind, pyLibraryTargetName, pythonProjectRoot, args.Rel).
 			setUUID(uuid.Must(uuid.NewUUID()).String()).
-			addVisibility(visibility).
+			addVisibilities(visibility).
 			addSrcs(pyLibraryFilenames).
-			addModuleDependencies(deps).
-			generateImportsAttribute().
-			build()
+			addModuleDependencies(res.modules).
+			addResourceDependencies(res.resources).
+			addInjectedGlobalDependencies(res.injectedGlobals, cfg.FindInjectedGlobal).
+			addFileRoots(res.fileRoots).
+			addPkgutilNamespacePackages(res.pkgutilNamespacePackages).
+			addReexportedNames(res.reexportedNames).
+			generateImportsAttribute()
+
+		if cfg.ResolveStarImports() {
+			// An __init__.py importing all the submodules of its package in a
+			// loop is resolved as a star import of the package.
+			for filename, lineNumber := range res.autoImportAllPackages {
+				pyLibraryTarget.addModuleDependency(module{
+					Name:       importSpecFromSrc(cfg, pythonProjectRoot, args.Rel, filename).Imp,
+					LineNumber: lineNumber,
+					Filepath:   filepath.Join(args.Rel, filename),
+					StarImport: true,
+				})
+			}
+		}
+
+		pyLibrary = pyLibraryTarget.build()
 
 		result.Gen = append(result.Gen, pyLibrary)
 		result.Imports = append(result.Imports, pyLibrary.PrivateAttr(config.GazelleImportsKey))
 	}
 
 	if hasPyBinary {
-		deps, err := parser.parseSingle(pyBinaryEntrypointFilename)
+		res, err := parser.parseSingle(pyBinaryEntrypointFilename)
 		if err != nil {
 			log.Fatalf("ERROR: %v\n", err)
 		}
@@ -254,9 +306,12 @@ func (py *Python) GenerateRules(args language.GenerateArgs) language.GenerateRes
 
 		pyBinaryTarget := newTargetBuilder(pyBinaryKind, pyBinaryTargetName, pythonProjectRoot, args.Rel).
 			setMain(pyBinaryEntrypointFilename).
-			addVisibility(visibility).
+			addVisibilities(visibility).
 			addSrc(pyBinaryEntrypointFilename).
-			addModuleDependencies(deps).
+			addModuleDependencies(res.modules).
+			addResourceDependencies(res.resources).
+			addInjectedGlobalDependencies(res.injectedGlobals, cfg.FindInjectedGlobal).
+			addFileRoots(res.fileRoots).
 			generateImportsAttribute()
 
 		if pyLibrary != nil {
@@ -269,13 +324,60 @@ func (py *Python) GenerateRules(args language.GenerateArgs) language.GenerateRes
 		result.Imports = append(result.Imports, pyBinary.PrivateAttr(config.GazelleImportsKey))
 	}
 
+	scriptsIt := pyScriptFilenames.Iterator()
+	for scriptsIt.Next() {
+		pyScriptFilename := scriptsIt.Value().(string)
+		res, err := parser.parseSingle(pyScriptFilename)
+		if err != nil {
+			log.Fatalf("ERROR: %v\n", err)
+		}
+
+		// Check if a target with the same name we are generating alredy exists,
+		// and if it is of a different kind from the one we are generating. If
+		// so, we have to throw an error since Gazelle won't generate it
+		// correctly.
+		if args.File != nil {
+			for _, t := range args.File.Rules {
+				if t.Name() == pyScriptFilename && t.Kind() != pyBinaryKind {
+					fqTarget := label.New("", args.Rel, pyScriptFilename)
+					err := fmt.Errorf("failed to generate target %q of kind %q: "+
+						"a target of kind %q with the same name already exists. "+
+						"Use the '# gazelle:%s' directive to ignore the script.",
+						fqTarget.String(), pyBinaryKind, t.Kind(), pythonconfig.IgnoreFilesDirective)
+					collisionErrors.Add(err)
+				}
+			}
+		}
+
+		// The scripts aren't importable, so they are never indexed, but their
+		// imports are resolved as for any other py_binary.
+		pyScriptTarget := newTargetBuilder(pyBinaryKind, pyScriptFilename, pythonProjectRoot, args.Rel).
+			setMain(pyScriptFilename).
+			addVisibilities(visibility).
+			addSrc(pyScriptFilename).
+			addModuleDependencies(res.modules).
+			addResourceDependencies(res.resources).
+			addInjectedGlobalDependencies(res.injectedGlobals, cfg.FindInjectedGlobal).
+			addFileRoots(res.fileRoots).
+			generateImportsAttribute()
+
+		if pyLibrary != nil {
+			pyScriptTarget.addModuleDependency(module{Name: pyLibrary.PrivateAttr(uuidKey).(string)})
+		}
+
+		pyScript := pyScriptTarget.build()
+
+		result.Gen = append(result.Gen, pyScript)
+		result.Imports = append(result.Imports, pyScript.PrivateAttr(config.GazelleImportsKey))
+	}
+
 	if hasPyTestFile || hasPyTestTarget {
 		if hasPyTestFile {
 			// Only add the pyTestEntrypointFilename to the pyTestFilenames if
 			// the file exists on disk.
 			pyTestFilenames.Add(pyTestEntrypointFilename)
 		}
-		deps, err := parser.parse(pyTestFilenames)
+		res, err := parser.parse(pyTestFilenames)
 		if err != nil {
 			log.Fatalf("ERROR: %v\n", err)
 		}
@@ -301,7 +403,11 @@ func (py *Python) GenerateRules(args language.GenerateArgs) language.GenerateRes
 
 		pyTestTarget := newTargetBuilder(pyTestKind, pyTestTargetName, pythonProjectRoot, args.Rel).
 			addSrcs(pyTestFilenames).
-			addModuleDependencies(deps).
+			addTestHelpers(pyTestHelperFilenames).
+			addModuleDependencies(res.modules).
+			addResourceDependencies(res.resources).
+			addInjectedGlobalDependencies(res.injectedGlobals, cfg.FindInjectedGlobal).
+			addFileRoots(res.fileRoots).
 			generateImportsAttribute()
 
 		if hasPyTestTarget {
@@ -325,6 +431,13 @@ func (py *Python) GenerateRules(args language.GenerateArgs) language.GenerateRes
 		result.Imports = append(result.Imports, pyTest.PrivateAttr(config.GazelleImportsKey))
 	}
 
+	for _, platform := range guardedPlatforms(cfg, result.Imports) {
+		configSetting := rule.NewRule(configSettingKind, platform.String())
+		configSetting.SetAttr("constraint_values", []string{osConstraint(platform.OS), cpuConstraint(platform.Arch)})
+		result.Gen = append(result.Gen, configSetting)
+		result.Imports = append(result.Imports, nil)
+	}
+
 	if !collisionErrors.Empty() {
 		it := collisionErrors.Iterator()
 		for it.Next() {
@@ -333,9 +446,118 @@ func (py *Python) GenerateRules(args language.GenerateArgs) language.GenerateRes
 		os.Exit(1)
 	}
 
+	for _, r := range result.Gen {
+		fatalErrors.expect(label.New(args.Config.RepoName, args.Rel, r.Name()))
+	}
+
+	if py.generatedModules == nil {
+		py.generatedModules = make(map[label.Label]*treeset.Set)
+	}
+	for i, r := range result.Gen {
+		if modules, ok := result.Imports[i].(*treeset.Set); ok {
+			py.generatedModules[label.New("", args.Rel, r.Name())] = modules
+		}
+	}
+	if pyLibrary != nil {
+		py.recordEmbeddedLibrary(args, pyLibrary, result)
+	}
+	if args.File != nil {
+		if py.buildFiles == nil {
+			py.buildFiles = make(map[string]*rule.File)
+		}
+		py.buildFiles[args.Rel] = args.File
+	}
+
 	return result
 }
 
+// recordEmbeddedLibrary records the generated py_library of the given package
+// along with the other generated rules importing it through its uuid, which
+// embed it. They're recorded with the labels of the existing rules they're
+// merged into, which are the ones indexed.
+func (py *Resolver) recordEmbeddedLibrary(args language.GenerateArgs, pyLibrary *rule.Rule, result language.GenerateResult) {
+	libraryUUID := pyLibrary.PrivateAttr(uuidKey).(string)
+	libraryLabel := label.New("", args.Rel, mergedName(args, pyLibrary))
+	if py.libraryUUIDs == nil {
+		py.libraryUUIDs = make(map[string]label.Label)
+	}
+	py.libraryUUIDs[libraryUUID] = libraryLabel
+	for i, r := range result.Gen {
+		modules, ok := result.Imports[i].(*treeset.Set)
+		if !ok || !modules.Contains(module{Name: libraryUUID}) {
+			continue
+		}
+		if py.embeddedLibraries == nil {
+			py.embeddedLibraries = make(map[label.Label]label.Label)
+		}
+		py.embeddedLibraries[label.New("", args.Rel, mergedName(args, r))] = libraryLabel
+	}
+}
+
+// mergedName returns the name of the existing rule the given generated rule is
+// merged into, matched by name or by its srcs like Gazelle does, e.g. a
+// py_library named differently from the naming convention. It returns the
+// name of the generated rule if none matches.
+func mergedName(args language.GenerateArgs, r *rule.Rule) string {
+	if args.File == nil {
+		return r.Name()
+	}
+	info := pyKinds[r.Kind()]
+	kind := r.Kind()
+	if mapped, ok := args.Config.KindMap[kind]; ok {
+		kind = mapped.KindName
+	}
+	// The kind of the generated rule is mapped once all the rules are
+	// generated, before they're merged.
+	x := rule.NewRule(kind, r.Name())
+	for _, attr := range info.MatchAttrs {
+		if value := r.Attr(attr); value != nil {
+			x.SetAttr(attr, value)
+		}
+	}
+	if existing, err := merger.Match(args.File.Rules, x, info); err == nil && existing != nil {
+		return existing.Name()
+	}
+	return r.Name()
+}
+
+// guardedPlatforms returns the sorted platforms, i.e. both an operating system
+// and an architecture, the imports of the generated targets are restricted to,
+// e.g. by `if platform.system() == "Windows" and platform.machine() == "AMD64":`.
+// The imports of the standard library add no dependency, so they're skipped.
+func guardedPlatforms(cfg *pythonconfig.Config, imports []interface{}) []rule.Platform {
+	platforms := make(map[rule.Platform]bool)
+	for _, modulesRaw := range imports {
+		modules, ok := modulesRaw.(*treeset.Set)
+		if !ok {
+			continue
+		}
+		it := modules.Iterator()
+		for it.Next() {
+			mod := it.Value().(module)
+			if mod.TypeOnly && cfg.TypeOnlyImportsAsTypeDeps() {
+				continue
+			}
+			platform, ok := platformConstraint(mod.Conditions)
+			if !ok || platform.OS == "" || platform.Arch == "" || platforms[platform.Platform] {
+				continue
+			}
+			if isStd, err := isStdModule(mod); err == nil && isStd {
+				continue
+			}
+			platforms[platform.Platform] = true
+		}
+	}
+	sorted := make([]rule.Platform, 0, len(platforms))
+	for platform := range platforms {
+		sorted = append(sorted, platform)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].String() < sorted[j].String()
+	})
+	return sorted
+}
+
 // isBazelPackage determines if the directory is a Bazel package by probing for
 // the existence of a known BUILD file name.
 func isBazelPackage(dir string) bool {
@@ -349,10 +571,11 @@ func isBazelPackage(dir string) bool {
 }
 
 // hasEntrypointFile determines if the directory has any of the established
-// entrypoint filenames.
-func hasEntrypointFile(dir string) bool {
+// entrypoint filenames or the configured library entrypoint filename.
+func hasEntrypointFile(dir, libraryEntrypointFilename string) bool {
 	for _, entrypointFilename := range []string{
 		pyLibraryEntrypointFilename,
+		libraryEntrypointFilename,
 		pyBinaryEntrypointFilename,
 		pyTestEntrypointFilename,
 	} {
@@ -364,12 +587,29 @@ func hasEntrypointFile(dir string) bool {
 	return false
 }
 
-// isEntrypointFile returns whether the given path is an entrypoint file. The
-// given path can be absolute or relative.
-func isEntrypointFile(path string) bool {
+// hasPythonShebang determines if the first line of the file is a shebang
+// running a Python interpreter, e.g. `#!/usr/bin/env python3`.
+func hasPythonShebang(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	firstLine, err := bufio.NewReader(file).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false
+	}
+	return strings.HasPrefix(firstLine, "#!") && strings.Contains(firstLine, "python")
+}
+
+// isEntrypointFile returns whether the given path is an entrypoint file,
+// including the configured library entrypoint filename. The given path can be
+// absolute or relative.
+func isEntrypointFile(path, libraryEntrypointFilename string) bool {
 	basePath := filepath.Base(path)
 	switch basePath {
 	case pyLibraryEntrypointFilename,
+		libraryEntrypointFilename,
 		pyBinaryEntrypointFilename,
 		pyTestEntrypointFilename:
 		return true
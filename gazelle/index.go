@@ -0,0 +1,83 @@
+package python
+
+import (
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+)
+
+// indexedImportKind represents the kind of an import provided by an indexed
+// target that isn't importable as is, so it isn't indexed in the RuleIndex,
+// e.g. a private module or a stub.
+type indexedImportKind int
+
+const (
+	// privateImport is a private module, i.e. outside of the public modules
+	// when only they're indexed, or a test helper. It's only importable from
+	// the same Bazel package.
+	privateImport indexedImportKind = iota
+	// stubImport is the module of a `.pyi` stub, e.g. a hand-written one under
+	// the stubs root or the one of a compiled extension module. It's only
+	// resolved as a type-checking dependency.
+	stubImport
+	// protoStubImport is a `_pb2` module, whose companion `_pb2.pyi` stub is
+	// needed along with the generated code.
+	protoStubImport
+	// submoduleImport is a Python package with modules under it, resolving the
+	// star imports of the package.
+	submoduleImport
+	// reexportedNameImport is a name re-exported by a Python package, e.g.
+	// `mypkg.Thing`.
+	reexportedNameImport
+	// pkgutilNamespacePackageImport is a pkgutil-style namespace package the
+	// target contributes to.
+	pkgutilNamespacePackageImport
+	// contentHashImport is the SHA-256 hash of the content of a module, e.g.
+	// to report the moved modules.
+	contentHashImport
+)
+
+// indexedImport represents an import of a given kind provided by an indexed
+// target.
+type indexedImport struct {
+	kind indexedImportKind
+	imp  string
+}
+
+// recordIndexedImport records the import of the given kind provided by the
+// indexed target with the given label.
+func (py *Resolver) recordIndexedImport(lbl label.Label, kind indexedImportKind, imp string) {
+	key := indexedImport{kind: kind, imp: imp}
+	if py.indexedImports == nil {
+		py.indexedImports = make(map[label.Label]map[indexedImport]bool)
+		py.importProviders = make(map[indexedImport][]label.Label)
+	}
+	if py.indexedImports[lbl] == nil {
+		py.indexedImports[lbl] = make(map[indexedImport]bool)
+	}
+	if py.indexedImports[lbl][key] {
+		return
+	}
+	py.indexedImports[lbl][key] = true
+	py.importProviders[key] = append(py.importProviders[key], lbl)
+}
+
+// findIndexedImport returns the targets providing the import of the given
+// kind, like RuleIndex.FindRulesByImport.
+func (py *Resolver) findIndexedImport(c *config.Config, kind indexedImportKind, imp string) []resolve.FindResult {
+	providers := py.importProviders[indexedImport{kind: kind, imp: imp}]
+	results := make([]resolve.FindResult, 0, len(providers))
+	for _, provider := range providers {
+		results = append(results, resolve.FindResult{Label: label.New(c.RepoName, provider.Pkg, provider.Name)})
+	}
+	return results
+}
+
+// providesIndexedImport returns whether the indexed target with the given
+// label provides the import of the given kind.
+func (py *Resolver) providesIndexedImport(c *config.Config, lbl label.Label, kind indexedImportKind, imp string) bool {
+	if lbl.Repo != "" && lbl.Repo != c.RepoName {
+		return false
+	}
+	return py.indexedImports[label.New("", lbl.Pkg, lbl.Name)][indexedImport{kind: kind, imp: imp}]
+}
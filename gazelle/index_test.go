@@ -0,0 +1,46 @@
+package python
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+)
+
+func TestIndexedImports(t *testing.T) {
+	c := newTestConfig("lib", "other")
+	c.RepoName = "main"
+	var py Resolver
+	lib, other := label.New("", "lib", "lib"), label.New("", "other", "other")
+	py.recordIndexedImport(lib, privateImport, "lib._impl")
+	py.recordIndexedImport(lib, privateImport, "lib._impl")
+	py.recordIndexedImport(other, privateImport, "lib._impl")
+	py.recordIndexedImport(other, stubImport, "lib._impl")
+
+	t.Run("finds the targets providing the import", func(t *testing.T) {
+		var got []string
+		for _, result := range py.findIndexedImport(c, privateImport, "lib._impl") {
+			got = append(got, result.Label.String())
+		}
+		want := []string{"@main//lib", "@main//other"}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+	})
+	t.Run("tells the kinds of imports apart", func(t *testing.T) {
+		if got := py.findIndexedImport(c, stubImport, "lib._impl"); len(got) != 1 || got[0].Label.Pkg != "other" {
+			t.Errorf("expected the stub to be provided by //other only, got %v", got)
+		}
+		if py.providesIndexedImport(c, label.New("main", "lib", "lib"), stubImport, "lib._impl") {
+			t.Errorf("expected //lib not to provide the stub")
+		}
+		if !py.providesIndexedImport(c, label.New("main", "other", "other"), stubImport, "lib._impl") {
+			t.Errorf("expected //other to provide the stub")
+		}
+	})
+	t.Run("doesn't match the targets of other repositories", func(t *testing.T) {
+		if py.providesIndexedImport(c, label.New("ext", "lib", "lib"), privateImport, "lib._impl") {
+			t.Errorf("expected @ext//lib not to provide the import")
+		}
+	})
+}
@@ -8,6 +8,15 @@ const (
 	pyBinaryKind  = "py_binary"
 	pyLibraryKind = "py_library"
 	pyTestKind    = "py_test"
+
+	// The kinds of the proto rules that aren't generated but are indexed to
+	// resolve the imports of the generated `_pb2` modules.
+	protoLibraryKind   = "proto_library"
+	pyProtoLibraryKind = "py_proto_library"
+
+	// The kind of the rules matching a platform, i.e. both an operating system
+	// and an architecture, to select the imports guarded by checks of both.
+	configSettingKind = "config_setting"
 )
 
 // Kinds returns a map that maps rule names (kinds) and information on how to
@@ -20,6 +29,7 @@ var pyKinds = map[string]rule.KindInfo{
 	pyBinaryKind: {
 		MatchAny: true,
 		NonEmptyAttrs: map[string]bool{
+			"data":       true,
 			"deps":       true,
 			"main":       true,
 			"srcs":       true,
@@ -31,12 +41,14 @@ var pyKinds = map[string]rule.KindInfo{
 			"srcs": true,
 		},
 		ResolveAttrs: map[string]bool{
-			"deps": true,
+			"deps":     true,
+			"pyi_deps": true,
 		},
 	},
 	pyLibraryKind: {
 		MatchAny: true,
 		NonEmptyAttrs: map[string]bool{
+			"data":       true,
 			"deps":       true,
 			"srcs":       true,
 			"imports":    true,
@@ -47,12 +59,14 @@ var pyKinds = map[string]rule.KindInfo{
 			"srcs": true,
 		},
 		ResolveAttrs: map[string]bool{
-			"deps": true,
+			"deps":     true,
+			"pyi_deps": true,
 		},
 	},
 	pyTestKind: {
 		MatchAny: true,
 		NonEmptyAttrs: map[string]bool{
+			"data":       true,
 			"deps":       true,
 			"main":       true,
 			"srcs":       true,
@@ -64,11 +78,41 @@ var pyKinds = map[string]rule.KindInfo{
 			"srcs": true,
 		},
 		ResolveAttrs: map[string]bool{
+			"deps":     true,
+			"pyi_deps": true,
+		},
+	},
+	pyProtoLibraryKind: {
+		NonEmptyAttrs: map[string]bool{
 			"deps": true,
 		},
+		SubstituteAttrs: map[string]bool{},
+		MergeableAttrs:  map[string]bool{},
+		ResolveAttrs:    map[string]bool{},
+	},
+	configSettingKind: {
+		NonEmptyAttrs: map[string]bool{
+			"constraint_values": true,
+		},
+		SubstituteAttrs: map[string]bool{},
+		MergeableAttrs: map[string]bool{
+			"constraint_values": true,
+		},
+		ResolveAttrs: map[string]bool{},
 	},
 }
 
+// addResolveAttr makes the given attribute of the rules of the given kind
+// resolved like deps, e.g. the one set by the python_deps_attribute directive.
+// Gazelle reads the KindInfo maps returned by Kinds when merging the rules,
+// after the directives are configured, so the attribute of the existing rules
+// is updated as well.
+func addResolveAttr(kind, attr string) {
+	if info, ok := pyKinds[kind]; ok {
+		info.ResolveAttrs[attr] = true
+	}
+}
+
 // Loads returns .bzl files and symbols they define. Every rule generated by
 // GenerateRules, now or in the past, should be loadable from one of these
 // files.
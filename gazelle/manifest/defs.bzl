@@ -11,6 +11,8 @@ def gazelle_python_manifest(
         pip_repository_name = "",
         pip_repository_incremental = False,
         pip_deps_repository_name = "",
+        platform_requirements = {},
+        platform_pip_repository_names = {},
         manifest = ":gazelle_python.yaml"):
     """A macro for defining the updating and testing targets for the Gazelle manifest file.
 
@@ -21,6 +23,12 @@ def gazelle_python_manifest(
         pip_repository_incremental: the incremental property of pip_repository.
         pip_deps_repository_name: deprecated - the old pip_install target name.
         modules_mapping: the target for the generated modules_mapping.json file.
+        platform_requirements: a dict from operating systems (e.g. "linux" or
+            "darwin") to the targets for their platform-specific
+            requirements.txt files.
+        platform_pip_repository_names: a dict from operating systems to the
+            names of the pip_install or pip_repository targets of their
+            platform-specific requirements.
         manifest: the target for the Gazelle manifest file.
     """
     if pip_deps_repository_name != "":
@@ -53,6 +61,24 @@ def gazelle_python_manifest(
     if pip_repository_incremental:
         update_args.append("--pip-repository-incremental")
 
+    platform_requirements_args = []
+    for os, platform_requirement in platform_requirements.items():
+        if os not in platform_pip_repository_names:
+            fail("platform_pip_repository_names must be set for {} in //{}:{}".format(
+                os,
+                native.package_name(),
+                name,
+            ))
+        platform_requirements_args.extend([
+            "--platform-requirements",
+            "{}=$(rootpath {})".format(os, platform_requirement),
+        ])
+        update_args.extend([
+            "--platform-pip-repository-name",
+            "{}={}".format(os, platform_pip_repository_names[os]),
+        ])
+    update_args.extend(platform_requirements_args)
+
     go_binary(
         name = update_target,
         embed = ["@rules_python//gazelle/manifest/generate:generate_lib"],
@@ -60,7 +86,7 @@ def gazelle_python_manifest(
             manifest,
             modules_mapping,
             requirements,
-        ],
+        ] + platform_requirements.values(),
         args = update_args,
         visibility = ["//visibility:private"],
         tags = ["manual"],
@@ -81,10 +107,11 @@ def gazelle_python_manifest(
             ":{}".format(test_binary),
             manifest,
             requirements,
-        ],
+        ] + platform_requirements.values(),
         env = {
             "_TEST_BINARY": "$(rootpath :{})".format(test_binary),
             "_TEST_MANIFEST": "$(rootpath {})".format(manifest),
+            "_TEST_PLATFORM_REQUIREMENTS_ARGS": " ".join(platform_requirements_args),
             "_TEST_REQUIREMENTS": "$(rootpath {})".format(requirements),
         },
         visibility = ["//visibility:private"],
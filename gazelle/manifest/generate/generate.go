@@ -12,6 +12,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/bazelbuild/rules_python/gazelle/manifest"
@@ -30,6 +31,8 @@ func main() {
 	var modulesMappingPath string
 	var outputPath string
 	var updateTarget string
+	platformRequirementsPaths := make(keyValueFlag)
+	platformPipRepositoryNames := make(keyValueFlag)
 	flag.StringVar(
 		&requirementsPath,
 		"requirements",
@@ -60,6 +63,15 @@ func main() {
 		"update-target",
 		"",
 		"The Bazel target to update the YAML manifest file.")
+	flag.Var(
+		&platformRequirementsPaths,
+		"platform-requirements",
+		"The platform-specific requirements.txt file, in the <os>=<path> form. Can be repeated.")
+	flag.Var(
+		&platformPipRepositoryNames,
+		"platform-pip-repository-name",
+		"The name of the pip_install or pip_repository target of the platform-specific requirements, "+
+			"in the <os>=<name> form. Can be repeated.")
 	flag.Parse()
 
 	if requirementsPath == "" {
@@ -78,7 +90,13 @@ func main() {
 		log.Fatalln("ERROR: --update-target must be set")
 	}
 
-	modulesMapping, err := unmarshalJSON(modulesMappingPath)
+	for goos := range platformRequirementsPaths {
+		if _, ok := platformPipRepositoryNames[goos]; !ok {
+			log.Fatalf("ERROR: --platform-pip-repository-name must be set for %q\n", goos)
+		}
+	}
+
+	modulesMapping, modulesMappingConflicts, err := unmarshalJSON(modulesMappingPath)
 	if err != nil {
 		log.Fatalf("ERROR: %v\n", err)
 	}
@@ -86,32 +104,69 @@ func main() {
 	header := generateHeader(updateTarget)
 
 	manifestFile := manifest.NewFile(&manifest.Manifest{
-		ModulesMapping: modulesMapping,
+		ModulesMapping:          modulesMapping,
+		ModulesMappingConflicts: modulesMappingConflicts,
 		PipRepository: &manifest.PipRepository{
 			Name:        pipRepositoryName,
 			Incremental: pipRepositoryIncremental,
 		},
 	})
-	if err := writeOutput(outputPath, header, manifestFile, requirementsPath); err != nil {
+
+	platformRequirements := platformRequirementsPaths.values()
+	if len(platformRequirements) > 0 {
+		platformDistributions, err := manifest.PlatformDistributions(platformRequirements)
+		if err != nil {
+			log.Fatalf("ERROR: %v\n", err)
+		}
+		manifestFile.Manifest.PlatformDistributions = platformDistributions
+		manifestFile.Manifest.PlatformPipRepositories = make(map[string]*manifest.PipRepository)
+		for goos := range platformRequirementsPaths {
+			manifestFile.Manifest.PlatformPipRepositories[goos] = &manifest.PipRepository{
+				Name:        platformPipRepositoryNames[goos],
+				Incremental: pipRepositoryIncremental,
+			}
+		}
+	}
+
+	if err := writeOutput(outputPath, header, manifestFile, requirementsPath, platformRequirements); err != nil {
 		log.Fatalf("ERROR: %v\n", err)
 	}
 }
 
-// unmarshalJSON returns the parsed mapping from the given JSON file path.
-func unmarshalJSON(jsonPath string) (map[string]string, error) {
+// unmarshalJSON returns the parsed mapping from the given JSON file path, along
+// with the modules provided by multiple wheels, mapped to all of them.
+func unmarshalJSON(jsonPath string) (map[string]string, map[string][]string, error) {
 	file, err := os.Open(jsonPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal JSON file: %w", err)
+		return nil, nil, fmt.Errorf("failed to unmarshal JSON file: %w", err)
 	}
 	defer file.Close()
 
 	decoder := json.NewDecoder(file)
+	raw := make(map[string]json.RawMessage)
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal JSON file: %w", err)
+	}
+
 	output := make(map[string]string)
-	if err := decoder.Decode(&output); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal JSON file: %w", err)
+	var conflicts map[string][]string
+	for module, value := range raw {
+		var wheelName string
+		if err := json.Unmarshal(value, &wheelName); err == nil {
+			output[module] = wheelName
+			continue
+		}
+		var wheelNames []string
+		if err := json.Unmarshal(value, &wheelNames); err != nil {
+			return nil, nil, fmt.Errorf("failed to unmarshal JSON file: %w", err)
+		}
+		if conflicts == nil {
+			conflicts = make(map[string][]string)
+		}
+		conflicts[module] = wheelNames
 	}
 
-	return output, nil
+	return output, conflicts, nil
 }
 
 // generateHeader generates the YAML header human-readable comment.
@@ -130,6 +185,7 @@ func writeOutput(
 	header string,
 	manifestFile *manifest.File,
 	requirementsPath string,
+	platformRequirementsPaths []string,
 ) error {
 	stat, err := os.Stat(outputPath)
 	if err != nil {
@@ -146,9 +202,39 @@ func writeOutput(
 		return fmt.Errorf("failed to write output: %w", err)
 	}
 
-	if err := manifestFile.Encode(outputFile, requirementsPath); err != nil {
+	if err := manifestFile.Encode(outputFile, requirementsPath, platformRequirementsPaths...); err != nil {
 		return fmt.Errorf("failed to write output: %w", err)
 	}
 
 	return nil
 }
+
+// keyValueFlag is a repeatable flag in the <key>=<value> form.
+type keyValueFlag map[string]string
+
+func (f keyValueFlag) String() string {
+	return fmt.Sprint(map[string]string(f))
+}
+
+func (f keyValueFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("expected the <key>=<value> form: %q", value)
+	}
+	f[parts[0]] = parts[1]
+	return nil
+}
+
+// values returns the values sorted by their keys.
+func (f keyValueFlag) values() []string {
+	keys := make([]string, 0, len(f))
+	for key := range f {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	values := make([]string, 0, len(keys))
+	for _, key := range keys {
+		values = append(values, f[key])
+	}
+	return values
+}
@@ -1,10 +1,14 @@
 package manifest
 
 import (
+	"bufio"
 	"crypto/sha256"
 	"fmt"
 	"io"
 	"os"
+	"regexp"
+	"sort"
+	"strings"
 
 	yaml "gopkg.in/yaml.v2"
 )
@@ -23,13 +27,14 @@ func NewFile(manifest *Manifest) *File {
 	return &File{Manifest: manifest}
 }
 
-// Encode encodes the manifest file to the given writer.
-func (f *File) Encode(w io.Writer, requirementsPath string) error {
-	requirementsChecksum, err := sha256File(requirementsPath)
+// Encode encodes the manifest file to the given writer. The platform-specific
+// requirements files, if any, are part of the integrity as well.
+func (f *File) Encode(w io.Writer, requirementsPath string, platformRequirementsPaths ...string) error {
+	requirementsChecksums, err := sha256Files(append([]string{requirementsPath}, platformRequirementsPaths...))
 	if err != nil {
 		return fmt.Errorf("failed to encode manifest file: %w", err)
 	}
-	integrityBytes, err := f.calculateIntegrity(requirementsChecksum)
+	integrityBytes, err := f.calculateIntegrity(requirementsChecksums)
 	if err != nil {
 		return fmt.Errorf("failed to encode manifest file: %w", err)
 	}
@@ -43,12 +48,12 @@ func (f *File) Encode(w io.Writer, requirementsPath string) error {
 }
 
 // VerifyIntegrity verifies if the integrity set in the File is valid.
-func (f *File) VerifyIntegrity(requirementsPath string) (bool, error) {
-	requirementsChecksum, err := sha256File(requirementsPath)
+func (f *File) VerifyIntegrity(requirementsPath string, platformRequirementsPaths ...string) (bool, error) {
+	requirementsChecksums, err := sha256Files(append([]string{requirementsPath}, platformRequirementsPaths...))
 	if err != nil {
 		return false, fmt.Errorf("failed to verify integrity: %w", err)
 	}
-	integrityBytes, err := f.calculateIntegrity(requirementsChecksum)
+	integrityBytes, err := f.calculateIntegrity(requirementsChecksums)
 	if err != nil {
 		return false, fmt.Errorf("failed to verify integrity: %w", err)
 	}
@@ -57,10 +62,10 @@ func (f *File) VerifyIntegrity(requirementsPath string) (bool, error) {
 }
 
 // calculateIntegrity calculates the integrity of the manifest file based on the
-// provided checksum for the requirements.txt file used as input to the modules
-// mapping, plus the manifest structure in the manifest file. This integrity
-// calculation ensures the manifest files are kept up-to-date.
-func (f *File) calculateIntegrity(requirementsChecksum []byte) ([]byte, error) {
+// provided checksums for the requirements.txt files used as input to the
+// modules mapping, plus the manifest structure in the manifest file. This
+// integrity calculation ensures the manifest files are kept up-to-date.
+func (f *File) calculateIntegrity(requirementsChecksums [][]byte) ([]byte, error) {
 	hash := sha256.New()
 
 	// Sum the manifest part of the file.
@@ -70,9 +75,11 @@ func (f *File) calculateIntegrity(requirementsChecksum []byte) ([]byte, error) {
 		return nil, fmt.Errorf("failed to calculate integrity: %w", err)
 	}
 
-	// Sum the requirements.txt checksum bytes.
-	if _, err := hash.Write(requirementsChecksum); err != nil {
-		return nil, fmt.Errorf("failed to calculate integrity: %w", err)
+	// Sum the requirements.txt checksums bytes.
+	for _, requirementsChecksum := range requirementsChecksums {
+		if _, err := hash.Write(requirementsChecksum); err != nil {
+			return nil, fmt.Errorf("failed to calculate integrity: %w", err)
+		}
 	}
 
 	return hash.Sum(nil), nil
@@ -99,12 +106,24 @@ type Manifest struct {
 	// ModulesMapping is the mapping from importable modules to which Python
 	// wheel name provides these modules.
 	ModulesMapping map[string]string `yaml:"modules_mapping"`
+	// ModulesMappingConflicts maps the importable modules provided by multiple
+	// Python wheels, e.g. Crypto from both pycrypto and pycryptodome, to all of
+	// them. They aren't part of ModulesMapping.
+	ModulesMappingConflicts map[string][]string `yaml:"modules_mapping_conflicts,omitempty"`
 	// PipDepsRepositoryName is the name of the pip_install repository target.
 	// DEPRECATED
 	PipDepsRepositoryName string `yaml:"pip_deps_repository_name,omitempty"`
 	// PipRepository contains the information for pip_install or pip_repository
 	// target.
 	PipRepository *PipRepository `yaml:"pip_repository,omitempty"`
+	// PlatformPipRepositories maps operating systems, e.g. linux or darwin, to
+	// the pip_install or pip_repository targets of their platform-specific
+	// requirements.
+	PlatformPipRepositories map[string]*PipRepository `yaml:"platform_pip_repositories,omitempty"`
+	// PlatformDistributions are the sanitized names of the distributions that
+	// are pinned differently across the platform-specific requirements. Their
+	// modules are resolved to the platform pip repositories.
+	PlatformDistributions []string `yaml:"platform_distributions,omitempty"`
 }
 
 type PipRepository struct {
@@ -114,6 +133,123 @@ type PipRepository struct {
 	Incremental bool
 }
 
+// requirementRegexp matches a pinned requirement, e.g. `numpy==1.23.5`,
+// capturing the distribution name and the version.
+var requirementRegexp = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9._-]*)(?:\[[^\]]*\])?\s*==\s*([^\s;\\]+)`)
+
+// PlatformDistributions returns the sanitized names, sorted, of the
+// distributions that are not pinned to the same version by all the given
+// platform-specific requirements files.
+func PlatformDistributions(platformRequirementsPaths []string) ([]string, error) {
+	pins := make([]map[string]string, 0, len(platformRequirementsPaths))
+	distributions := make(map[string]struct{})
+	for _, requirementsPath := range platformRequirementsPaths {
+		requirementsPins, err := pinnedRequirements(requirementsPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find platform distributions: %w", err)
+		}
+		for distribution := range requirementsPins {
+			distributions[distribution] = struct{}{}
+		}
+		pins = append(pins, requirementsPins)
+	}
+	platformDistributions := make([]string, 0)
+	for distribution := range distributions {
+		for _, requirementsPins := range pins {
+			if requirementsPins[distribution] != pins[0][distribution] {
+				platformDistributions = append(platformDistributions, distribution)
+				break
+			}
+		}
+	}
+	sort.Strings(platformDistributions)
+	return platformDistributions, nil
+}
+
+// pinnedRequirements returns the versions of the requirements pinned by the
+// given requirements file, keyed by the sanitized distribution name.
+func pinnedRequirements(requirementsPath string) (map[string]string, error) {
+	file, err := os.Open(requirementsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	pins := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if match := requirementRegexp.FindStringSubmatch(line); match != nil {
+			pins[SanitizeDistributionName(match[1])] = match[2]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return pins, nil
+}
+
+// distributionNameSeparatorsRegexp matches the runs of separators in a
+// distribution name.
+var distributionNameSeparatorsRegexp = regexp.MustCompile(`[-_.]+`)
+
+// distributionExtrasRegexp matches a distribution name followed by its extras,
+// e.g. `requests[security]`.
+var distributionExtrasRegexp = regexp.MustCompile(`^([^\[\]]*)\[([^\[\]]*)\]$`)
+
+// SanitizeDistributionName returns the distribution name as used in the labels
+// of the pip repositories. The name is normalized according to PEP 503, except
+// that the runs of separators are replaced with an underscore instead of a
+// dash. The extras of the distribution, if any, are appended to the name,
+// separated by underscores, e.g. `requests_security` for `requests[security]`.
+func SanitizeDistributionName(distribution string) string {
+	name, extras := SplitDistributionExtras(distribution)
+	sanitized := sanitizeName(name)
+	for _, extra := range extras {
+		sanitized += "_" + sanitizeName(extra)
+	}
+	return sanitized
+}
+
+// SplitDistributionExtras returns the name of the distribution and its extras,
+// sorted, e.g. `requests` and `security` for `requests[security]`. The
+// extras are nil for a bare distribution name.
+func SplitDistributionExtras(distribution string) (string, []string) {
+	distribution = strings.TrimSpace(distribution)
+	match := distributionExtrasRegexp.FindStringSubmatch(distribution)
+	if match == nil {
+		return distribution, nil
+	}
+	var extras []string
+	for _, extra := range strings.Split(match[2], ",") {
+		if extra = strings.TrimSpace(extra); extra != "" {
+			extras = append(extras, extra)
+		}
+	}
+	sort.Strings(extras)
+	return strings.TrimSpace(match[1]), extras
+}
+
+// sanitizeName normalizes a distribution or extra name according to PEP 503,
+// with underscores as the separators.
+func sanitizeName(name string) string {
+	sanitized := strings.ToLower(name)
+	return distributionNameSeparatorsRegexp.ReplaceAllString(sanitized, "_")
+}
+
+// sha256Files calculates the checksums of the given file paths.
+func sha256Files(filePaths []string) ([][]byte, error) {
+	checksums := make([][]byte, 0, len(filePaths))
+	for _, filePath := range filePaths {
+		checksum, err := sha256File(filePath)
+		if err != nil {
+			return nil, err
+		}
+		checksums = append(checksums, checksum)
+	}
+	return checksums, nil
+}
+
 // sha256File calculates the checksum of a given file path.
 func sha256File(filePath string) ([]byte, error) {
 	file, err := os.Open(filePath)
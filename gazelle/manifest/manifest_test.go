@@ -76,4 +76,53 @@ func TestFile(t *testing.T) {
 			t.FailNow()
 		}
 	})
-}
\ No newline at end of file
+}
+func TestPlatformDistributions(t *testing.T) {
+	platformDistributions, err := manifest.PlatformDistributions([]string{
+		"testdata/requirements-darwin.txt",
+		"testdata/requirements-linux.txt",
+	})
+	if err != nil {
+		log.Println(err)
+		t.FailNow()
+	}
+	expected := []string{"numpy", "pyobjc_core"}
+	if !reflect.DeepEqual(expected, platformDistributions) {
+		log.Printf("platform distributions %v don't match expected value %v\n", platformDistributions, expected)
+		t.FailNow()
+	}
+}
+
+func TestSanitizeDistributionName(t *testing.T) {
+	for distribution, expected := range map[string]string{
+		"numpy":                     "numpy",
+		"PyYAML":                    "pyyaml",
+		"zope.interface":            "zope_interface",
+		"ruamel.yaml.clib":          "ruamel_yaml_clib",
+		"Foo-_.Bar":                 "foo_bar",
+		"requests[security]":        "requests_security",
+		"Requests[socks, Security]": "requests_security_socks",
+		"zope.interface[test]":      "zope_interface_test",
+	} {
+		if sanitized := manifest.SanitizeDistributionName(distribution); sanitized != expected {
+			log.Printf("sanitized distribution %q doesn't match expected value %q\n", sanitized, expected)
+			t.Fail()
+		}
+	}
+}
+
+func TestSplitDistributionExtras(t *testing.T) {
+	for distribution, expected := range map[string][]string{
+		"requests":                  {"requests"},
+		"requests[security]":        {"requests", "security"},
+		"requests[socks, security]": {"requests", "security", "socks"},
+		"requests[]":                {"requests"},
+		"requests[security":         {"requests[security"},
+	} {
+		name, extras := manifest.SplitDistributionExtras(distribution)
+		if got := append([]string{name}, extras...); !reflect.DeepEqual(got, expected) {
+			log.Printf("split distribution %v doesn't match expected value %v\n", got, expected)
+			t.Fail()
+		}
+	}
+}
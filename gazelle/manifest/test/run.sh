@@ -5,4 +5,8 @@
 
 set -o errexit -o nounset
 
-"${_TEST_BINARY}" --requirements "${_TEST_REQUIREMENTS}" --manifest "${_TEST_MANIFEST}"
\ No newline at end of file
+# _TEST_PLATFORM_REQUIREMENTS_ARGS is intentionally unquoted so it's split into
+# the repeated --platform-requirements arguments.
+# shellcheck disable=SC2086
+"${_TEST_BINARY}" --requirements "${_TEST_REQUIREMENTS}" --manifest "${_TEST_MANIFEST}" \
+    ${_TEST_PLATFORM_REQUIREMENTS_ARGS:-}
\ No newline at end of file
@@ -9,8 +9,11 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/bazelbuild/rules_python/gazelle/manifest"
 )
@@ -18,6 +21,7 @@ import (
 func main() {
 	var requirementsPath string
 	var manifestPath string
+	platformRequirementsPaths := make(keyValueFlag)
 	flag.StringVar(
 		&requirementsPath,
 		"requirements",
@@ -28,6 +32,10 @@ func main() {
 		"manifest",
 		"",
 		"The manifest YAML file.")
+	flag.Var(
+		&platformRequirementsPaths,
+		"platform-requirements",
+		"The platform-specific requirements.txt file, in the <os>=<path> form. Can be repeated.")
 	flag.Parse()
 
 	if requirementsPath == "" {
@@ -47,7 +55,7 @@ func main() {
 		log.Fatalln("ERROR: failed to find the Gazelle manifest file integrity")
 	}
 
-	valid, err := manifestFile.VerifyIntegrity(requirementsPath)
+	valid, err := manifestFile.VerifyIntegrity(requirementsPath, platformRequirementsPaths.values()...)
 	if err != nil {
 		log.Fatalf("ERROR: %v\n", err)
 	}
@@ -60,4 +68,34 @@ func main() {
 			"ERROR: %q is out-of-date, follow the intructions on this file for updating.\n",
 			manifestRealpath)
 	}
-}
\ No newline at end of file
+}
+// keyValueFlag is a repeatable flag in the <key>=<value> form.
+type keyValueFlag map[string]string
+
+func (f keyValueFlag) String() string {
+	return fmt.Sprint(map[string]string(f))
+}
+
+func (f keyValueFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("expected the <key>=<value> form: %q", value)
+	}
+	f[parts[0]] = parts[1]
+	return nil
+}
+
+// values returns the values sorted by their keys, matching the order used
+// when generating the manifest.
+func (f keyValueFlag) values() []string {
+	keys := make([]string, 0, len(f))
+	for key := range f {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	values := make([]string, 0, len(keys))
+	for _, key := range keys {
+		values = append(values, f[key])
+	}
+	return values
+}
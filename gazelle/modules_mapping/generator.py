@@ -42,12 +42,20 @@ class Generator:
     # run is the entrypoint for the generator.
     def run(self, wheels):
         mapping = {}
+        conflicts = {}
         for whl in wheels:
             try:
-                mapping.update(self.dig_wheel(whl))
+                for module, wheel_name in self.dig_wheel(whl).items():
+                    if mapping.get(module, wheel_name) != wheel_name:
+                        conflicts.setdefault(module, {mapping[module]}).add(wheel_name)
+                    mapping[module] = wheel_name
             except AssertionError as error:
                 print(error, file=self.stderr)
                 return 1
+        # The modules provided by multiple wheels map to all of them, sorted,
+        # e.g. Crypto from both pycrypto and pycryptodome.
+        for module, wheel_names in conflicts.items():
+            mapping[module] = sorted(wheel_names)
         mapping_json = json.dumps(mapping)
         with open(self.output_file, "w") as f:
             f.write(mapping_json)
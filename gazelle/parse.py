@@ -11,28 +11,660 @@ from io import BytesIO
 from tokenize import COMMENT, tokenize
 
 
-def parse_import_statements(content, filepath):
-    modules = list()
+COMPARISON_OPERATORS = {
+    ast.Eq: "==",
+    ast.NotEq: "!=",
+    ast.Lt: "<",
+    ast.LtE: "<=",
+    ast.Gt: ">",
+    ast.GtE: ">=",
+}
+NEGATED_OPERATORS = {
+    "==": "!=",
+    "!=": "==",
+    "<": ">=",
+    "<=": ">",
+    ">": "<=",
+    ">=": "<",
+}
+REVERSED_OPERATORS = {
+    "==": "==",
+    "!=": "!=",
+    "<": ">",
+    "<=": ">=",
+    ">": "<",
+    ">=": "<=",
+}
+
+
+def parse_version_subject(node):
+    # Returns the subject of a Python version comparison, i.e. whether the
+    # whole version, the major or the minor component is compared.
+    if dotted_name(node) in ("sys.version_info", "version_info"):
+        return "python_version"
+    if isinstance(node, ast.Attribute) and node.attr in ("major", "minor"):
+        if parse_version_subject(node.value) == "python_version":
+            return "python_version_" + node.attr
+        return None
+    if isinstance(node, ast.Subscript):
+        if parse_version_subject(node.value) != "python_version":
+            return None
+        index = node.slice
+        # Python < 3.9 wraps the subscript in ast.Index.
+        if hasattr(ast, "Index") and isinstance(index, ast.Index):
+            index = index.value
+        if isinstance(index, ast.Slice):
+            if index.lower is None and index.step is None:
+                return "python_version"
+            return None
+        if isinstance(index, ast.Constant) and index.value in (0, 1):
+            return ("python_version_major", "python_version_minor")[index.value]
+    return None
+
+
+# The subjects of the platform comparisons, keyed by the dotted name of the
+# compared expression. The functions are compared by their return value, e.g.
+# `platform.system() == "Linux"`.
+PLATFORM_SUBJECTS = {
+    "sys.platform": "sys_platform",
+    "platform.system()": "platform_system",
+    "platform.machine()": "platform_machine",
+}
+
+
+def parse_platform_subject(node):
+    # Returns the subject of a platform comparison, i.e. whether the operating
+    # system or the machine architecture is compared.
+    if isinstance(node, ast.Call):
+        if node.args or node.keywords:
+            return None
+        name = dotted_name(node.func)
+        if name is None:
+            return None
+        return PLATFORM_SUBJECTS.get(name + "()")
+    return PLATFORM_SUBJECTS.get(dotted_name(node))
+
+
+def parse_platform_value(op, node):
+    # Only the equality of the platform is understood, e.g. platform.system()
+    # is not ordered.
+    if op not in ("==", "!="):
+        return None
+    if isinstance(node, ast.Constant) and isinstance(node.value, str):
+        return node.value
+    return None
+
+
+def parse_version_value(subject, node):
+    if subject == "python_version" and isinstance(node, ast.Tuple):
+        parts = list()
+        for elt in node.elts:
+            if not isinstance(elt, ast.Constant) or type(elt.value) is not int:
+                return None
+            parts.append(str(elt.value))
+        return ".".join(parts) if parts else None
+    if subject != "python_version" and isinstance(node, ast.Constant):
+        if type(node.value) is int:
+            return str(node.value)
+    return None
+
+
+def parse_condition(node):
+    # Returns the list of conditions, which must all hold, represented by the
+    # test of an if statement. Returns None if the test is not fully
+    # understood.
+    if isinstance(node, ast.UnaryOp) and isinstance(node.op, ast.Not):
+        conditions = parse_condition(node.operand)
+        return negate_conditions(conditions)
+    if isinstance(node, ast.BoolOp) and isinstance(node.op, ast.And):
+        conditions = list()
+        for value in node.values:
+            value_conditions = parse_condition(value)
+            if value_conditions is None:
+                return None
+            conditions.extend(value_conditions)
+        return conditions
+    if isinstance(node, ast.Compare) and len(node.ops) == 1:
+        op = COMPARISON_OPERATORS.get(type(node.ops[0]))
+        if op is None:
+            return None
+        left, right = node.left, node.comparators[0]
+        if parse_version_subject(left) is None and parse_platform_subject(left) is None:
+            left, right = right, left
+            op = REVERSED_OPERATORS[op]
+        subject = parse_version_subject(left)
+        if subject is not None:
+            value = parse_version_value(subject, right)
+        else:
+            subject = parse_platform_subject(left)
+            if subject is None:
+                return None
+            value = parse_platform_value(op, right)
+        if value is None:
+            return None
+        return [{"subject": subject, "op": op, "value": value}]
+    return None
+
+
+def negate_conditions(conditions):
+    # Only a single condition can be negated without expressing a disjunction.
+    if conditions is None or len(conditions) != 1:
+        return None
+    condition = conditions[0]
+    return [dict(condition, op=NEGATED_OPERATORS[condition["op"]])]
+
+
+class ImportStatementsVisitor(ast.NodeVisitor):
+    def __init__(self, filepath, lazy_import_helpers=frozenset()):
+        self.filepath = filepath
+        # The lazy-import helper functions, e.g. lazy_loader.load, deferring
+        # the import of the module named by their first argument.
+        self.lazy_import_helpers = lazy_import_helpers
+        self.modules = list()
+        self.conditions = list()
+        # The branch of the enclosing if/else statement with a condition that
+        # is not understood, i.e. "first" or "other", as the imports of its
+        # branches are alternatives.
+        self.alternative = ""
+        # Whether the imports are guarded by a try statement handling
+        # ImportError, i.e. optional.
+        self.optional = False
+        # Whether the imports are guarded by `if TYPE_CHECKING:`, i.e. only
+        # happen for type-checking.
+        self.type_checking = False
+        # The names bound by the import statements, along with their module,
+        # e.g. to find the imports only used in annotations.
+        self.bindings = list()
+
+    def _module(self, name, node):
+        return {
+            "name": name,
+            "lineno": node.lineno,
+            "filepath": self.filepath,
+            "conditions": list(self.conditions),
+            "alternative": self.alternative,
+            "optional": self.optional,
+            "type_only": self.type_checking,
+        }
+
+    def visit_Import(self, node):
+        for subnode in node.names:
+            module = self._module(subnode.name, node)
+            self.modules.append(module)
+            self.bindings.append((module, [subnode.asname or subnode.name.split(".")[0]]))
+
+    def visit_ImportFrom(self, node):
+        if node.level == 0:
+            module = self._module(node.module, node)
+            # Star imports, i.e. `from pkg import *`, may load all the
+            # submodules of the package.
+            module["star"] = any(alias.name == "*" for alias in node.names)
+            # The imported names are kept along with their location, e.g. to
+            # report the deprecated aliases of the standard library.
+            module["names"] = [
+                {"name": alias.name, "lineno": node.lineno, "filepath": self.filepath}
+                for alias in node.names
+                if alias.name != "*"
+            ]
+            self.modules.append(module)
+            if not module["star"]:
+                self.bindings.append((module, [alias.asname or alias.name for alias in node.names]))
+        elif node.module:
+            # Relative imports keep their leading dots, e.g. `from ..pkg import
+            # name` imports "..pkg", to be resolved from the importing module.
+            module = self._module("." * node.level + node.module, node)
+            module["star"] = any(alias.name == "*" for alias in node.names)
+            self.modules.append(module)
+            if not module["star"]:
+                self.bindings.append((module, [alias.asname or alias.name for alias in node.names]))
+        else:
+            # `from . import name` may import a sibling module or a name
+            # defined by the Python package.
+            for alias in node.names:
+                if alias.name != "*":
+                    module = self._module("." * node.level + alias.name, node)
+                    self.modules.append(module)
+                    self.bindings.append((module, [alias.asname or alias.name]))
+
+    def visit_Call(self, node):
+        # Dynamic imports, e.g. importlib.import_module("pkg.mod"), are resolved
+        # according to the confidence in the imported module name.
+        if dotted_name(node.func) in IMPORT_MODULE_FUNCTIONS and node.args:
+            name, confidence = parse_dynamic_import(node.args[0])
+            if name is not None:
+                module = self._module(name, node)
+                module["confidence"] = confidence
+                self.modules.append(module)
+        elif dotted_name(node.func) in self.lazy_import_helpers and node.args:
+            # The lazy imports, e.g. lazy_loader.load("scipy"), may never
+            # happen, so they are optional.
+            arg = node.args[0]
+            if isinstance(arg, ast.Constant) and isinstance(arg.value, str):
+                module = self._module(arg.value, node)
+                module["optional"] = True
+                self.modules.append(module)
+        self.generic_visit(node)
+
+    def _visit_guarded(self, nodes, conditions):
+        saved = self.conditions
+        if conditions is not None:
+            self.conditions = saved + conditions
+        for node in nodes:
+            self.visit(node)
+        self.conditions = saved
+
+    def _visit_alternative(self, nodes, conditions, alternative):
+        saved = self.alternative
+        # The imports of an other branch remain so in the nested statements.
+        if saved != "other":
+            self.alternative = alternative
+        self._visit_guarded(nodes, conditions)
+        self.alternative = saved
+
+    def visit_Try(self, node):
+        # The imports of the body of `try: ... except ImportError: ...` may be
+        # missing, while the ones of the handlers are the fallbacks.
+        saved = self.optional
+        if any(handles_import_error(handler) for handler in node.handlers):
+            self.optional = True
+        for subnode in node.body:
+            self.visit(subnode)
+        self.optional = saved
+        for subnode in node.handlers + node.orelse + node.finalbody:
+            self.visit(subnode)
+
+    def visit_If(self, node):
+        conditions = parse_condition(node.test)
+        if dotted_name(node.test) in TYPE_CHECKING_NAMES:
+            saved = self.type_checking
+            self.type_checking = True
+            self._visit_guarded(node.body, conditions)
+            self.type_checking = saved
+            self._visit_guarded(node.orelse, negate_conditions(conditions))
+            return
+        if conditions is None and node.orelse:
+            self._visit_alternative(node.body, conditions, "first")
+            self._visit_alternative(node.orelse, conditions, "other")
+            return
+        self._visit_guarded(node.body, conditions)
+        self._visit_guarded(node.orelse, negate_conditions(conditions))
+
+
+IMPORT_ERRORS = {"ImportError", "ModuleNotFoundError"}
+TYPE_CHECKING_NAMES = {"TYPE_CHECKING", "typing.TYPE_CHECKING"}
+
+
+class NameUsageVisitor(ast.NodeVisitor):
+    # Collects the names loaded in the annotations, e.g. `def f(x: Thing)`,
+    # separately from the ones loaded by the runtime code.
+    def __init__(self):
+        self.annotation_names = set()
+        self.runtime_names = set()
+        self.in_annotation = False
+
+    def _visit_annotation(self, node):
+        if node is None:
+            return
+        saved = self.in_annotation
+        self.in_annotation = True
+        self.visit(node)
+        self.in_annotation = saved
+
+    def visit_arg(self, node):
+        self._visit_annotation(node.annotation)
+
+    def visit_FunctionDef(self, node):
+        for decorator in node.decorator_list:
+            self.visit(decorator)
+        self.visit(node.args)
+        self._visit_annotation(node.returns)
+        for stmt in node.body:
+            self.visit(stmt)
+
+    visit_AsyncFunctionDef = visit_FunctionDef
+
+    def visit_AnnAssign(self, node):
+        self._visit_annotation(node.annotation)
+        self.visit(node.target)
+        if node.value is not None:
+            self.visit(node.value)
+
+    def visit_Name(self, node):
+        if isinstance(node.ctx, ast.Load):
+            if self.in_annotation:
+                self.annotation_names.add(node.id)
+            else:
+                self.runtime_names.add(node.id)
+
+
+def has_future_annotations(tree):
+    return any(
+        isinstance(stmt, ast.ImportFrom)
+        and stmt.module == "__future__"
+        and any(alias.name == "annotations" for alias in stmt.names)
+        for stmt in tree.body
+    )
+
+
+def handles_import_error(handler):
+    # Bare `except:` and `except Exception:` handle ImportError too, but are
+    # too broad to tell that the imports are meant to be optional.
+    if handler.type is None:
+        return False
+    types = handler.type.elts if isinstance(handler.type, ast.Tuple) else [handler.type]
+    return any(dotted_name(t) in IMPORT_ERRORS for t in types)
+
+
+def parse_dynamic_import(node):
+    # Returns the module name imported dynamically with the given argument and
+    # the confidence in it: "high" for a string literal, e.g. "pkg.mod", and
+    # "medium" for the package of an f-string with a literal prefix, e.g.
+    # f"pkg.{name}". Other arguments, e.g. variables, are ignored.
+    if isinstance(node, ast.Constant) and isinstance(node.value, str):
+        name, confidence = node.value, "high"
+    elif (
+        isinstance(node, ast.JoinedStr)
+        and node.values
+        and isinstance(node.values[0], ast.Constant)
+        and isinstance(node.values[0].value, str)
+    ):
+        prefix = node.values[0].value
+        name, confidence = prefix[: max(prefix.rfind("."), 0)], "medium"
+    else:
+        return None, None
+    if not name or not all(part.isidentifier() for part in name.split(".")):
+        return None, None
+    return name, confidence
+
+
+def parse_import_statements(content, filepath, lazy_import_helpers):
     tree = ast.parse(content)
+    visitor = ImportStatementsVisitor(filepath, lazy_import_helpers)
+    visitor.visit(tree)
+    # With `from __future__ import annotations`, the annotations aren't
+    # evaluated, so the imports only used in them are only needed for
+    # type-checking.
+    if has_future_annotations(tree):
+        usage = NameUsageVisitor()
+        usage.visit(tree)
+        for module, names in visitor.bindings:
+            if all(
+                name in usage.annotation_names and name not in usage.runtime_names
+                for name in names
+            ):
+                module["type_only"] = True
+    return visitor.modules
+
+
+# The importlib.resources functions that take a package as their first
+# argument.
+RESOURCES_FUNCTIONS = {
+    "contents",
+    "files",
+    "is_resource",
+    "open_binary",
+    "open_text",
+    "path",
+    "read_binary",
+    "read_text",
+}
+RESOURCES_MODULES = {"importlib.resources", "importlib_resources"}
+
+
+def dotted_name(node):
+    if isinstance(node, ast.Name):
+        return node.id
+    if isinstance(node, ast.Attribute):
+        value = dotted_name(node.value)
+        if value is not None:
+            return "{}.{}".format(value, node.attr)
+    return None
+
+
+def parse_resources(content, filepath):
+    # Collects the packages accessed as resources via importlib.resources with
+    # a string literal, e.g. files("pkg").joinpath("schema.json").
+    tree = ast.parse(content)
+    resources_modules = set(RESOURCES_MODULES)
+    resources_functions = set()
     for node in ast.walk(tree):
         if isinstance(node, ast.Import):
             for subnode in node.names:
-                module = {
-                    "name": subnode.name,
-                    "lineno": node.lineno,
-                    "filepath": filepath,
-                }
-                modules.append(module)
+                if subnode.name in RESOURCES_MODULES and subnode.asname:
+                    resources_modules.add(subnode.asname)
         elif isinstance(node, ast.ImportFrom) and node.level == 0:
-            module = {
-                "name": node.module,
+            for subnode in node.names:
+                local_name = subnode.asname or subnode.name
+                if node.module in RESOURCES_MODULES:
+                    if subnode.name in RESOURCES_FUNCTIONS:
+                        resources_functions.add(local_name)
+                elif "{}.{}".format(node.module, subnode.name) in RESOURCES_MODULES:
+                    resources_modules.add(local_name)
+    resources = list()
+    for node in ast.walk(tree):
+        if not isinstance(node, ast.Call) or not node.args:
+            continue
+        func = node.func
+        if isinstance(func, ast.Name):
+            if func.id not in resources_functions:
+                continue
+        elif isinstance(func, ast.Attribute):
+            if func.attr not in RESOURCES_FUNCTIONS:
+                continue
+            if dotted_name(func.value) not in resources_modules:
+                continue
+        else:
+            continue
+        package = node.args[0]
+        if not isinstance(package, ast.Constant) or not isinstance(package.value, str):
+            continue
+        resources.append(
+            {
+                "name": package.value,
                 "lineno": node.lineno,
                 "filepath": filepath,
             }
-            modules.append(module)
+        )
+    return resources
+
+
+def is_pkgutil_namespace_package(content):
+    # Detects the pkgutil-style namespace package idiom, e.g.:
+    #   __path__ = __import__("pkgutil").extend_path(__path__, __name__)
+    tree = ast.parse(content)
+    for node in tree.body:
+        if not isinstance(node, ast.Assign):
+            continue
+        if not any(
+            isinstance(target, ast.Name) and target.id == "__path__"
+            for target in node.targets
+        ):
+            continue
+        value = node.value
+        if (
+            isinstance(value, ast.Call)
+            and isinstance(value.func, ast.Attribute)
+            and value.func.attr == "extend_path"
+        ):
+            return True
+    return False
+
+
+def parse_reexported_names(content):
+    # Collects the names a package re-exports from its __init__.py, i.e. listed
+    # in its __all__ or bound by its module-level imports, e.g.:
+    #   from .impl import Thing
+    #   __all__ = ["Thing"]
+    tree = ast.parse(content)
+    names = set()
+    for node in tree.body:
+        if isinstance(node, ast.ImportFrom):
+            names.update(
+                alias.asname or alias.name for alias in node.names if alias.name != "*"
+            )
+        elif isinstance(node, ast.Import):
+            names.update(
+                alias.asname or alias.name.split(".")[0] for alias in node.names
+            )
+        elif isinstance(node, (ast.Assign, ast.AugAssign)):
+            targets = node.targets if isinstance(node, ast.Assign) else [node.target]
+            if not any(
+                isinstance(target, ast.Name) and target.id == "__all__"
+                for target in targets
+            ):
+                continue
+            if isinstance(node.value, (ast.List, ast.Tuple)):
+                names.update(
+                    elt.value
+                    for elt in node.value.elts
+                    if isinstance(elt, ast.Constant) and isinstance(elt.value, str)
+                )
+    return sorted(names)
+
+
+# The functions iterating over the submodules of a package.
+ITER_MODULES_FUNCTIONS = {
+    "iter_modules",
+    "pkgutil.iter_modules",
+    "pkgutil.walk_packages",
+    "walk_packages",
+}
+# The functions, or methods, globbing the filenames of a directory.
+GLOB_FUNCTIONS = {"glob", "iglob"}
+# The functions importing a module by name.
+IMPORT_MODULE_FUNCTIONS = {"__import__", "import_module", "importlib.import_module"}
+
+
+def iterates_over_submodules(call):
+    # Returns whether the call iterates over the submodules of the package,
+    # either from its __path__ or by globbing the Python filenames, e.g.
+    # glob.glob(os.path.join(os.path.dirname(__file__), "*.py")) or
+    # Path(__file__).parent.glob("*.py").
+    if dotted_name(call.func) in ITER_MODULES_FUNCTIONS:
+        return any(
+            isinstance(arg, ast.Name) and arg.id == "__path__" for arg in call.args
+        )
+    if isinstance(call.func, ast.Attribute):
+        name = call.func.attr
+    elif isinstance(call.func, ast.Name):
+        name = call.func.id
+    else:
+        return False
+    if name not in GLOB_FUNCTIONS:
+        return False
+    return any(
+        isinstance(subnode, ast.Constant)
+        and isinstance(subnode.value, str)
+        and subnode.value.endswith("*.py")
+        for arg in call.args
+        for subnode in ast.walk(arg)
+    )
+
+
+def parse_auto_import_all(content):
+    # Returns the line number of the loop importing all the submodules of the
+    # package, or 0 if there is none, e.g.:
+    #   for mod in pkgutil.iter_modules(__path__):
+    #       importlib.import_module(f".{mod.name}", __name__)
+    tree = ast.parse(content)
+    for node in ast.walk(tree):
+        if not isinstance(node, ast.For) or not isinstance(node.iter, ast.Call):
+            continue
+        if not iterates_over_submodules(node.iter):
+            continue
+        for body_node in node.body:
+            for subnode in ast.walk(body_node):
+                if (
+                    isinstance(subnode, ast.Call)
+                    and dotted_name(subnode.func) in IMPORT_MODULE_FUNCTIONS
+                ):
+                    return node.lineno
+    return 0
+
+
+def parse_lazy_submodules(content, filepath, registry):
+    # Collects the modules lazily imported by a module-level __getattr__ from a
+    # registry attribute mapping names to modules, e.g.:
+    #   _submodules = {"heavy": "pkg.heavy"}
+    #   def __getattr__(name):
+    #       return importlib.import_module(_submodules[name])
+    modules = list()
+    if not registry:
+        return modules
+    tree = ast.parse(content)
+    has_getattr = any(
+        isinstance(node, (ast.FunctionDef, ast.AsyncFunctionDef))
+        and node.name == "__getattr__"
+        for node in tree.body
+    )
+    if not has_getattr:
+        return modules
+    for node in tree.body:
+        if isinstance(node, ast.Assign):
+            targets = node.targets
+        elif isinstance(node, ast.AnnAssign) and node.value is not None:
+            targets = [node.target]
+        else:
+            continue
+        if not any(
+            isinstance(target, ast.Name) and target.id == registry
+            for target in targets
+        ):
+            continue
+        if not isinstance(node.value, ast.Dict):
+            continue
+        for value in node.value.values:
+            if (
+                isinstance(value, ast.Constant)
+                and isinstance(value.value, str)
+                and value.value
+                and not value.value.startswith(".")
+            ):
+                modules.append(
+                    {
+                        "name": value.value,
+                        "lineno": value.lineno,
+                        "filepath": filepath,
+                    }
+                )
     return modules
 
 
+def parse_injected_globals(content, filepath, injected_globals):
+    # Collects the references to the globals injected at runtime, e.g. by a
+    # framework, i.e. the given names used but never bound in the module.
+    references = list()
+    if not injected_globals:
+        return references
+    tree = ast.parse(content)
+    bound = set()
+    loads = list()
+    for node in ast.walk(tree):
+        if isinstance(node, ast.Name):
+            if isinstance(node.ctx, ast.Load):
+                loads.append(node)
+            else:
+                bound.add(node.id)
+        elif isinstance(node, (ast.FunctionDef, ast.AsyncFunctionDef, ast.ClassDef)):
+            bound.add(node.name)
+        elif isinstance(node, ast.arg):
+            bound.add(node.arg)
+        elif isinstance(node, ast.alias):
+            bound.add(node.asname or node.name.split(".")[0])
+        elif isinstance(node, ast.ExceptHandler) and node.name:
+            bound.add(node.name)
+    for node in loads:
+        if node.id in injected_globals and node.id not in bound:
+            references.append(
+                {
+                    "name": node.id,
+                    "lineno": node.lineno,
+                    "filepath": filepath,
+                }
+            )
+    return references
+
+
 def parse_comments(content):
     comments = list()
     g = tokenize(BytesIO(content.encode("utf-8")).readline)
@@ -42,20 +674,51 @@ def parse_comments(content):
     return comments
 
 
-def parse(repo_root, rel_package_path, filename):
+def parse(
+    repo_root,
+    rel_package_path,
+    filename,
+    lazy_submodules_registry,
+    injected_globals,
+    lazy_import_helpers,
+):
     rel_filepath = os.path.join(rel_package_path, filename)
     abs_filepath = os.path.join(repo_root, rel_filepath)
     with open(abs_filepath, "r") as file:
         content = file.read()
        # From simple benchmarks, 2 workers gave the best performance here.
         with concurrent.futures.ThreadPoolExecutor(max_workers=2) as executor:
-            modules_future = executor.submit(parse_import_statements, content, rel_filepath)
+            modules_future = executor.submit(
+                parse_import_statements, content, rel_filepath, lazy_import_helpers
+            )
             comments_future = executor.submit(parse_comments, content)
         modules = modules_future.result()
+        modules.extend(
+            parse_lazy_submodules(content, rel_filepath, lazy_submodules_registry)
+        )
         comments = comments_future.result()
         output = {
+            "filename": filename,
             "modules": modules,
             "comments": comments,
+            "resources": parse_resources(content, rel_filepath),
+            "injected_globals": parse_injected_globals(
+                content, rel_filepath, injected_globals
+            ),
+            "pkgutil_namespace_package": (
+                os.path.basename(filename) == "__init__.py"
+                and is_pkgutil_namespace_package(content)
+            ),
+            "auto_import_all": (
+                parse_auto_import_all(content)
+                if os.path.basename(filename) == "__init__.py"
+                else 0
+            ),
+            "reexported_names": (
+                parse_reexported_names(content)
+                if os.path.basename(filename) == "__init__.py"
+                else []
+            ),
         }
         return output
 
@@ -67,12 +730,32 @@ def main(stdin, stdout):
             repo_root = parse_request["repo_root"]
             rel_package_path = parse_request["rel_package_path"]
             filenames = parse_request["filenames"]
+            lazy_submodules_registry = parse_request["lazy_submodules_registry"]
+            injected_globals = set(parse_request["injected_globals"])
+            lazy_import_helpers = frozenset(parse_request["lazy_import_helpers"])
             outputs = list()
             if len(filenames) == 1:
-                outputs.append(parse(repo_root, rel_package_path, filenames[0]))
+                outputs.append(
+                    parse(
+                        repo_root,
+                        rel_package_path,
+                        filenames[0],
+                        lazy_submodules_registry,
+                        injected_globals,
+                        lazy_import_helpers,
+                    )
+                )
             else:
                 futures = [
-                    executor.submit(parse, repo_root, rel_package_path, filename)
+                    executor.submit(
+                        parse,
+                        repo_root,
+                        rel_package_path,
+                        filename,
+                        lazy_submodules_registry,
+                        injected_globals,
+                        lazy_import_helpers,
+                    )
                     for filename in filenames
                     if filename != ""
                 ]
@@ -9,6 +9,7 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
@@ -75,6 +76,17 @@ type python3Parser struct {
 	// The function that determines if a dependency is ignored from a Gazelle
 	// directive. It's the signature of pythonconfig.Config.IgnoresDependency.
 	ignoresDependency func(dep string) bool
+	// The name of the module attribute mapping names to lazily imported
+	// modules by a module-level __getattr__. It's the value of
+	// pythonconfig.Config.LazySubmodulesRegistry.
+	lazySubmodulesRegistry string
+	// The names of the globals injected at runtime whose references are
+	// extracted. It's the value of pythonconfig.Config.InjectedGlobals.
+	injectedGlobals []string
+	// The lazy-import helper functions whose calls with a literal module name
+	// are extracted as optional imports. It's the value of
+	// pythonconfig.Config.LazyImportHelpers.
+	lazyImportHelpers []string
 }
 
 // newPython3Parser constructs a new python3Parser.
@@ -82,17 +94,23 @@ func newPython3Parser(
 	repoRoot string,
 	relPackagePath string,
 	ignoresDependency func(dep string) bool,
+	lazySubmodulesRegistry string,
+	injectedGlobals []string,
+	lazyImportHelpers []string,
 ) *python3Parser {
 	return &python3Parser{
-		repoRoot:          repoRoot,
-		relPackagePath:    relPackagePath,
-		ignoresDependency: ignoresDependency,
+		repoRoot:               repoRoot,
+		relPackagePath:         relPackagePath,
+		ignoresDependency:      ignoresDependency,
+		lazySubmodulesRegistry: lazySubmodulesRegistry,
+		injectedGlobals:        injectedGlobals,
+		lazyImportHelpers:      lazyImportHelpers,
 	}
 }
 
 // parseSingle parses a single Python file and returns the extracted modules
 // from the import statements as well as the parsed comments.
-func (p *python3Parser) parseSingle(pyFilename string) (*treeset.Set, error) {
+func (p *python3Parser) parseSingle(pyFilename string) (*parseResult, error) {
 	pyFilenames := treeset.NewWith(godsutils.StringComparator)
 	pyFilenames.Add(pyFilename)
 	return p.parse(pyFilenames)
@@ -100,16 +118,26 @@ func (p *python3Parser) parseSingle(pyFilename string) (*treeset.Set, error) {
 
 // parse parses multiple Python files and returns the extracted modules from
 // the import statements as well as the parsed comments.
-func (p *python3Parser) parse(pyFilenames *treeset.Set) (*treeset.Set, error) {
+func (p *python3Parser) parse(pyFilenames *treeset.Set) (*parseResult, error) {
 	parserMutex.Lock()
 	defer parserMutex.Unlock()
 
 	modules := treeset.NewWith(moduleComparator)
+	resources := treeset.NewWith(moduleComparator)
+	injectedGlobals := treeset.NewWith(moduleComparator)
+	pkgutilNamespacePackages := treeset.NewWith(godsutils.StringComparator)
+	autoImportAllPackages := make(map[string]uint32)
+	reexportedNames := make(map[string][]string)
+	fileRoots := make(map[string]string)
 
 	req := map[string]interface{}{
 		"repo_root":        p.repoRoot,
 		"rel_package_path": p.relPackagePath,
 		"filenames":        pyFilenames.Values(),
+
+		"lazy_submodules_registry": p.lazySubmodulesRegistry,
+		"injected_globals":         p.injectedGlobals,
+		"lazy_import_helpers":      p.lazyImportHelpers,
 	}
 	encoder := json.NewEncoder(parserStdin)
 	if err := encoder.Encode(&req); err != nil {
@@ -128,8 +156,28 @@ func (p *python3Parser) parse(pyFilenames *treeset.Set) (*treeset.Set, error) {
 	}
 
 	for _, res := range allRes {
+		if res.PkgutilNamespacePackage {
+			pkgutilNamespacePackages.Add(res.Filename)
+		}
+		if res.AutoImportAll != 0 {
+			autoImportAllPackages[res.Filename] = res.AutoImportAll
+		}
+		if len(res.ReexportedNames) > 0 {
+			reexportedNames[res.Filename] = res.ReexportedNames
+		}
+
 		annotations := annotationsFromComments(res.Comments)
 
+		if annotations.fileRoot != nil {
+			path := filepath.Join(p.relPackagePath, res.Filename)
+			root := *annotations.fileRoot
+			if root != "" && !strings.HasPrefix(filepath.Dir(path)+"/", root+"/") {
+				return nil, fmt.Errorf("failed to parse: the %q annotation in %q must be a parent directory of the file: %q",
+					annotationKindPythonFileRoot, path, root)
+			}
+			fileRoots[path] = root
+		}
+
 		for _, m := range res.Modules {
 			// Check for ignored dependencies set via an annotation to the Python
 			// module.
@@ -143,21 +191,91 @@ func (p *python3Parser) parse(pyFilenames *treeset.Set) (*treeset.Set, error) {
 				continue
 			}
 
-			modules.Add(m)
+			addModule(modules, m)
+		}
+
+		for _, m := range res.Resources {
+			if annotations.ignores(m.Name) || p.ignoresDependency(m.Name) {
+				continue
+			}
+
+			resources.Add(m)
+		}
+
+		for _, m := range res.InjectedGlobals {
+			if annotations.ignores(m.Name) {
+				continue
+			}
+
+			injectedGlobals.Add(m)
 		}
 	}
 
-	return modules, nil
+	return &parseResult{
+		modules:                  modules,
+		resources:                resources,
+		injectedGlobals:          injectedGlobals,
+		pkgutilNamespacePackages: pkgutilNamespacePackages,
+		autoImportAllPackages:    autoImportAllPackages,
+		reexportedNames:          reexportedNames,
+		fileRoots:                fileRoots,
+	}, nil
+}
+
+// parseResult represents the aggregated result of parsing a set of Python
+// files.
+type parseResult struct {
+	// The modules extracted from the import statements.
+	modules *treeset.Set
+	// The packages accessed as resources via importlib.resources, e.g.
+	// `files("pkg").joinpath("schema.json")`.
+	resources *treeset.Set
+	// The references to the globals injected at runtime, named after the
+	// globals.
+	injectedGlobals *treeset.Set
+	// The parsed filenames that are __init__.py files extending their __path__
+	// with pkgutil, i.e. pkgutil-style namespace packages.
+	pkgutilNamespacePackages *treeset.Set
+	// The parsed filenames that are __init__.py files importing all the
+	// submodules of their package in a loop, mapped to the line number of the
+	// loop.
+	autoImportAllPackages map[string]uint32
+	// The names re-exported by the parsed __init__.py files, keyed by their
+	// filenames.
+	reexportedNames map[string][]string
+	// The Python roots overridden by the python_file_root annotation, keyed by
+	// the file path relative to the Bazel workspace root.
+	fileRoots map[string]string
 }
 
 // parserResponse represents a response returned by the parser.py for a given
 // parsed Python module.
 type parserResponse struct {
+	// The parsed filename, as requested to the parser.
+	Filename string `json:"filename"`
 	// The modules depended by the parsed module.
 	Modules []module `json:"modules"`
 	// The comments contained in the parsed module. This contains the
 	// annotations as they are comments in the Python module.
 	Comments []comment `json:"comments"`
+	// The packages accessed as resources via importlib.resources. The data
+	// provided by these packages is depended by the parsed module.
+	Resources []module `json:"resources"`
+	// The references to the globals injected at runtime, i.e. the configured
+	// names used but never bound by the parsed module.
+	InjectedGlobals []module `json:"injected_globals"`
+	// Whether the parsed module is an __init__.py that makes its package a
+	// pkgutil-style namespace package, e.g.
+	// `__path__ = __import__("pkgutil").extend_path(__path__, __name__)`.
+	PkgutilNamespacePackage bool `json:"pkgutil_namespace_package"`
+	// The line number of the loop importing all the submodules of the package
+	// if the parsed module is an __init__.py doing so, e.g.
+	// `for mod in pkgutil.iter_modules(__path__): importlib.import_module(...)`,
+	// or zero otherwise.
+	AutoImportAll uint32 `json:"auto_import_all"`
+	// The names re-exported by the parsed module if it's an __init__.py, i.e.
+	// listed in its `__all__` or bound by its module-level imports.
+	ReexportedNames []string `json:"reexported_names"`
 }
 
 // module represents a fully-qualified, dot-separated, Python module as seen on
@@ -170,6 +288,104 @@ type module struct {
 	LineNumber uint32 `json:"lineno"`
 	// The path to the module file relative to the Bazel workspace root.
 	Filepath string `json:"filepath"`
+	// The conditions that must all hold for the import to happen, extracted
+	// from the enclosing if statements, e.g. `if sys.version_info >= (3, 11):`.
+	Conditions []condition `json:"conditions"`
+	// Whether the module was star imported, i.e. `from pkg import *`.
+	StarImport bool `json:"star"`
+	// The branch of the enclosing if/else statement, with a condition that
+	// isn't understood, importing the module, i.e. alternativeFirst or
+	// alternativeOther. The imports of the branches are alternatives, e.g.
+	// `if cond: import a else: import b`. Empty if the import isn't an
+	// alternative.
+	Alternative string `json:"alternative"`
+	// The confidence in the module name of a dynamic import, i.e.
+	// confidenceHigh or confidenceMedium, e.g.
+	// `importlib.import_module("pkg.mod")`. Empty for the import statements.
+	Confidence string `json:"confidence"`
+	// The names imported from the module by the `from pkg import name`
+	// statements, along with their location.
+	Names []importedName `json:"names"`
+	// Whether the import is guarded by a try statement handling ImportError,
+	// e.g. `try: import ujson as json except ImportError: import json`.
+	Optional bool `json:"optional"`
+	// Whether the import only happens for type-checking, i.e. it's guarded by
+	// `if TYPE_CHECKING:` or, with `from __future__ import annotations`, the
+	// names it binds are only used in annotations.
+	TypeOnly bool `json:"type_only"`
+	// The original name of a relative import, e.g. `..pkg`, once resolved to
+	// the absolute Name, e.g. `app.pkg`. Empty for the absolute imports.
+	RelativeName string `json:"-"`
+}
+
+// importedName represents a name imported from a module, e.g. `Mapping` in
+// `from collections import Mapping`.
+type importedName struct {
+	Name string `json:"name"`
+	// The line number where the import happened.
+	LineNumber uint32 `json:"lineno"`
+	// The path to the module file relative to the Bazel workspace root.
+	Filepath string `json:"filepath"`
+}
+
+const (
+	// alternativeFirst marks the imports from the first branch of an if/else
+	// statement.
+	alternativeFirst = "first"
+	// alternativeOther marks the imports from the elif and else branches of an
+	// if/else statement.
+	alternativeOther = "other"
+)
+
+const (
+	// confidenceHigh marks the dynamic imports of a string literal, e.g.
+	// `importlib.import_module("pkg.mod")`.
+	confidenceHigh = "high"
+	// confidenceMedium marks the dynamic imports of the package of an f-string
+	// with a literal prefix, e.g. `importlib.import_module(f"pkg.{name}")`.
+	confidenceMedium = "medium"
+)
+
+// addModule adds the module to the set. A module imported under different
+// conditions, e.g. from both branches of an if statement, becomes
+// unconditional. A module star imported at least once remains star imported.
+// A module imported from different branches, or outside of them, isn't an
+// alternative.
+// A module imported both statically and dynamically is a static import.
+func addModule(modules *treeset.Set, m module) {
+	if modules.Contains(m) {
+		_, found := modules.Find(func(_ int, value interface{}) bool {
+			return value.(module).Name == m.Name
+		})
+		if !equalConditions(found.(module).Conditions, m.Conditions) {
+			m.Conditions = nil
+		}
+		m.StarImport = m.StarImport || found.(module).StarImport
+		if found.(module).Alternative != m.Alternative {
+			m.Alternative = ""
+		}
+		if found.(module).Confidence == "" || m.Confidence == "" {
+			m.Confidence = ""
+		} else if found.(module).Confidence == confidenceHigh {
+			m.Confidence = confidenceHigh
+		}
+		m.Names = append(append([]importedName{}, found.(module).Names...), m.Names...)
+		m.Optional = m.Optional && found.(module).Optional
+		m.TypeOnly = m.TypeOnly && found.(module).TypeOnly
+	}
+	modules.Add(m)
+}
+
+func equalConditions(a, b []condition) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
 }
 
 // moduleComparator compares modules by name.
@@ -185,6 +401,10 @@ const (
 	annotationPrefix string = "gazelle:"
 	// The ignore annotation kind. E.g. '# gazelle:ignore <module_name>'.
 	annotationKindIgnore annotationKind = "ignore"
+	// The file root annotation kind. It overrides the Python root, relative to
+	// the Bazel workspace root, of a single file. E.g.
+	// '# gazelle:python_file_root src'.
+	annotationKindPythonFileRoot annotationKind = "python_file_root"
 )
 
 // comment represents a Python comment.
@@ -217,12 +437,16 @@ type annotation struct {
 type annotations struct {
 	// The parsed modules to be ignored by Gazelle.
 	ignore map[string]struct{}
+	// The Python root overriding the project root for the parsed module, or
+	// nil if not overridden.
+	fileRoot *string
 }
 
 // annotationsFromComments returns all the annotations parsed out of the
 // comments of a Python module.
 func annotationsFromComments(comments []comment) *annotations {
 	ignore := make(map[string]struct{})
+	var fileRoot *string
 	for _, comment := range comments {
 		annotation := comment.asAnnotation()
 		if annotation != nil {
@@ -235,11 +459,18 @@ func annotationsFromComments(comments []comment) *annotations {
 					m = strings.TrimSpace(m)
 					ignore[m] = struct{}{}
 				}
+			} else if annotation.kind == annotationKindPythonFileRoot {
+				root := filepath.Clean(strings.TrimSpace(annotation.value))
+				if root == "." {
+					root = ""
+				}
+				fileRoot = &root
 			}
 		}
 	}
 	return &annotations{
-		ignore: ignore,
+		ignore:   ignore,
+		fileRoot: fileRoot,
 	}
 }
 
@@ -156,6 +156,10 @@ func testPath(t *testing.T, name string, files []bazel.RunfileEntry) {
 		cmd.Stdout = &stdout
 		cmd.Stderr = &stderr
 		cmd.Dir = workspaceRoot
+		cmd.Env = os.Environ()
+		for key, value := range config.Env {
+			cmd.Env = append(cmd.Env, key+"="+value)
+		}
 		if err := cmd.Run(); err != nil {
 			var e *exec.ExitError
 			if !errors.As(err, &e) {
@@ -203,6 +207,8 @@ func mustFindGazelle() string {
 }
 
 type testYAML struct {
+	// Env is the environment variables set for Gazelle, e.g. to enable a mode.
+	Env    map[string]string `json:"env"`
 	Expect struct {
 		ExitCode int    `json:"exit_code"`
 		Stdout   string `json:"stdout"`
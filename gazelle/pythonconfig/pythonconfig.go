@@ -3,6 +3,8 @@ package pythonconfig
 import (
 	"fmt"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/emirpasic/gods/lists/singlylinkedlist"
@@ -49,6 +51,342 @@ const (
 	// naming convention. See python_library_naming_convention for more info on
 	// the package name interpolation.
 	TestNamingConvention = "python_test_naming_convention"
+	// IndexExportedOnlyDirective represents the directive that controls
+	// whether only the public modules are indexed as importable. Modules
+	// containing a component prefixed with an underscore (e.g. `pkg._impl`)
+	// are considered private.
+	IndexExportedOnlyDirective = "python_index_exported_only"
+	// LazySubmodulesRegistryDirective represents the directive that sets the
+	// name of the module attribute mapping names to modules lazily imported by
+	// a module-level __getattr__. The mapped modules are added as
+	// dependencies. An empty value disables the detection.
+	LazySubmodulesRegistryDirective = "python_lazy_submodules_registry"
+	// PythonVersionDirective represents the directive that sets the Python
+	// version, in the `major.minor` form, targeted by a Bazel package. Imports
+	// guarded by `sys.version_info` comparisons that don't hold for this version
+	// are not added as dependencies. Sub-packages inherit this value.
+	PythonVersionDirective = "python_version"
+	// TestHelpersDirective represents the directive that sets the glob
+	// patterns, comma-separated, of the test helper files (e.g. conftest.py or
+	// _fixtures.py) embedded into the py_test target of the same Bazel package
+	// instead of the py_library. An empty value disables the embedding.
+	TestHelpersDirective = "python_test_helpers"
+	// PublicImportsDirective represents the directive that declares the public
+	// API surface, as comma-separated modules, of the targets in a Bazel
+	// package. The other modules of these targets aren't importable from other
+	// Bazel packages. Sub-packages don't inherit this value.
+	PublicImportsDirective = "python_public_imports"
+	// ResolveWithRemoteCacheDirective represents the directive that controls
+	// whether the imports that can't be resolved locally are looked up as
+	// external repositories in Gazelle's RemoteCache. The lookups may access
+	// the network. Can be "true" or "false". Defaults to "false".
+	ResolveWithRemoteCacheDirective = "python_resolve_with_remote_cache"
+	// ResolveStarImportsDirective represents the directive that controls
+	// whether a star import of a package, i.e. `from pkg import *`, resolves
+	// to all the targets providing modules under the package, e.g. for
+	// dynamically discovered plugins. An __init__.py importing all the
+	// submodules of its package in a loop over pkgutil.iter_modules(__path__),
+	// or over the Python filenames globbed from its directory, is resolved as
+	// a star import of the package. Can be "true" or "false". Defaults to
+	// "false".
+	ResolveStarImportsDirective = "python_resolve_star_imports"
+	// LibraryEntrypointFilenameDirective represents the directive that sets an
+	// additional filename marking a directory as a Python package, in the same
+	// way as __init__.py. The file is indexed as the package itself.
+	LibraryEntrypointFilenameDirective = "python_library_entrypoint_filename"
+	// ResolveOverridesDirDirective represents the directive that sets a
+	// directory, relative to the workspace root, containing YAML files that
+	// map imports to Bazel labels, in the same way as the resolve directive.
+	// Sub-packages inherit this value.
+	ResolveOverridesDirDirective = "python_resolve_overrides_dir"
+	// DistributionNameOverrideDirective represents the directive that
+	// overrides the name of a distribution as used in the labels of the pip
+	// repositories, e.g. to preserve its original case. The value is the
+	// distribution name followed by the name to use. Distributions without an
+	// override are normalized according to PEP 503. Sub-packages inherit this
+	// value.
+	DistributionNameOverrideDirective = "python_distribution_name_override"
+	// InjectedGlobalsDirective represents the directive that maps, as
+	// comma-separated `name=label` pairs, the globals injected at runtime,
+	// e.g. by a framework, to the targets providing them. The modules using
+	// one of these names without binding it depend on the target. Sub-packages
+	// inherit this value.
+	InjectedGlobalsDirective = "python_injected_globals"
+	// ThirdPartyPrefixDirective represents the directive that declares the
+	// first-party facade namespaces, comma-separated, exposing the third-party
+	// modules, e.g. `company.third_party`. The modules under these namespaces
+	// resolve as the third-party modules without the prefix. Sub-packages
+	// inherit this value.
+	ThirdPartyPrefixDirective = "python_third_party_prefix"
+	// VersionPipRepositoryDirective represents the directive that maps a
+	// Python version, in the `major.minor` form, to the name of the pip
+	// repository installing the distributions for this version, e.g.
+	// `3.11 pip_311`. The third-party modules of the Bazel packages targeting
+	// this version, as set by the python_version directive, resolve to this
+	// repository instead of the one from the manifest. Sub-packages inherit
+	// this value.
+	VersionPipRepositoryDirective = "python_version_pip_repository"
+	// ShebangScriptsDirective represents the directive that controls whether
+	// the extensionless executable scripts with a Python shebang, e.g.
+	// `#!/usr/bin/env python3`, generate a py_binary target each. Can be
+	// "true" or "false". Defaults to "false".
+	ShebangScriptsDirective = "python_shebang_scripts"
+	// DeprioritizedTagDirective represents the directive that sets the tag
+	// marking the targets, e.g. generated ones, that lose against the other
+	// targets providing the same import. An empty value disables the
+	// deprioritization. Sub-packages inherit this value.
+	DeprioritizedTagDirective = "python_deprioritized_tag"
+	// FirstPartyNamespacesDirective represents the directive that declares the
+	// import namespaces, comma-separated, of the project itself. The modules
+	// under these namespaces always resolve to first-party targets, even if a
+	// distribution from the manifest provides them, e.g. an editable install
+	// of the project. Sub-packages inherit this value.
+	FirstPartyNamespacesDirective = "python_first_party_namespaces"
+	// ModuleNameTransformDirective represents the directive that adds a
+	// transform of the module names computed from the paths of the Python
+	// files, as a regular expression followed by its replacement, e.g.
+	// `^Models(\.|$) models${1}`. The transforms are applied in order to the
+	// indexed modules and the imports. Sub-packages inherit this value.
+	ModuleNameTransformDirective = "python_module_name_transform"
+	// ImplicitRelativeImportsDirective represents the directive that controls
+	// whether the imports that don't resolve absolutely are resolved as the
+	// siblings of the importing module, i.e. the implicit relative imports of
+	// Python 2. Can be "true" or "false". Defaults to "false".
+	ImplicitRelativeImportsDirective = "python_implicit_relative_imports"
+	// MaxDepsDirective represents the directive that sets the maximum number
+	// of dependencies of a target, followed by the action when a target
+	// exceeds it, either "warn" (the default) or "error", e.g. `100 error`.
+	// Zero disables the check. Sub-packages inherit this value.
+	MaxDepsDirective = "python_max_deps"
+	// CrossResolveLanguagesDirective represents the directive that sets the
+	// names, comma-separated, of the other Gazelle extensions indexing rules
+	// with Python imports. These rules are resolved as the ones generated by
+	// this extension. Sub-packages inherit this value.
+	CrossResolveLanguagesDirective = "python_cross_resolve_languages"
+	// RequirementLabelsFileDirective represents the directive that sets a YAML
+	// file, relative to the workspace root, mapping the requirements to the
+	// labels of the targets providing them, e.g. for custom hub layouts. The
+	// mapped labels take precedence over the ones derived from the pip
+	// repositories. Sub-packages inherit this value.
+	RequirementLabelsFileDirective = "python_requirement_labels_file"
+	// DepsAttributeDirective represents the directive that sets the attribute
+	// receiving the resolved dependencies of the rules of a kind, e.g.
+	// `py_binary runtime_deps`, for macros splitting their dependencies.
+	// Defaults to "deps". Sub-packages inherit this value.
+	DepsAttributeDirective = "python_deps_attribute"
+	// MovedModulesBaselineDirective represents the directive that sets a YAML
+	// file, relative to the workspace root, recording the SHA-256 hashes of
+	// the contents of the first-party modules at a baseline, keyed by module
+	// name. The imports of the modules that no longer resolve are reported
+	// with the targets now providing the same content, e.g. after a large
+	// move. This is report-only. Sub-packages inherit this value.
+	MovedModulesBaselineDirective = "python_moved_modules_baseline"
+	// ConditionalAlternativesDirective represents the directive that controls
+	// which imports of the branches of an if/else statement, with a condition
+	// that isn't understood, are resolved, e.g. `if cond: import a else:
+	// import b`. See below for the ConditionalAlternativesType constants.
+	// Defaults to "all". Sub-packages inherit this value.
+	ConditionalAlternativesDirective = "python_conditional_alternatives"
+	// DynamicImportsMinConfidenceDirective represents the directive that sets
+	// the minimum confidence in the module names of the dynamic imports, e.g.
+	// `importlib.import_module("pkg.mod")`, to resolve them. See below for
+	// the DynamicImportsConfidenceType constants. Defaults to "none".
+	// Sub-packages inherit this value.
+	DynamicImportsMinConfidenceDirective = "python_dynamic_imports_min_confidence"
+	// LabelConventionDirective represents the directive that selects the
+	// convention of the labels of the distributions installed by the pip
+	// repository. See below for the LabelConventionType constants. Defaults to
+	// the convention implied by the Gazelle manifest. Sub-packages inherit
+	// this value.
+	LabelConventionDirective = "python_label_convention"
+	// ResolveRelativeImportsDirective represents the directive that controls
+	// whether the relative imports, e.g. `from .sibling import name` in an
+	// __init__.py, resolve to the targets providing the imported modules.
+	// The relative imports of modules from the same target add no dependency.
+	// Can be "true" or "false". Defaults to "true".
+	ResolveRelativeImportsDirective = "python_resolve_relative_imports"
+	// BackportDirective represents the directive that maps the module of a
+	// backport of the standard library, e.g. `typing_extensions`, to the
+	// distribution providing it, in addition to the common backports. The
+	// backports are never resolved as part of the standard library, and
+	// resolve to their distributions when present in the Gazelle manifest.
+	// Sub-packages inherit this value.
+	BackportDirective = "python_backport"
+	// EnforcePrivateImportsDirective represents the directive that controls
+	// how the imports of the private first-party modules, i.e. with a
+	// component prefixed with an underscore such as `other._internal`, from
+	// outside of their defining package are reported. See below for the
+	// EnforcePrivateImportsType constants. Defaults to "off". Sub-packages
+	// inherit this value.
+	EnforcePrivateImportsDirective = "python_enforce_private_imports"
+	// StubsRootDirective represents the directive that sets the directory,
+	// relative to the workspace root, of the hand-written stubs, e.g.
+	// `typings`. The `.pyi` files under it are library sources providing the
+	// stubs of the modules named after their paths relative to this directory.
+	// The imports resolving to these stubs are added to the type-checking
+	// dependencies, i.e. the pyi_deps attribute, instead of deps. An empty
+	// value disables it. Sub-packages inherit this value.
+	StubsRootDirective = "python_stubs_root"
+	// PackageAliasDirective represents the directive that maps a top-level
+	// import alias to the directory, relative to the workspace root, of the
+	// package it names, e.g. `app services/app/src`. The modules under the
+	// directory are indexed under the alias, e.g. `app.models` for
+	// `services/app/src/models/__init__.py`, regardless of the Python root.
+	// Sub-packages inherit the mappings.
+	PackageAliasDirective = "python_package_alias"
+	// TestFixturesDirective represents the directive that marks the package,
+	// e.g. a `testing` package of fixtures shared across the tests, as test
+	// fixtures. Its targets only resolve as dependencies of the tests and of
+	// the other test fixtures, and importing them from any other target is
+	// reported as an error, so that their own dependencies, e.g. pytest, don't
+	// leak into the non-test targets. Can be "true" or "false". Defaults to
+	// "false". Sub-packages inherit this value.
+	TestFixturesDirective = "python_test_fixtures"
+	// FrozenModulesDirective represents the directive that lists the modules,
+	// separated by commas, frozen into the interpreter, e.g. by a custom
+	// interpreter embedding them. Like the standard library, they're always
+	// present, so they add no dependency and are never reported as invalid,
+	// along with their submodules. Sub-packages inherit the modules.
+	FrozenModulesDirective = "python_frozen_modules"
+	// ResolutionOrderDirective represents the directive that sets the order,
+	// separated by commas, in which the resolution strategies are tried for
+	// each import, e.g. `override,first_party,mapping,stdlib`. See below for
+	// the ResolutionStrategyType constants, which must all be listed once.
+	// Defaults to "override,mapping,first_party,stdlib". Sub-packages inherit
+	// this value.
+	ResolutionOrderDirective = "python_resolution_order"
+	// MigrationShimDirective represents the directive that declares a shim
+	// package, re-exporting from both the old and the new locations during a
+	// refactoring, along with its preferred backing target, e.g.
+	// `old.api //new/api`. The imports of the shim package, or of its
+	// submodules, resolving to first-party targets resolve to the preferred
+	// backing target instead, easing the eventual removal of the shim.
+	// Sub-packages inherit the shims.
+	MigrationShimDirective = "python_migration_shim"
+	// PipRepositoryForPathDirective represents the directive that maps the
+	// Bazel packages under a path prefix, relative to the workspace root, to
+	// the pip repository their third-party imports resolve to, e.g.
+	// `services/py311 pip_311`. The longest matching prefix wins, and takes
+	// precedence over the pip repository mapped to the Python version.
+	// Sub-packages inherit the mappings.
+	PipRepositoryForPathDirective = "python_pip_repository_for_path"
+	// DeprecatedStdlibAliasDirective represents the directive that declares a
+	// deprecated alias of the standard library along with its replacement,
+	// e.g. `collections.Mapping collections.abc.Mapping`, in addition to the
+	// common ones. The imports of the deprecated aliases are reported as
+	// warnings, without changing the resolution. An alias without replacement
+	// is no longer reported. Sub-packages inherit the aliases.
+	DeprecatedStdlibAliasDirective = "python_deprecated_stdlib_alias"
+	// AllowedThirdPartyDirective represents the directive that restricts the
+	// third-party modules, separated by commas, that the package may import,
+	// e.g. `requests,pydantic`, along with their submodules. Importing any
+	// other module resolving to a third-party distribution is reported as an
+	// error. The packages without it are unrestricted. Sub-packages inherit
+	// the allowlist, unless they set their own.
+	AllowedThirdPartyDirective = "python_allowed_third_party"
+	// ResolveManyDirective represents the directive that resolves an import to
+	// multiple labels, e.g. `py vendored.shim //vendored:shim_stub
+	// //vendored:shim`, all added as dependencies, like the standard
+	// gazelle:resolve directive does with a single label. It takes precedence
+	// over gazelle:resolve. Sub-packages inherit the mappings.
+	ResolveManyDirective = "python_resolve_many"
+	// PropagateStarReexportsDirective represents the directive that controls
+	// whether a star re-export of a first-party module, e.g. `from .compat
+	// import *`, adds the third-party dependencies of the target providing the
+	// re-exported module to the re-exporting target, following the nested star
+	// re-exports. Can be "true" or "false". Defaults to "false". Sub-packages
+	// inherit this value.
+	PropagateStarReexportsDirective = "python_propagate_star_reexports"
+	// NamespacePackagesDirective represents the directive that controls
+	// whether the directories without __init__.py, i.e. PEP 420 implicit
+	// namespace packages, are importable from the targets providing their
+	// modules, e.g. `import mynamespace.sub` from the target providing
+	// `mynamespace/sub/module.py`. Can be "true" or "false". Defaults to
+	// "false". Sub-packages inherit this value.
+	NamespacePackagesDirective = "python_namespace_packages"
+	// ModuleDistributionDirective represents the directive that declares the
+	// authoritative distribution of a module, and its submodules, provided by
+	// multiple distributions, e.g. `Crypto pycryptodome` rather than the
+	// abandoned pycrypto. The imports of a module provided by multiple
+	// distributions without it are reported as ambiguous. Sub-packages
+	// inherit the distributions.
+	ModuleDistributionDirective = "python_module_distribution"
+	// GeneratedCodeRootDirective represents the directive that declares a
+	// directory, relative to the workspace root, of generated code added to
+	// the Python path, e.g. `proto/gen`. The modules under it are named after
+	// their paths relative to this directory, e.g. `a.b` for
+	// `proto/gen/a/b.py`, like under a Python root. Sub-packages inherit the
+	// roots.
+	GeneratedCodeRootDirective = "python_generated_code_root"
+	// OptionalImportsCommentDirective represents the directive that controls
+	// whether the optional imports, i.e. guarded by an ImportError handler,
+	// dropped from the dependencies are listed in a `# optional: a, b` comment
+	// on the target, without adding any dependency. Can be "true" or "false".
+	// Defaults to "false". Sub-packages inherit this value.
+	OptionalImportsCommentDirective = "python_optional_imports_comment"
+	// LazyImportHelpersDirective represents the directive that declares the
+	// lazy-import helper functions, comma-separated, e.g. `lazy_loader.load`.
+	// Their calls with a literal module name, e.g. `lazy_loader.load("scipy")`,
+	// are resolved as optional imports of the module. Sub-packages inherit
+	// the helpers.
+	LazyImportHelpersDirective = "python_lazy_import_helpers"
+	// FirstPartyPrefixDirective represents the directive that declares an
+	// import prefix, e.g. `gen.protos`, of first-party modules not indexed
+	// at resolution time, e.g. generated by another rule. The modules under
+	// this prefix that don't resolve otherwise depend on the target named
+	// after their directory under the Python project root, e.g.
+	// `//gen/protos` for `gen.protos.users_pb2`. Sub-packages inherit the
+	// prefixes.
+	FirstPartyPrefixDirective = "python_first_party_prefix"
+	// TargetRequirementsSubsetDirective represents the directive that
+	// restricts the distributions, separated by commas, that a target of the
+	// package may depend on, e.g. `app requests,PyYAML`. Importing a
+	// third-party module from any other distribution is reported as an error.
+	// The targets without it are unrestricted. Sub-packages don't inherit the
+	// subsets.
+	TargetRequirementsSubsetDirective = "python_target_requirements_subset"
+	// TypeOnlyImportsAsTypeDepsDirective represents the directive that
+	// controls whether the imports only happening for type-checking, i.e.
+	// guarded by `if TYPE_CHECKING:` or, with `from __future__ import
+	// annotations`, only used in annotations, are added to the type-checking
+	// dependencies, i.e. the pyi_deps attribute, instead of deps. Can be
+	// "true" or "false". Defaults to "false". Sub-packages inherit this value.
+	TypeOnlyImportsAsTypeDepsDirective = "python_type_only_imports_as_type_deps"
+	// ResolveFileDirective represents the directive that sets a JSON or CSV
+	// file, relative to the workspace root, mapping imports to Bazel labels,
+	// in the same way as the resolve directive. An import ending with `.*`,
+	// e.g. `mypkg.*`, maps all the submodules of the package. Sub-packages
+	// inherit this value.
+	ResolveFileDirective = "python_resolve_file"
+	// DefaultVisibilityDirective represents the directive that sets the
+	// visibility, as whitespace-separated labels, of the generated
+	// py_library and py_binary targets, e.g. `//visibility:public`, instead
+	// of the sub-packages of the Python root. An empty value restores the
+	// default. Sub-packages inherit this value.
+	DefaultVisibilityDirective = "python_default_visibility"
+	// IgnoreDistributionDirective represents the directive that lists the
+	// distributions, separated by commas, whose modules add no dependency,
+	// e.g. provided by the runtime. Unlike the ignore comments, it applies
+	// to all the imports of the modules of the distribution. Sub-packages
+	// inherit the distributions.
+	IgnoreDistributionDirective = "python_ignore_dependency"
+	// ResolvePreferClosestDirective represents the directive that controls
+	// whether an import provided by multiple targets under the same Python
+	// root resolves to the target whose Bazel package shares the longest path
+	// prefix with the package of the importing target, e.g. a test double
+	// next to it, instead of being reported as ambiguous. Can be "true" or
+	// "false". Defaults to "false". Sub-packages inherit this value.
+	ResolvePreferClosestDirective = "python_resolve_prefer_closest"
+	// GroupDepsDirective represents the directive that controls whether the
+	// generated deps list the first-party dependencies and the third-party
+	// ones in separate groups, each led by a comment. Can be "true" or
+	// "false". Defaults to "false". Sub-packages inherit this value.
+	GroupDepsDirective = "python_group_deps"
+	// IndexCythonDirective represents the directive that controls whether the
+	// Cython sources, i.e. the `.pyx` and `.pxd` files, of the targets are
+	// indexed as the modules they compile to, e.g. `foo` for `foo.pyx`. Can be
+	// "true" or "false". Defaults to "false". Sub-packages inherit this value.
+	IndexCythonDirective = "python_index_cython"
 )
 
 // GenerationModeType represents one of the generation modes for the Python
@@ -66,16 +404,167 @@ const (
 	GenerationModeProject GenerationModeType = "project"
 )
 
+// ConditionalAlternativesType represents one of the policies resolving the
+// imports of the branches of an if/else statement.
+type ConditionalAlternativesType string
+
+// Conditional alternatives policies
+const (
+	// ConditionalAlternativesAll defines the policy in which the imports of all
+	// the branches are resolved, i.e. a safe superset.
+	ConditionalAlternativesAll ConditionalAlternativesType = "all"
+	// ConditionalAlternativesFirst defines the policy in which only the imports
+	// of the first branch are resolved.
+	ConditionalAlternativesFirst ConditionalAlternativesType = "first"
+	// ConditionalAlternativesNone defines the policy in which the imports of
+	// none of the branches are resolved.
+	ConditionalAlternativesNone ConditionalAlternativesType = "none"
+)
+
+// DynamicImportsConfidenceType represents one of the minimum confidences in the
+// module names of the dynamic imports to resolve them.
+type DynamicImportsConfidenceType string
+
+// Dynamic imports minimum confidences
+const (
+	// DynamicImportsConfidenceNone defines that no dynamic import is resolved.
+	DynamicImportsConfidenceNone DynamicImportsConfidenceType = "none"
+	// DynamicImportsConfidenceHigh defines that only the dynamic imports of
+	// string literals, e.g. "pkg.mod", are resolved. The other dynamic imports
+	// are reported.
+	DynamicImportsConfidenceHigh DynamicImportsConfidenceType = "high"
+	// DynamicImportsConfidenceMedium defines that the dynamic imports of
+	// f-strings with a literal prefix, e.g. f"pkg.{name}", are also resolved
+	// to the package of the prefix.
+	DynamicImportsConfidenceMedium DynamicImportsConfidenceType = "medium"
+)
+
+// LabelConventionType represents one of the conventions of the labels of the
+// distributions installed by the pip repositories across the rules_python
+// versions.
+type LabelConventionType string
+
+// Label conventions
+const (
+	// LabelConventionLegacyPypi defines the labels of the distributions as
+	// `@<repository_name>//pypi__<distribution_name>`.
+	LabelConventionLegacyPypi LabelConventionType = "legacy_pypi"
+	// LabelConventionPipHub defines the labels of the distributions as
+	// `@<repository_name>//<distribution_name>`.
+	LabelConventionPipHub LabelConventionType = "pip_hub"
+	// LabelConventionPerPackageHub defines the labels of the distributions as
+	// `@<repository_name>_<distribution_name>//:pkg`.
+	LabelConventionPerPackageHub LabelConventionType = "per_package_hub"
+)
+
+// ResolutionStrategyType represents one of the strategies resolving an import.
+type ResolutionStrategyType string
+
+// Resolution strategies
+const (
+	// ResolutionStrategyOverride defines the strategy resolving the imports
+	// using the resolve directives and the resolve overrides.
+	ResolutionStrategyOverride ResolutionStrategyType = "override"
+	// ResolutionStrategyMapping defines the strategy resolving the imports to
+	// the third-party distributions of the modules mapping.
+	ResolutionStrategyMapping ResolutionStrategyType = "mapping"
+	// ResolutionStrategyFirstParty defines the strategy resolving the imports
+	// to the first-party indexed targets.
+	ResolutionStrategyFirstParty ResolutionStrategyType = "first_party"
+	// ResolutionStrategyStdlib defines the strategy skipping the imports of
+	// the standard library and of the frozen modules.
+	ResolutionStrategyStdlib ResolutionStrategyType = "stdlib"
+)
+
+// defaultResolutionOrder is the order in which the resolution strategies are
+// tried by default.
+var defaultResolutionOrder = []ResolutionStrategyType{
+	ResolutionStrategyOverride,
+	ResolutionStrategyMapping,
+	ResolutionStrategyFirstParty,
+	ResolutionStrategyStdlib,
+}
+
 const (
 	packageNameNamingConventionSubstitution = "$package_name$"
+	defaultLazySubmodulesRegistry           = "_submodules"
+	defaultLibraryEntrypoint                = "__init__.py"
+	defaultDeprioritizedTag                 = "gazelle-generated"
+	defaultDepsAttribute                    = "deps"
 )
 
+// EnforcePrivateImportsType represents one of the ways the imports of private
+// modules from outside of their defining package are reported.
+type EnforcePrivateImportsType string
+
+// Private imports enforcements
+const (
+	// EnforcePrivateImportsOff defines that the imports of private modules
+	// aren't reported.
+	EnforcePrivateImportsOff EnforcePrivateImportsType = "off"
+	// EnforcePrivateImportsWarn defines that the imports of private modules
+	// are reported as warnings.
+	EnforcePrivateImportsWarn EnforcePrivateImportsType = "warn"
+	// EnforcePrivateImportsError defines that the imports of private modules
+	// are reported as errors, failing the resolution.
+	EnforcePrivateImportsError EnforcePrivateImportsType = "error"
+)
+
+// defaultBackports maps the modules of the common backports of the standard
+// library to the distributions providing them.
+var defaultBackports = map[string]string{
+	"backports.cached_property": "backports.cached_property",
+	"backports.zoneinfo":        "backports.zoneinfo",
+	"exceptiongroup":            "exceptiongroup",
+	"importlib_metadata":        "importlib_metadata",
+	"importlib_resources":       "importlib_resources",
+	"mock":                      "mock",
+	"typing_extensions":         "typing_extensions",
+}
+
+// defaultDeprecatedStdlibAliases maps the common deprecated aliases of the
+// standard library, i.e. modules or names imported from modules, to their
+// replacements.
+var defaultDeprecatedStdlibAliases = map[string]string{
+	"collections.AsyncIterable":   "collections.abc.AsyncIterable",
+	"collections.AsyncIterator":   "collections.abc.AsyncIterator",
+	"collections.Awaitable":       "collections.abc.Awaitable",
+	"collections.ByteString":      "collections.abc.ByteString",
+	"collections.Callable":        "collections.abc.Callable",
+	"collections.Container":       "collections.abc.Container",
+	"collections.Coroutine":       "collections.abc.Coroutine",
+	"collections.Generator":       "collections.abc.Generator",
+	"collections.Hashable":        "collections.abc.Hashable",
+	"collections.ItemsView":       "collections.abc.ItemsView",
+	"collections.Iterable":        "collections.abc.Iterable",
+	"collections.Iterator":        "collections.abc.Iterator",
+	"collections.KeysView":        "collections.abc.KeysView",
+	"collections.Mapping":         "collections.abc.Mapping",
+	"collections.MappingView":     "collections.abc.MappingView",
+	"collections.MutableMapping":  "collections.abc.MutableMapping",
+	"collections.MutableSequence": "collections.abc.MutableSequence",
+	"collections.MutableSet":      "collections.abc.MutableSet",
+	"collections.Reversible":      "collections.abc.Reversible",
+	"collections.Sequence":        "collections.abc.Sequence",
+	"collections.Set":             "collections.abc.Set",
+	"collections.Sized":           "collections.abc.Sized",
+	"collections.ValuesView":      "collections.abc.ValuesView",
+	"xml.etree.cElementTree":      "xml.etree.ElementTree",
+}
+
 // defaultIgnoreFiles is the list of default values used in the
 // python_ignore_files option.
 var defaultIgnoreFiles = map[string]struct{}{
 	"setup.py": {},
 }
 
+// moduleNameTransform represents a regular expression replacement applied to
+// the module names.
+type moduleNameTransform struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
 // Configs is an extension of map[string]*Config. It provides finding methods
 // on top of the mapping.
 type Configs map[string]*Config
@@ -107,6 +596,61 @@ type Config struct {
 	libraryNamingConvention  string
 	binaryNamingConvention   string
 	testNamingConvention     string
+	indexExportedOnly        bool
+	lazySubmodulesRegistry   string
+	pythonVersion            string
+	testHelperPatterns       []string
+	publicImports            map[string]struct{}
+	resolveWithRemoteCache   bool
+	resolveStarImports       bool
+	libraryEntrypoint        string
+	resolveOverrides         map[string]label.Label
+	distributionNames        map[string]string
+	injectedGlobals          map[string]label.Label
+	thirdPartyPrefixes       map[string]struct{}
+	versionPipRepositories   map[string]string
+	shebangScripts           bool
+	deprioritizedTag         string
+	firstPartyNamespaces     map[string]struct{}
+	moduleNameTransforms     []moduleNameTransform
+	implicitRelativeImports  bool
+	maxDeps                  int
+	maxDepsError             bool
+	crossResolveLanguages    []string
+	requirementLabels        map[string]label.Label
+	depsAttributes           map[string]string
+	movedModulesBaseline     map[string]string
+	conditionalAlternatives  ConditionalAlternativesType
+	dynamicImportsConfidence DynamicImportsConfidenceType
+	labelConvention          LabelConventionType
+	resolveRelativeImports   bool
+	backports                map[string]string
+	enforcePrivateImports    EnforcePrivateImportsType
+	stubsRoot                string
+	packageAliases           map[string]string
+	testFixtures             bool
+	frozenModules            map[string]struct{}
+	resolutionOrder          []ResolutionStrategyType
+	migrationShims           map[string]label.Label
+	pathPipRepositories      map[string]string
+	deprecatedStdlibAliases  map[string]string
+	allowedThirdParty        map[string]struct{}
+	resolveManyOverrides     map[string][]label.Label
+	propagateStarReexports   bool
+	namespacePackages        bool
+	moduleDistributions      map[string]string
+	generatedCodeRoots       map[string]struct{}
+	optionalImportsComment   bool
+	lazyImportHelpers        map[string]struct{}
+	firstPartyPrefixes       map[string]struct{}
+	requirementsSubsets      map[string]map[string]struct{}
+	typeOnlyAsTypeDeps       bool
+	resolveFileOverrides     map[string]label.Label
+	defaultVisibility        []string
+	ignoredDistributions     map[string]struct{}
+	resolvePreferClosest     bool
+	groupDeps                bool
+	indexCython              bool
 }
 
 // New creates a new Config.
@@ -126,6 +670,61 @@ func New(
 		libraryNamingConvention:  packageNameNamingConventionSubstitution,
 		binaryNamingConvention:   fmt.Sprintf("%s_bin", packageNameNamingConventionSubstitution),
 		testNamingConvention:     fmt.Sprintf("%s_test", packageNameNamingConventionSubstitution),
+		indexExportedOnly:        false,
+		lazySubmodulesRegistry:   defaultLazySubmodulesRegistry,
+		pythonVersion:            "",
+		testHelperPatterns:       nil,
+		publicImports:            nil,
+		resolveWithRemoteCache:   false,
+		resolveStarImports:       false,
+		libraryEntrypoint:        defaultLibraryEntrypoint,
+		resolveOverrides:         nil,
+		distributionNames:        make(map[string]string),
+		injectedGlobals:          make(map[string]label.Label),
+		thirdPartyPrefixes:       make(map[string]struct{}),
+		versionPipRepositories:   make(map[string]string),
+		shebangScripts:           false,
+		deprioritizedTag:         defaultDeprioritizedTag,
+		firstPartyNamespaces:     make(map[string]struct{}),
+		moduleNameTransforms:     nil,
+		implicitRelativeImports:  false,
+		maxDeps:                  0,
+		maxDepsError:             false,
+		crossResolveLanguages:    nil,
+		requirementLabels:        nil,
+		depsAttributes:           make(map[string]string),
+		movedModulesBaseline:     nil,
+		conditionalAlternatives:  ConditionalAlternativesAll,
+		dynamicImportsConfidence: DynamicImportsConfidenceNone,
+		labelConvention:          "",
+		resolveRelativeImports:   true,
+		backports:                make(map[string]string),
+		enforcePrivateImports:    EnforcePrivateImportsOff,
+		stubsRoot:                "",
+		packageAliases:           make(map[string]string),
+		testFixtures:             false,
+		frozenModules:            make(map[string]struct{}),
+		resolutionOrder:          defaultResolutionOrder,
+		migrationShims:           make(map[string]label.Label),
+		pathPipRepositories:      make(map[string]string),
+		deprecatedStdlibAliases:  make(map[string]string),
+		allowedThirdParty:        nil,
+		resolveManyOverrides:     make(map[string][]label.Label),
+		propagateStarReexports:   false,
+		namespacePackages:        false,
+		optionalImportsComment:   false,
+		moduleDistributions:      make(map[string]string),
+		generatedCodeRoots:       make(map[string]struct{}),
+		lazyImportHelpers:        make(map[string]struct{}),
+		firstPartyPrefixes:       make(map[string]struct{}),
+		requirementsSubsets:      make(map[string]map[string]struct{}),
+		typeOnlyAsTypeDeps:       false,
+		resolveFileOverrides:     nil,
+		defaultVisibility:        nil,
+		ignoredDistributions:     make(map[string]struct{}),
+		resolvePreferClosest:     false,
+		groupDeps:                false,
+		indexCython:              false,
 	}
 }
 
@@ -150,6 +749,61 @@ func (c *Config) NewChild() *Config {
 		libraryNamingConvention:  c.libraryNamingConvention,
 		binaryNamingConvention:   c.binaryNamingConvention,
 		testNamingConvention:     c.testNamingConvention,
+		indexExportedOnly:        c.indexExportedOnly,
+		lazySubmodulesRegistry:   c.lazySubmodulesRegistry,
+		pythonVersion:            c.pythonVersion,
+		testHelperPatterns:       c.testHelperPatterns,
+		publicImports:            nil,
+		resolveWithRemoteCache:   c.resolveWithRemoteCache,
+		resolveStarImports:       c.resolveStarImports,
+		libraryEntrypoint:        c.libraryEntrypoint,
+		resolveOverrides:         c.resolveOverrides,
+		distributionNames:        make(map[string]string),
+		injectedGlobals:          make(map[string]label.Label),
+		thirdPartyPrefixes:       make(map[string]struct{}),
+		versionPipRepositories:   make(map[string]string),
+		shebangScripts:           c.shebangScripts,
+		deprioritizedTag:         c.deprioritizedTag,
+		firstPartyNamespaces:     make(map[string]struct{}),
+		moduleNameTransforms:     c.moduleNameTransforms,
+		implicitRelativeImports:  c.implicitRelativeImports,
+		maxDeps:                  c.maxDeps,
+		maxDepsError:             c.maxDepsError,
+		crossResolveLanguages:    c.crossResolveLanguages,
+		requirementLabels:        c.requirementLabels,
+		depsAttributes:           make(map[string]string),
+		movedModulesBaseline:     c.movedModulesBaseline,
+		conditionalAlternatives:  c.conditionalAlternatives,
+		dynamicImportsConfidence: c.dynamicImportsConfidence,
+		labelConvention:          c.labelConvention,
+		resolveRelativeImports:   c.resolveRelativeImports,
+		backports:                make(map[string]string),
+		enforcePrivateImports:    c.enforcePrivateImports,
+		stubsRoot:                c.stubsRoot,
+		packageAliases:           make(map[string]string),
+		testFixtures:             c.testFixtures,
+		frozenModules:            make(map[string]struct{}),
+		resolutionOrder:          c.resolutionOrder,
+		migrationShims:           make(map[string]label.Label),
+		pathPipRepositories:      make(map[string]string),
+		deprecatedStdlibAliases:  make(map[string]string),
+		allowedThirdParty:        c.allowedThirdParty,
+		resolveManyOverrides:     make(map[string][]label.Label),
+		propagateStarReexports:   c.propagateStarReexports,
+		namespacePackages:        c.namespacePackages,
+		optionalImportsComment:   c.optionalImportsComment,
+		moduleDistributions:      make(map[string]string),
+		generatedCodeRoots:       make(map[string]struct{}),
+		lazyImportHelpers:        make(map[string]struct{}),
+		firstPartyPrefixes:       make(map[string]struct{}),
+		requirementsSubsets:      make(map[string]map[string]struct{}),
+		typeOnlyAsTypeDeps:       c.typeOnlyAsTypeDeps,
+		resolveFileOverrides:     c.resolveFileOverrides,
+		defaultVisibility:        c.defaultVisibility,
+		ignoredDistributions:     make(map[string]struct{}),
+		resolvePreferClosest:     c.resolvePreferClosest,
+		groupDeps:                c.groupDeps,
+		indexCython:              c.indexCython,
 	}
 }
 
@@ -192,37 +846,133 @@ func (c *Config) SetGazelleManifest(gazelleManifest *manifest.Manifest) {
 
 // FindThirdPartyDependency scans the gazelle manifests for the current config
 // and the parent configs up to the root finding if it can resolve the module
-// name.
-func (c *Config) FindThirdPartyDependency(modName string) (string, bool) {
+// name imported from the given Bazel package.
+func (c *Config) FindThirdPartyDependency(bzlPkg, modName string) (string, bool) {
 	for currentCfg := c; currentCfg != nil; currentCfg = currentCfg.parent {
 		if currentCfg.gazelleManifest != nil {
 			gazelleManifest := currentCfg.gazelleManifest
-			if distributionName, ok := gazelleManifest.ModulesMapping[modName]; ok {
+			if distributionName, ok := c.manifestDistribution(gazelleManifest, modName); ok {
+				if lbl, ok := c.FindRequirementLabel(distributionName); ok {
+					return lbl.String(), true
+				}
 				var distributionRepositoryName string
 				if gazelleManifest.PipDepsRepositoryName != "" {
 					distributionRepositoryName = gazelleManifest.PipDepsRepositoryName
 				} else if gazelleManifest.PipRepository != nil {
 					distributionRepositoryName = gazelleManifest.PipRepository.Name
 				}
-				sanitizedDistribution := strings.ToLower(distributionName)
-				sanitizedDistribution = strings.ReplaceAll(sanitizedDistribution, "-", "_")
-				var lbl label.Label
-				if gazelleManifest.PipRepository != nil && gazelleManifest.PipRepository.Incremental {
-					// @<repository_name>_<distribution_name>//:pkg
-					distributionRepositoryName = distributionRepositoryName + "_" + sanitizedDistribution
-					lbl = label.New(distributionRepositoryName, "", "pkg")
-				} else {
-					// @<repository_name>//pypi__<distribution_name>
-					distributionPackage := "pypi__" + sanitizedDistribution
-					lbl = label.New(distributionRepositoryName, distributionPackage, distributionPackage)
+				incremental := gazelleManifest.PipRepository != nil && gazelleManifest.PipRepository.Incremental
+				if pipRepositoryName, ok := c.pathPipRepository(bzlPkg); ok {
+					distributionRepositoryName = pipRepositoryName
+				} else if pipRepositoryName, ok := c.versionPipRepository(); ok {
+					distributionRepositoryName = pipRepositoryName
 				}
-				return lbl.String(), true
+				return c.distributionLabel(distributionRepositoryName, incremental, distributionName), true
+			}
+		}
+	}
+	return "", false
+}
+
+// manifestDistribution returns the name of the distribution providing the given
+// module according to the given manifest.
+func (c *Config) manifestDistribution(gazelleManifest *manifest.Manifest, modName string) (string, bool) {
+	distributionName, ok := gazelleManifest.ModulesMapping[modName]
+	if _, conflict := gazelleManifest.ModulesMappingConflicts[modName]; ok || conflict {
+		// The authoritative distribution wins over the manifest, e.g. for a
+		// module provided by multiple distributions.
+		if moduleDistribution, found := c.moduleDistribution(modName); found {
+			distributionName, ok = moduleDistribution, true
+		}
+	}
+	if !ok {
+		// The backports resolve to their distributions when present in the
+		// manifest, even if the module itself isn't mapped.
+		distributionName, ok = c.manifestBackportDistribution(gazelleManifest, modName)
+	}
+	return distributionName, ok
+}
+
+// FindThirdPartyDistribution scans the gazelle manifests for the current config
+// and the parent configs up to the root finding if it can resolve the module
+// name. It returns the name of the distribution providing the module.
+func (c *Config) FindThirdPartyDistribution(modName string) (string, bool) {
+	for currentCfg := c; currentCfg != nil; currentCfg = currentCfg.parent {
+		if currentCfg.gazelleManifest != nil {
+			if distributionName, ok := c.manifestDistribution(currentCfg.gazelleManifest, modName); ok {
+				return distributionName, true
 			}
 		}
 	}
 	return "", false
 }
 
+// FindPlatformThirdPartyDependencies scans the gazelle manifests for the
+// current config and the parent configs up to the root finding if it can
+// resolve the module name to a distribution pinned differently across the
+// platform-specific requirements. It returns the labels of the distribution
+// keyed by operating system.
+func (c *Config) FindPlatformThirdPartyDependencies(modName string) (map[string]string, bool) {
+	for currentCfg := c; currentCfg != nil; currentCfg = currentCfg.parent {
+		if currentCfg.gazelleManifest != nil {
+			gazelleManifest := currentCfg.gazelleManifest
+			distributionName, ok := gazelleManifest.ModulesMapping[modName]
+			if !ok {
+				continue
+			}
+			if _, ok := c.FindRequirementLabel(distributionName); ok {
+				// The mapped label provides the distribution on all the
+				// platforms.
+				return nil, false
+			}
+			// The extras of a distribution are installed from the same wheel.
+			baseDistribution, _ := manifest.SplitDistributionExtras(distributionName)
+			sanitizedDistribution := manifest.SanitizeDistributionName(baseDistribution)
+			for _, platformDistribution := range gazelleManifest.PlatformDistributions {
+				if platformDistribution != sanitizedDistribution {
+					continue
+				}
+				deps := make(map[string]string, len(gazelleManifest.PlatformPipRepositories))
+				for goos, pipRepository := range gazelleManifest.PlatformPipRepositories {
+					deps[goos] = c.distributionLabel(pipRepository.Name, pipRepository.Incremental, distributionName)
+				}
+				return deps, true
+			}
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// distributionLabel returns the label of the distribution installed by the
+// given pip repository, following the selected label convention.
+func (c *Config) distributionLabel(distributionRepositoryName string, incremental bool, distributionName string) string {
+	sanitizedDistribution := c.DistributionName(distributionName)
+	convention := c.labelConvention
+	if convention == "" {
+		if incremental {
+			convention = LabelConventionPerPackageHub
+		} else {
+			convention = LabelConventionLegacyPypi
+		}
+	}
+	var lbl label.Label
+	switch convention {
+	case LabelConventionPerPackageHub:
+		// @<repository_name>_<distribution_name>//:pkg
+		distributionRepositoryName = distributionRepositoryName + "_" + sanitizedDistribution
+		lbl = label.New(distributionRepositoryName, "", "pkg")
+	case LabelConventionPipHub:
+		// @<repository_name>//<distribution_name>
+		lbl = label.New(distributionRepositoryName, sanitizedDistribution, sanitizedDistribution)
+	default:
+		// @<repository_name>//pypi__<distribution_name>
+		distributionPackage := "pypi__" + sanitizedDistribution
+		lbl = label.New(distributionRepositoryName, distributionPackage, distributionPackage)
+	}
+	return lbl.String()
+}
+
 // AddIgnoreFile adds a file to the list of ignored files for a given package.
 // Adding an ignored file to a package also makes it ignored on a subpackage.
 func (c *Config) AddIgnoreFile(file string) {
@@ -338,3 +1088,1026 @@ func (c *Config) SetTestNamingConvention(testNamingConvention string) {
 func (c *Config) RenderTestName(packageName string) string {
 	return strings.ReplaceAll(c.testNamingConvention, packageNameNamingConventionSubstitution, packageName)
 }
+
+// SetIndexExportedOnly sets whether only the public modules should be indexed
+// as importable.
+func (c *Config) SetIndexExportedOnly(exportedOnly bool) {
+	c.indexExportedOnly = exportedOnly
+}
+
+// IndexExportedOnly returns whether only the public modules should be indexed
+// as importable.
+func (c *Config) IndexExportedOnly() bool {
+	return c.indexExportedOnly
+}
+
+// SetLazySubmodulesRegistry sets the name of the module attribute mapping names
+// to modules lazily imported by a module-level __getattr__.
+func (c *Config) SetLazySubmodulesRegistry(registry string) {
+	c.lazySubmodulesRegistry = registry
+}
+
+// LazySubmodulesRegistry returns the name of the module attribute mapping names
+// to modules lazily imported by a module-level __getattr__.
+func (c *Config) LazySubmodulesRegistry() string {
+	return c.lazySubmodulesRegistry
+}
+
+// SetPythonVersion sets the Python version, in the `major.minor` form,
+// targeted by the Bazel package.
+func (c *Config) SetPythonVersion(version string) {
+	c.pythonVersion = version
+}
+
+// PythonVersion returns the Python version, in the `major.minor` form,
+// targeted by the Bazel package. An empty value means any version.
+func (c *Config) PythonVersion() string {
+	return c.pythonVersion
+}
+
+// SetTestHelperPatterns sets the glob patterns of the test helper files
+// embedded into the py_test target.
+func (c *Config) SetTestHelperPatterns(patterns []string) {
+	c.testHelperPatterns = patterns
+}
+
+// IsTestHelper checks if a file is a test helper embedded into the py_test
+// target by matching its base name against the test helper patterns.
+func (c *Config) IsTestHelper(file string) bool {
+	baseName := filepath.Base(file)
+	for _, pattern := range c.testHelperPatterns {
+		if matches, _ := filepath.Match(pattern, baseName); matches {
+			return true
+		}
+	}
+	return false
+}
+
+// AddPublicImport adds a module to the public API surface of the targets in
+// the Bazel package.
+func (c *Config) AddPublicImport(imp string) {
+	if c.publicImports == nil {
+		c.publicImports = make(map[string]struct{})
+	}
+	c.publicImports[strings.TrimSpace(imp)] = struct{}{}
+}
+
+// IsPublicImport checks if a module is part of the public API surface of the
+// targets in the Bazel package, i.e. it's declared public or it's a submodule
+// of a public module. All modules are public if no public API surface was
+// declared.
+func (c *Config) IsPublicImport(imp string) bool {
+	if c.publicImports == nil {
+		return true
+	}
+	for publicImport := range c.publicImports {
+		if imp == publicImport || strings.HasPrefix(imp, publicImport+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// SetResolveWithRemoteCache sets whether the imports that can't be resolved
+// locally should be looked up in the RemoteCache.
+func (c *Config) SetResolveWithRemoteCache(resolveWithRemoteCache bool) {
+	c.resolveWithRemoteCache = resolveWithRemoteCache
+}
+
+// ResolveWithRemoteCache returns whether the imports that can't be resolved
+// locally should be looked up in the RemoteCache.
+func (c *Config) ResolveWithRemoteCache() bool {
+	return c.resolveWithRemoteCache
+}
+
+// SetResolveStarImports sets whether a star import of a package should
+// resolve to all the targets providing modules under the package.
+func (c *Config) SetResolveStarImports(resolveStarImports bool) {
+	c.resolveStarImports = resolveStarImports
+}
+
+// ResolveStarImports returns whether a star import of a package should
+// resolve to all the targets providing modules under the package.
+func (c *Config) ResolveStarImports() bool {
+	return c.resolveStarImports
+}
+
+// SetLibraryEntrypointFilename sets the filename marking a directory as a
+// Python package in addition to __init__.py.
+func (c *Config) SetLibraryEntrypointFilename(filename string) {
+	c.libraryEntrypoint = filename
+}
+
+// LibraryEntrypointFilename returns the filename marking a directory as a
+// Python package in addition to __init__.py.
+func (c *Config) LibraryEntrypointFilename() string {
+	return c.libraryEntrypoint
+}
+
+// SetResolveOverrides sets the mapping from imports to the labels overriding
+// their resolution.
+func (c *Config) SetResolveOverrides(overrides map[string]label.Label) {
+	c.resolveOverrides = overrides
+}
+
+// FindResolveOverride returns the label overriding the resolution of the given
+// module. The most specific override wins, i.e. an override for `foo.bar`
+// takes precedence over an override for `foo`, which also applies to its
+// submodules.
+func (c *Config) FindResolveOverride(modName string) (label.Label, bool) {
+	for imp := modName; imp != ""; {
+		if lbl, ok := c.resolveOverrides[imp]; ok {
+			return lbl, true
+		}
+		i := strings.LastIndex(imp, ".")
+		if i < 0 {
+			break
+		}
+		imp = imp[:i]
+	}
+	return label.NoLabel, false
+}
+
+// AddDistributionNameOverride overrides the name of a distribution as used in
+// the labels of the pip repositories. Adding an override to a package also
+// applies it to the sub-packages.
+func (c *Config) AddDistributionNameOverride(distribution, name string) {
+	c.distributionNames[manifest.SanitizeDistributionName(distribution)] = name
+}
+
+// DistributionName returns the name of a distribution as used in the labels of
+// the pip repositories. It's the override declared in the given package or in
+// one of the parent packages up to the workspace root, if any, or the
+// distribution name normalized according to PEP 503 otherwise. The extras of
+// the distribution, if any, are appended to the name, e.g. `requests_security`
+// for `requests[security]`.
+func (c *Config) DistributionName(distribution string) string {
+	distribution, extras := manifest.SplitDistributionExtras(distribution)
+	name := manifest.SanitizeDistributionName(distribution)
+	for currentCfg := c; currentCfg != nil; currentCfg = currentCfg.parent {
+		if override, ok := currentCfg.distributionNames[name]; ok {
+			name = override
+			break
+		}
+	}
+	for _, extra := range extras {
+		name += "_" + manifest.SanitizeDistributionName(extra)
+	}
+	return name
+}
+
+// AddInjectedGlobal maps a global injected at runtime to the target providing
+// it. Adding an injected global to a package also applies it to the
+// sub-packages.
+func (c *Config) AddInjectedGlobal(name string, lbl label.Label) {
+	c.injectedGlobals[name] = lbl
+}
+
+// InjectedGlobals returns the names, sorted, of the globals injected at
+// runtime in the given package or in one of the parent packages up to the
+// workspace root.
+func (c *Config) InjectedGlobals() []string {
+	names := make(map[string]struct{})
+	for currentCfg := c; currentCfg != nil; currentCfg = currentCfg.parent {
+		for name := range currentCfg.injectedGlobals {
+			names[name] = struct{}{}
+		}
+	}
+	injectedGlobals := make([]string, 0, len(names))
+	for name := range names {
+		injectedGlobals = append(injectedGlobals, name)
+	}
+	sort.Strings(injectedGlobals)
+	return injectedGlobals
+}
+
+// FindInjectedGlobal returns the label of the target providing the global
+// injected at runtime. The mapping declared in the closest package wins.
+func (c *Config) FindInjectedGlobal(name string) (label.Label, bool) {
+	for currentCfg := c; currentCfg != nil; currentCfg = currentCfg.parent {
+		if lbl, ok := currentCfg.injectedGlobals[name]; ok {
+			return lbl, true
+		}
+	}
+	return label.NoLabel, false
+}
+
+// AddThirdPartyPrefix adds a first-party facade namespace exposing the
+// third-party modules. Adding a prefix to a package also applies it to the
+// sub-packages.
+func (c *Config) AddThirdPartyPrefix(prefix string) {
+	c.thirdPartyPrefixes[strings.TrimSpace(prefix)] = struct{}{}
+}
+
+// TrimThirdPartyPrefix returns the module name without the longest facade
+// namespace declared in the given package or in one of the parent packages up
+// to the workspace root, e.g. `requests` for `company.third_party.requests`.
+// It returns the module name unchanged if it's not under a facade namespace.
+func (c *Config) TrimThirdPartyPrefix(modName string) string {
+	trimmed := modName
+	for currentCfg := c; currentCfg != nil; currentCfg = currentCfg.parent {
+		for prefix := range currentCfg.thirdPartyPrefixes {
+			if strings.HasPrefix(modName, prefix+".") && len(modName)-len(prefix)-1 < len(trimmed) {
+				trimmed = modName[len(prefix)+1:]
+			}
+		}
+	}
+	return trimmed
+}
+
+// AddVersionPipRepository maps a Python version, in the `major.minor` form, to
+// the name of the pip repository installing the distributions for this
+// version. Adding a mapping to a package also applies it to the sub-packages.
+func (c *Config) AddVersionPipRepository(version, pipRepositoryName string) {
+	c.versionPipRepositories[version] = pipRepositoryName
+}
+
+// versionPipRepository returns the name of the pip repository mapped to the
+// Python version targeted by the Bazel package, in the given package or in one
+// of the parent packages up to the workspace root.
+func (c *Config) versionPipRepository() (string, bool) {
+	if c.pythonVersion == "" {
+		return "", false
+	}
+	for currentCfg := c; currentCfg != nil; currentCfg = currentCfg.parent {
+		if pipRepositoryName, ok := currentCfg.versionPipRepositories[c.pythonVersion]; ok {
+			return pipRepositoryName, true
+		}
+	}
+	return "", false
+}
+
+// SetShebangScripts sets whether the extensionless executable scripts with a
+// Python shebang should generate py_binary targets.
+func (c *Config) SetShebangScripts(shebangScripts bool) {
+	c.shebangScripts = shebangScripts
+}
+
+// ShebangScripts returns whether the extensionless executable scripts with a
+// Python shebang should generate py_binary targets.
+func (c *Config) ShebangScripts() bool {
+	return c.shebangScripts
+}
+
+// SetDeprioritizedTag sets the tag marking the targets that lose against the
+// other targets providing the same import.
+func (c *Config) SetDeprioritizedTag(tag string) {
+	c.deprioritizedTag = tag
+}
+
+// DeprioritizedTag returns the tag marking the targets that lose against the
+// other targets providing the same import.
+func (c *Config) DeprioritizedTag() string {
+	return c.deprioritizedTag
+}
+
+// AddFirstPartyNamespace adds an import namespace of the project itself.
+// Adding a namespace to a package also applies it to the sub-packages.
+func (c *Config) AddFirstPartyNamespace(namespace string) {
+	c.firstPartyNamespaces[strings.TrimSpace(namespace)] = struct{}{}
+}
+
+// IsFirstPartyNamespace checks if a module is under one of the import
+// namespaces of the project itself declared in the given package or in one of
+// the parent packages up to the workspace root.
+func (c *Config) IsFirstPartyNamespace(modName string) bool {
+	for currentCfg := c; currentCfg != nil; currentCfg = currentCfg.parent {
+		for namespace := range currentCfg.firstPartyNamespaces {
+			if modName == namespace || strings.HasPrefix(modName, namespace+".") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AddModuleNameTransform adds a regular expression replacement applied to the
+// module names after the ones added by the given package or the parent
+// packages.
+func (c *Config) AddModuleNameTransform(pattern *regexp.Regexp, replacement string) {
+	// The transforms are copied so that the parent's aren't modified.
+	transforms := make([]moduleNameTransform, 0, len(c.moduleNameTransforms)+1)
+	transforms = append(transforms, c.moduleNameTransforms...)
+	c.moduleNameTransforms = append(transforms, moduleNameTransform{
+		pattern:     pattern,
+		replacement: replacement,
+	})
+}
+
+// TransformModuleName returns the module name with all the transforms applied
+// in order. The module name is unchanged if there is no transform.
+func (c *Config) TransformModuleName(modName string) string {
+	for _, transform := range c.moduleNameTransforms {
+		modName = transform.pattern.ReplaceAllString(modName, transform.replacement)
+	}
+	return modName
+}
+
+// SetImplicitRelativeImports sets whether the imports that don't resolve
+// absolutely should be resolved as the siblings of the importing module.
+func (c *Config) SetImplicitRelativeImports(implicitRelativeImports bool) {
+	c.implicitRelativeImports = implicitRelativeImports
+}
+
+// ImplicitRelativeImports returns whether the imports that don't resolve
+// absolutely should be resolved as the siblings of the importing module.
+func (c *Config) ImplicitRelativeImports() bool {
+	return c.implicitRelativeImports
+}
+
+// SetMaxDeps sets the maximum number of dependencies of a target and whether
+// exceeding it is an error instead of a warning.
+func (c *Config) SetMaxDeps(maxDeps int, isError bool) {
+	c.maxDeps = maxDeps
+	c.maxDepsError = isError
+}
+
+// MaxDeps returns the maximum number of dependencies of a target, zero meaning
+// no maximum, and whether exceeding it is an error instead of a warning.
+func (c *Config) MaxDeps() (int, bool) {
+	return c.maxDeps, c.maxDepsError
+}
+
+// SetCrossResolveLanguages sets the names of the other Gazelle extensions
+// indexing rules with Python imports.
+func (c *Config) SetCrossResolveLanguages(langs []string) {
+	c.crossResolveLanguages = langs
+}
+
+// CrossResolveLanguages returns the names of the other Gazelle extensions
+// indexing rules with Python imports.
+func (c *Config) CrossResolveLanguages() []string {
+	return c.crossResolveLanguages
+}
+
+// SetRequirementLabels sets the mapping from the sanitized requirement names to
+// the labels of the targets providing them.
+func (c *Config) SetRequirementLabels(requirementLabels map[string]label.Label) {
+	c.requirementLabels = requirementLabels
+}
+
+// FindRequirementLabel returns the label of the target providing the given
+// distribution, if mapped explicitly.
+func (c *Config) FindRequirementLabel(distributionName string) (label.Label, bool) {
+	lbl, ok := c.requirementLabels[manifest.SanitizeDistributionName(distributionName)]
+	return lbl, ok
+}
+
+// AddDepsAttribute sets the attribute receiving the resolved dependencies of
+// the rules of the given kind. Adding it to a package also applies it to the
+// sub-packages.
+func (c *Config) AddDepsAttribute(kind, attr string) {
+	c.depsAttributes[kind] = attr
+}
+
+// DepsAttribute returns the attribute receiving the resolved dependencies of
+// the rules of the given kind, set in the given package or in one of the
+// parent packages up to the workspace root.
+func (c *Config) DepsAttribute(kind string) string {
+	for currentCfg := c; currentCfg != nil; currentCfg = currentCfg.parent {
+		if attr, ok := currentCfg.depsAttributes[kind]; ok {
+			return attr
+		}
+	}
+	return defaultDepsAttribute
+}
+
+// SetMovedModulesBaseline sets the mapping from the module names to the
+// SHA-256 hashes of their contents recorded at a baseline.
+func (c *Config) SetMovedModulesBaseline(baseline map[string]string) {
+	c.movedModulesBaseline = baseline
+}
+
+// TracksMovedModules returns whether the contents of the modules are hashed to
+// report the moved modules.
+func (c *Config) TracksMovedModules() bool {
+	return len(c.movedModulesBaseline) > 0
+}
+
+// BaselineContentHash returns the SHA-256 hash of the content of the given
+// module recorded at the baseline.
+func (c *Config) BaselineContentHash(modName string) (string, bool) {
+	contentHash, ok := c.movedModulesBaseline[modName]
+	return contentHash, ok
+}
+
+// SetConditionalAlternatives sets the policy resolving the imports of the
+// branches of an if/else statement.
+func (c *Config) SetConditionalAlternatives(policy ConditionalAlternativesType) {
+	c.conditionalAlternatives = policy
+}
+
+// ConditionalAlternatives returns the policy resolving the imports of the
+// branches of an if/else statement.
+func (c *Config) ConditionalAlternatives() ConditionalAlternativesType {
+	return c.conditionalAlternatives
+}
+
+// SetDynamicImportsMinConfidence sets the minimum confidence in the module
+// names of the dynamic imports to resolve them.
+func (c *Config) SetDynamicImportsMinConfidence(confidence DynamicImportsConfidenceType) {
+	c.dynamicImportsConfidence = confidence
+}
+
+// DynamicImportsMinConfidence returns the minimum confidence in the module
+// names of the dynamic imports to resolve them.
+func (c *Config) DynamicImportsMinConfidence() DynamicImportsConfidenceType {
+	return c.dynamicImportsConfidence
+}
+
+// SetLabelConvention sets the convention of the labels of the distributions
+// installed by the pip repository.
+func (c *Config) SetLabelConvention(convention LabelConventionType) {
+	c.labelConvention = convention
+}
+
+// SetResolveRelativeImports sets whether the relative imports resolve to the
+// targets providing the imported modules.
+func (c *Config) SetResolveRelativeImports(resolveRelativeImports bool) {
+	c.resolveRelativeImports = resolveRelativeImports
+}
+
+// ResolveRelativeImports returns whether the relative imports resolve to the
+// targets providing the imported modules.
+func (c *Config) ResolveRelativeImports() bool {
+	return c.resolveRelativeImports
+}
+
+// AddBackport maps the module of a backport of the standard library to the
+// distribution providing it. Adding it to a package also applies it to the
+// sub-packages.
+func (c *Config) AddBackport(modName, distributionName string) {
+	c.backports[modName] = distributionName
+}
+
+// backportDistribution returns the distribution providing the given module, or
+// one of its parent modules, if it's a backport of the standard library. The
+// backports added to the given package or to one of the parent packages take
+// precedence over the common backports.
+func (c *Config) backportDistribution(modName string) (string, bool) {
+	for imp := modName; imp != ""; {
+		for currentCfg := c; currentCfg != nil; currentCfg = currentCfg.parent {
+			if distributionName, ok := currentCfg.backports[imp]; ok {
+				return distributionName, true
+			}
+		}
+		if distributionName, ok := defaultBackports[imp]; ok {
+			return distributionName, true
+		}
+		i := strings.LastIndex(imp, ".")
+		if i < 0 {
+			break
+		}
+		imp = imp[:i]
+	}
+	return "", false
+}
+
+// IsBackport returns whether the given module is provided by a backport of the
+// standard library, i.e. it must never be resolved as part of the standard
+// library.
+func (c *Config) IsBackport(modName string) bool {
+	_, ok := c.backportDistribution(modName)
+	return ok
+}
+
+// manifestBackportDistribution returns the distribution, as named in the
+// given manifest, providing the given module if it's a backport of the
+// standard library present in the manifest.
+func (c *Config) manifestBackportDistribution(gazelleManifest *manifest.Manifest, modName string) (string, bool) {
+	backportDistribution, ok := c.backportDistribution(modName)
+	if !ok {
+		return "", false
+	}
+	sanitizedBackport := manifest.SanitizeDistributionName(backportDistribution)
+	for _, distributionName := range gazelleManifest.ModulesMapping {
+		if manifest.SanitizeDistributionName(distributionName) == sanitizedBackport {
+			return distributionName, true
+		}
+	}
+	return "", false
+}
+
+// SetEnforcePrivateImports sets how the imports of private modules from outside
+// of their defining package are reported.
+func (c *Config) SetEnforcePrivateImports(enforcement EnforcePrivateImportsType) {
+	c.enforcePrivateImports = enforcement
+}
+
+// EnforcePrivateImports returns how the imports of private modules from outside
+// of their defining package are reported.
+func (c *Config) EnforcePrivateImports() EnforcePrivateImportsType {
+	return c.enforcePrivateImports
+}
+
+// SetStubsRoot sets the directory, relative to the workspace root, of the
+// hand-written stubs. An empty directory disables it.
+func (c *Config) SetStubsRoot(stubsRoot string) {
+	c.stubsRoot = stubsRoot
+}
+
+// StubsRoot returns the directory, relative to the workspace root, of the
+// hand-written stubs and whether it's set.
+func (c *Config) StubsRoot() (string, bool) {
+	return c.stubsRoot, c.stubsRoot != ""
+}
+
+// IsStubFile returns whether the given path, relative to the workspace root,
+// is a `.pyi` file under the stubs root.
+func (c *Config) IsStubFile(p string) bool {
+	if c.stubsRoot == "" || filepath.Ext(p) != ".pyi" {
+		return false
+	}
+	return strings.HasPrefix(filepath.ToSlash(p), c.stubsRoot+"/")
+}
+
+// AddPackageAlias maps the given top-level import alias to the directory,
+// relative to the workspace root, of the package it names. Adding it to a
+// package also applies it to the sub-packages.
+func (c *Config) AddPackageAlias(alias, dir string) {
+	c.packageAliases[alias] = dir
+}
+
+// FindPackageAlias returns the top-level import alias naming the given
+// directory, relative to the workspace root, or one of its parent directories,
+// along with the aliased directory. The deepest aliased directory wins, and
+// the aliases added to the given package take precedence over the ones added
+// to the parent packages.
+func (c *Config) FindPackageAlias(dir string) (string, string, bool) {
+	dir = filepath.ToSlash(dir)
+	var foundAlias, foundDir string
+	for currentCfg := c; currentCfg != nil; currentCfg = currentCfg.parent {
+		for alias, aliasDir := range currentCfg.packageAliases {
+			if dir != aliasDir && !strings.HasPrefix(dir, aliasDir+"/") {
+				continue
+			}
+			if foundAlias == "" || len(aliasDir) > len(foundDir) {
+				foundAlias, foundDir = alias, aliasDir
+			}
+		}
+	}
+	return foundAlias, foundDir, foundAlias != ""
+}
+
+// SetTestFixtures sets whether the package is made of test fixtures, only
+// resolvable as dependencies of the tests.
+func (c *Config) SetTestFixtures(testFixtures bool) {
+	c.testFixtures = testFixtures
+}
+
+// TestFixtures returns whether the package is made of test fixtures, only
+// resolvable as dependencies of the tests.
+func (c *Config) TestFixtures() bool {
+	return c.testFixtures
+}
+
+// AddFrozenModule adds a module frozen into the interpreter. Adding it to a
+// package also applies it to the sub-packages.
+func (c *Config) AddFrozenModule(modName string) {
+	c.frozenModules[strings.TrimSpace(modName)] = struct{}{}
+}
+
+// IsFrozenModule returns whether the given module, or one of its parent
+// modules, is frozen into the interpreter in the given package or in one of
+// the parent packages.
+func (c *Config) IsFrozenModule(modName string) bool {
+	for imp := modName; imp != ""; {
+		for currentCfg := c; currentCfg != nil; currentCfg = currentCfg.parent {
+			if _, ok := currentCfg.frozenModules[imp]; ok {
+				return true
+			}
+		}
+		i := strings.LastIndex(imp, ".")
+		if i < 0 {
+			break
+		}
+		imp = imp[:i]
+	}
+	return false
+}
+
+// SetResolutionOrder sets the order in which the resolution strategies are
+// tried. It returns an error unless each of the strategies is listed once.
+func (c *Config) SetResolutionOrder(order []ResolutionStrategyType) error {
+	listed := make(map[ResolutionStrategyType]struct{}, len(order))
+	for _, strategy := range order {
+		switch strategy {
+		case ResolutionStrategyOverride,
+			ResolutionStrategyMapping,
+			ResolutionStrategyFirstParty,
+			ResolutionStrategyStdlib:
+		default:
+			return fmt.Errorf("unknown resolution strategy %q", strategy)
+		}
+		if _, ok := listed[strategy]; ok {
+			return fmt.Errorf("resolution strategy %q listed more than once", strategy)
+		}
+		listed[strategy] = struct{}{}
+	}
+	if len(listed) != len(defaultResolutionOrder) {
+		return fmt.Errorf("expected each of the resolution strategies %q once", defaultResolutionOrder)
+	}
+	c.resolutionOrder = order
+	return nil
+}
+
+// ResolutionOrder returns the order in which the resolution strategies are
+// tried.
+func (c *Config) ResolutionOrder() []ResolutionStrategyType {
+	return c.resolutionOrder
+}
+
+// AddMigrationShim declares a shim package along with the label of its
+// preferred backing target. Adding it to a package also applies it to the
+// sub-packages.
+func (c *Config) AddMigrationShim(shimPkg string, lbl label.Label) {
+	c.migrationShims[shimPkg] = lbl
+}
+
+// FindMigrationShim returns the label of the preferred backing target of the
+// shim package containing the given module, i.e. the module itself or one of
+// its parent modules. The shims declared in the closest package win.
+func (c *Config) FindMigrationShim(modName string) (label.Label, bool) {
+	for imp := modName; imp != ""; {
+		for currentCfg := c; currentCfg != nil; currentCfg = currentCfg.parent {
+			if lbl, ok := currentCfg.migrationShims[imp]; ok {
+				return lbl, true
+			}
+		}
+		i := strings.LastIndex(imp, ".")
+		if i < 0 {
+			break
+		}
+		imp = imp[:i]
+	}
+	return label.NoLabel, false
+}
+
+// AddPipRepositoryForPath maps the Bazel packages under the given path prefix
+// to a pip repository. Adding a mapping to a package also applies it to the
+// sub-packages.
+func (c *Config) AddPipRepositoryForPath(prefix, pipRepositoryName string) {
+	c.pathPipRepositories[prefix] = pipRepositoryName
+}
+
+// pathPipRepository returns the name of the pip repository mapped to the
+// longest path prefix of the given Bazel package, in the given package or in
+// one of the parent packages up to the workspace root.
+func (c *Config) pathPipRepository(bzlPkg string) (string, bool) {
+	var foundPrefix, foundRepository string
+	for currentCfg := c; currentCfg != nil; currentCfg = currentCfg.parent {
+		for prefix, pipRepositoryName := range currentCfg.pathPipRepositories {
+			if prefix != "" && bzlPkg != prefix && !strings.HasPrefix(bzlPkg, prefix+"/") {
+				continue
+			}
+			if foundRepository == "" || len(prefix) > len(foundPrefix) {
+				foundPrefix, foundRepository = prefix, pipRepositoryName
+			}
+		}
+	}
+	return foundRepository, foundRepository != ""
+}
+
+// AddDeprecatedStdlibAlias declares a deprecated alias of the standard library
+// along with its replacement. An empty replacement stops reporting the alias.
+// Adding it to a package also applies it to the sub-packages.
+func (c *Config) AddDeprecatedStdlibAlias(alias, replacement string) {
+	c.deprecatedStdlibAliases[alias] = replacement
+}
+
+// FindDeprecatedStdlibAlias returns the replacement of the given deprecated
+// alias of the standard library. The aliases declared in the given package or
+// in one of the parent packages take precedence over the common ones.
+func (c *Config) FindDeprecatedStdlibAlias(alias string) (string, bool) {
+	for currentCfg := c; currentCfg != nil; currentCfg = currentCfg.parent {
+		if replacement, ok := currentCfg.deprecatedStdlibAliases[alias]; ok {
+			return replacement, replacement != ""
+		}
+	}
+	replacement, ok := defaultDeprecatedStdlibAliases[alias]
+	return replacement, ok
+}
+
+// SetAllowedThirdParty restricts the third-party modules the package may
+// import to the given ones, along with their submodules.
+func (c *Config) SetAllowedThirdParty(modNames []string) {
+	c.allowedThirdParty = make(map[string]struct{}, len(modNames))
+	for _, modName := range modNames {
+		c.allowedThirdParty[modName] = struct{}{}
+	}
+}
+
+// IsThirdPartyAllowed returns whether the package may import the given
+// third-party module, i.e. there's no allowlist or the module, or one of its
+// parent modules, is on it.
+func (c *Config) IsThirdPartyAllowed(modName string) bool {
+	if c.allowedThirdParty == nil {
+		return true
+	}
+	for imp := modName; imp != ""; {
+		if _, ok := c.allowedThirdParty[imp]; ok {
+			return true
+		}
+		i := strings.LastIndex(imp, ".")
+		if i < 0 {
+			break
+		}
+		imp = imp[:i]
+	}
+	return false
+}
+
+// AddResolveMany resolves the given import to all the given labels. Adding it
+// to a package also applies it to the sub-packages.
+func (c *Config) AddResolveMany(imp string, labels []label.Label) {
+	c.resolveManyOverrides[imp] = labels
+}
+
+// FindResolveMany returns the labels the given import resolves to, declared in
+// the given package or in one of the parent packages up to the workspace root.
+func (c *Config) FindResolveMany(imp string) ([]label.Label, bool) {
+	for currentCfg := c; currentCfg != nil; currentCfg = currentCfg.parent {
+		if labels, ok := currentCfg.resolveManyOverrides[imp]; ok {
+			return labels, true
+		}
+	}
+	return nil, false
+}
+
+// SetPropagateStarReexports sets whether a star re-export of a first-party
+// module adds the third-party dependencies of the target providing it.
+func (c *Config) SetPropagateStarReexports(propagateStarReexports bool) {
+	c.propagateStarReexports = propagateStarReexports
+}
+
+// PropagateStarReexports returns whether a star re-export of a first-party
+// module adds the third-party dependencies of the target providing it.
+func (c *Config) PropagateStarReexports() bool {
+	return c.propagateStarReexports
+}
+
+// SetNamespacePackages sets whether the directories without __init__.py are
+// importable from the targets providing their modules.
+func (c *Config) SetNamespacePackages(namespacePackages bool) {
+	c.namespacePackages = namespacePackages
+}
+
+// NamespacePackages returns whether the directories without __init__.py are
+// importable from the targets providing their modules.
+func (c *Config) NamespacePackages() bool {
+	return c.namespacePackages
+}
+
+// AddModuleDistribution declares the authoritative distribution of a module
+// and its submodules. Adding it to a package also applies it to the
+// sub-packages.
+func (c *Config) AddModuleDistribution(modName, distribution string) {
+	c.moduleDistributions[modName] = distribution
+}
+
+// moduleDistribution returns the authoritative distribution of the given
+// module, or of its nearest parent module, declared in the given package or in
+// one of the parent packages up to the workspace root.
+func (c *Config) moduleDistribution(modName string) (string, bool) {
+	for imp := modName; imp != ""; {
+		for currentCfg := c; currentCfg != nil; currentCfg = currentCfg.parent {
+			if distribution, ok := currentCfg.moduleDistributions[imp]; ok {
+				return distribution, true
+			}
+		}
+		i := strings.LastIndex(imp, ".")
+		if i < 0 {
+			break
+		}
+		imp = imp[:i]
+	}
+	return "", false
+}
+
+// FindConflictingDistributions scans the gazelle manifests for the current
+// config and the parent configs up to the root finding if the module name is
+// provided by multiple distributions without an authoritative one. It returns
+// the names of these distributions.
+func (c *Config) FindConflictingDistributions(modName string) ([]string, bool) {
+	if _, ok := c.moduleDistribution(modName); ok {
+		return nil, false
+	}
+	for currentCfg := c; currentCfg != nil; currentCfg = currentCfg.parent {
+		if currentCfg.gazelleManifest != nil {
+			if distributions, ok := currentCfg.gazelleManifest.ModulesMappingConflicts[modName]; ok {
+				return distributions, true
+			}
+			if _, ok := currentCfg.gazelleManifest.ModulesMapping[modName]; ok {
+				return nil, false
+			}
+		}
+	}
+	return nil, false
+}
+
+// AddGeneratedCodeRoot declares a directory, relative to the workspace root, of
+// generated code added to the Python path. Adding it to a package also applies
+// it to the sub-packages.
+func (c *Config) AddGeneratedCodeRoot(dir string) {
+	c.generatedCodeRoots[dir] = struct{}{}
+}
+
+// FindGeneratedCodeRoot returns the deepest generated code root containing the
+// given file path, relative to the workspace root.
+func (c *Config) FindGeneratedCodeRoot(p string) (string, bool) {
+	p = filepath.ToSlash(p)
+	var found string
+	for currentCfg := c; currentCfg != nil; currentCfg = currentCfg.parent {
+		for dir := range currentCfg.generatedCodeRoots {
+			if strings.HasPrefix(p, dir+"/") && len(dir) > len(found) {
+				found = dir
+			}
+		}
+	}
+	return found, found != ""
+}
+
+// SetOptionalImportsComment sets whether the dropped optional imports are
+// listed in a comment on the target.
+func (c *Config) SetOptionalImportsComment(optionalImportsComment bool) {
+	c.optionalImportsComment = optionalImportsComment
+}
+
+// OptionalImportsComment returns whether the dropped optional imports are
+// listed in a comment on the target.
+func (c *Config) OptionalImportsComment() bool {
+	return c.optionalImportsComment
+}
+
+// AddLazyImportHelper adds a lazy-import helper function. Adding it to a package
+// also applies it to the sub-packages.
+func (c *Config) AddLazyImportHelper(helper string) {
+	c.lazyImportHelpers[helper] = struct{}{}
+}
+
+// LazyImportHelpers returns the lazy-import helper functions, sorted, of the
+// given package or of one of the parent packages up to the workspace root.
+func (c *Config) LazyImportHelpers() []string {
+	helpers := make(map[string]struct{})
+	for currentCfg := c; currentCfg != nil; currentCfg = currentCfg.parent {
+		for helper := range currentCfg.lazyImportHelpers {
+			helpers[helper] = struct{}{}
+		}
+	}
+	lazyImportHelpers := make([]string, 0, len(helpers))
+	for helper := range helpers {
+		lazyImportHelpers = append(lazyImportHelpers, helper)
+	}
+	sort.Strings(lazyImportHelpers)
+	return lazyImportHelpers
+}
+
+// AddFirstPartyPrefix adds an import prefix of first-party modules not indexed
+// at resolution time. Adding it to a package also applies it to the
+// sub-packages.
+func (c *Config) AddFirstPartyPrefix(prefix string) {
+	c.firstPartyPrefixes[prefix] = struct{}{}
+}
+
+// FindFirstPartyPrefix returns the longest import prefix of first-party modules
+// not indexed at resolution time matching the given module name, declared in
+// the given package or in one of the parent packages up to the workspace root.
+func (c *Config) FindFirstPartyPrefix(modName string) (string, bool) {
+	var found string
+	for currentCfg := c; currentCfg != nil; currentCfg = currentCfg.parent {
+		for prefix := range currentCfg.firstPartyPrefixes {
+			if (modName == prefix || strings.HasPrefix(modName, prefix+".")) && len(prefix) > len(found) {
+				found = prefix
+			}
+		}
+	}
+	return found, found != ""
+}
+
+// SetRequirementsSubset restricts the distributions the given target of the
+// package may depend on.
+func (c *Config) SetRequirementsSubset(target string, distributions []string) {
+	subset := make(map[string]struct{}, len(distributions))
+	for _, distribution := range distributions {
+		subset[manifest.SanitizeDistributionName(distribution)] = struct{}{}
+	}
+	c.requirementsSubsets[target] = subset
+}
+
+// IsRequirementInSubset returns whether the given target of the package may
+// depend on the given distribution, i.e. the target has no requirements subset
+// or the distribution, regardless of its extras, is in it.
+func (c *Config) IsRequirementInSubset(target, distribution string) bool {
+	subset, ok := c.requirementsSubsets[target]
+	if !ok {
+		return true
+	}
+	distribution, _ = manifest.SplitDistributionExtras(distribution)
+	_, ok = subset[manifest.SanitizeDistributionName(distribution)]
+	return ok
+}
+
+// SetTypeOnlyImportsAsTypeDeps sets whether the imports only happening for
+// type-checking are added to the type-checking dependencies.
+func (c *Config) SetTypeOnlyImportsAsTypeDeps(typeOnlyAsTypeDeps bool) {
+	c.typeOnlyAsTypeDeps = typeOnlyAsTypeDeps
+}
+
+// TypeOnlyImportsAsTypeDeps returns whether the imports only happening for
+// type-checking are added to the type-checking dependencies.
+func (c *Config) TypeOnlyImportsAsTypeDeps() bool {
+	return c.typeOnlyAsTypeDeps
+}
+
+// SetResolveFileOverrides sets the mapping from imports, or from the package
+// patterns ending with `.*`, to the labels overriding their resolution, as
+// loaded from the resolve file.
+func (c *Config) SetResolveFileOverrides(overrides map[string]label.Label) {
+	c.resolveFileOverrides = overrides
+}
+
+// FindResolveFileOverride returns the label overriding the resolution of the
+// given module according to the resolve file. An entry for the module itself
+// takes precedence over the patterns, and the pattern of the innermost package
+// wins, i.e. `foo.bar.*` takes precedence over `foo.*`.
+func (c *Config) FindResolveFileOverride(modName string) (label.Label, bool) {
+	if lbl, ok := c.resolveFileOverrides[modName]; ok {
+		return lbl, true
+	}
+	for pkg := modName; strings.Contains(pkg, "."); {
+		pkg = pkg[:strings.LastIndex(pkg, ".")]
+		if lbl, ok := c.resolveFileOverrides[pkg+".*"]; ok {
+			return lbl, true
+		}
+	}
+	return label.NoLabel, false
+}
+
+// SetDefaultVisibility sets the visibility of the generated py_library and
+// py_binary targets. A nil visibility restores the default one.
+func (c *Config) SetDefaultVisibility(visibility []string) {
+	c.defaultVisibility = visibility
+}
+
+// DefaultVisibility returns the visibility of the generated py_library and
+// py_binary targets. It returns false if the default one, i.e. the
+// sub-packages of the Python root, applies.
+func (c *Config) DefaultVisibility() ([]string, bool) {
+	return c.defaultVisibility, len(c.defaultVisibility) > 0
+}
+
+// AddIgnoredDistribution adds a distribution whose modules add no dependency.
+// Adding a distribution to a package also ignores it in the sub-packages.
+func (c *Config) AddIgnoredDistribution(distribution string) {
+	c.ignoredDistributions[manifest.SanitizeDistributionName(strings.TrimSpace(distribution))] = struct{}{}
+}
+
+// IsDistributionIgnored returns whether the modules of the given distribution,
+// regardless of its extras, add no dependency in the given package or in one of
+// the parent packages.
+func (c *Config) IsDistributionIgnored(distribution string) bool {
+	distribution, _ = manifest.SplitDistributionExtras(distribution)
+	sanitizedDistribution := manifest.SanitizeDistributionName(distribution)
+	for currentCfg := c; currentCfg != nil; currentCfg = currentCfg.parent {
+		if _, ok := currentCfg.ignoredDistributions[sanitizedDistribution]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// SetResolvePreferClosest sets whether an ambiguous import resolves to the
+// target whose Bazel package is the closest to the importing one.
+func (c *Config) SetResolvePreferClosest(preferClosest bool) {
+	c.resolvePreferClosest = preferClosest
+}
+
+// ResolvePreferClosest returns whether an ambiguous import resolves to the
+// target whose Bazel package is the closest to the importing one.
+func (c *Config) ResolvePreferClosest() bool {
+	return c.resolvePreferClosest
+}
+
+// SetGroupDeps sets whether the generated deps list the first-party and the
+// third-party dependencies in separate groups.
+func (c *Config) SetGroupDeps(groupDeps bool) {
+	c.groupDeps = groupDeps
+}
+
+// GroupDeps returns whether the generated deps list the first-party and the
+// third-party dependencies in separate groups.
+func (c *Config) GroupDeps() bool {
+	return c.groupDeps
+}
+
+// SetIndexCython sets whether the Cython sources of the targets are indexed as
+// the modules they compile to.
+func (c *Config) SetIndexCython(indexCython bool) {
+	c.indexCython = indexCython
+}
+
+// IndexCython returns whether the Cython sources of the targets are indexed as
+// the modules they compile to.
+func (c *Config) IndexCython() bool {
+	return c.indexCython
+}
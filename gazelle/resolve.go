@@ -1,14 +1,19 @@
 package python
 
 import (
+	"crypto/sha256"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/bazelbuild/bazel-gazelle/config"
 	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/pathtools"
 	"github.com/bazelbuild/bazel-gazelle/repo"
 	"github.com/bazelbuild/bazel-gazelle/resolve"
 	"github.com/bazelbuild/bazel-gazelle/rule"
@@ -29,11 +34,75 @@ const (
 	// target that should be imported by a py_test or py_binary in the same
 	// Bazel package.
 	uuidKey = "_gazelle_python_library_uuid"
+	// resourcesKey is the attribute key used to pass the packages accessed as
+	// resources via importlib.resources. They are resolved into the data
+	// attribute instead of deps.
+	resourcesKey = "_gazelle_python_resources"
+	// pkgutilNamespacePackagesKey is the attribute key used to pass the srcs
+	// of a py_library that are __init__.py files of pkgutil-style namespace
+	// packages.
+	pkgutilNamespacePackagesKey = "_gazelle_python_pkgutil_namespace_packages"
+	// reexportedNamesKey is the attribute key used to pass the names
+	// re-exported by the srcs of a py_library that are __init__.py files,
+	// keyed by the srcs.
+	reexportedNamesKey = "_gazelle_python_reexported_names"
+	// fileRootsKey is the attribute key used to pass the Python roots
+	// overridden for single srcs via the python_file_root annotation.
+	fileRootsKey = "_gazelle_python_file_roots"
+	// testHelpersKey is the attribute key used to pass the srcs of a py_test
+	// that are embedded test helpers. They are only importable from the same
+	// Bazel package.
+	testHelpersKey = "_gazelle_python_test_helpers"
+	// pyiDepsAttr is the attribute receiving the type-checking dependencies,
+	// i.e. the targets providing the hand-written stubs of the imports.
+	pyiDepsAttr = "pyi_deps"
+	// optionalImportsCommentPrefix prefixes the comment on the targets listing
+	// the optional imports dropped from the dependencies.
+	optionalImportsCommentPrefix = "# optional: "
 )
 
 // Resolver satisfies the resolve.Resolver interface. It resolves dependencies
 // in rules generated by this extension.
-type Resolver struct{}
+type Resolver struct {
+	// generatedModules are the modules imported by the generated rules, keyed
+	// by their labels, e.g. to follow the star re-exports.
+	generatedModules map[label.Label]*treeset.Set
+	// buildFiles are the existing BUILD files the generated rules are merged
+	// into, keyed by their packages, e.g. to update the comments of the
+	// existing rules, which aren't merged.
+	buildFiles map[string]*rule.File
+	// reportedStarReexportCycles are the circular star re-export chains
+	// already reported, so that each of them is reported once.
+	reportedStarReexportCycles map[string]bool
+	// visibilities are the visibilities of the indexed rules, or the default
+	// ones of their packages, keyed by their labels, e.g. to report the
+	// dependencies on targets that aren't visible.
+	visibilities map[label.Label][]string
+	// libraryUUIDs are the labels of the generated py_library targets, keyed
+	// by their uuids, which the other rules generated in their packages import
+	// to depend on them.
+	libraryUUIDs map[string]label.Label
+	// embeddedLibraries are the labels of the generated py_library targets
+	// embedded by the other rules generated in their packages, e.g. a py_binary
+	// importing its sibling py_library through its uuid, keyed by the labels
+	// of the embedding rules.
+	embeddedLibraries map[label.Label]label.Label
+	// embedderImports are the imports provided by the srcs of the embedding
+	// rules themselves, rather than by their embedded py_library, keyed by
+	// the labels of the embedding rules.
+	embedderImports map[label.Label]map[string]bool
+	// indexedImports are the imports provided by the indexed targets that
+	// aren't importable as is, e.g. the private modules or the stubs, so they
+	// aren't indexed in the RuleIndex, keyed by the labels of the targets.
+	indexedImports map[label.Label]map[indexedImport]bool
+	// importProviders are the labels of the indexed targets providing the
+	// indexedImports, keyed by the imports.
+	importProviders map[indexedImport][]label.Label
+	// deprioritized are the labels of the indexed targets tagged with the
+	// deprioritized tag, e.g. generated targets, losing the ambiguity
+	// tie-break.
+	deprioritized map[label.Label]bool
+}
 
 // Name returns the name of the language. This is the prefix of the kinds of
 // rules generated. E.g. py_library and py_binary.
@@ -47,34 +116,340 @@ func (*Resolver) Name() string { return languageName }
 func (py *Resolver) Imports(c *config.Config, r *rule.Rule, f *rule.File) []resolve.ImportSpec {
 	cfgs := c.Exts[languageName].(pythonconfig.Configs)
 	cfg := cfgs[f.Pkg]
-	srcs := r.AttrStrings("srcs")
+	if r.Kind() == pyProtoLibraryKind {
+		return protoImports(cfg, r, f)
+	}
+	if r.Kind() == configSettingKind {
+		return nil
+	}
+	key := label.New("", f.Pkg, r.Name())
+	srcs := generatedSrcs(r.AttrStrings("srcs"), f)
 	provides := make([]resolve.ImportSpec, 0, len(srcs)+1)
+	// provided deduplicates the ImportSpecs so that multiple srcs providing the
+	// same import (e.g. foo.py and foo/__init__.py) are indexed only once.
+	provided := make(map[resolve.ImportSpec]struct{}, len(srcs)+1)
+	addProvide := func(provide resolve.ImportSpec) {
+		if _, exists := provided[provide]; exists {
+			return
+		}
+		provided[provide] = struct{}{}
+		provides = append(provides, provide)
+	}
+	var pkgutilNamespacePackages *treeset.Set
+	if r.PrivateAttr(pkgutilNamespacePackagesKey) != nil {
+		pkgutilNamespacePackages = r.PrivateAttr(pkgutilNamespacePackagesKey).(*treeset.Set)
+	}
+	var reexportedNames map[string][]string
+	if r.PrivateAttr(reexportedNamesKey) != nil {
+		reexportedNames = r.PrivateAttr(reexportedNamesKey).(map[string][]string)
+	}
+	var testHelpers *treeset.Set
+	if r.PrivateAttr(testHelpersKey) != nil {
+		testHelpers = r.PrivateAttr(testHelpersKey).(*treeset.Set)
+	}
+	// The compiled extension modules, e.g. `_native.so`, are either srcs or
+	// data of the targets providing them.
+	for _, src := range append(r.AttrStrings("data"), srcs...) {
+		srcPkg, srcFile, ok := srcPath(f.Pkg, src)
+		if !ok {
+			continue
+		}
+		if extensionSrc, ok := extensionModuleSrc(srcFile); ok {
+			pythonRoot := srcRoot(r, cfg, filepath.Join(srcPkg, srcFile))
+			addProvide(importSpecFromSrc(cfg, pythonRoot, srcPkg, extensionSrc))
+		}
+	}
+	extensionSrcs := extensionModuleSrcs(f)
+	srcSet := make(map[string]struct{}, len(srcs))
+	for _, src := range srcs {
+		srcSet[src] = struct{}{}
+	}
 	for _, src := range srcs {
-		ext := filepath.Ext(src)
-		if ext == ".py" {
-			pythonProjectRoot := cfg.PythonProjectRoot()
-			provide := importSpecFromSrc(pythonProjectRoot, f.Pkg, src)
-			provides = append(provides, provide)
+		srcPkg, srcFile, ok := srcPath(f.Pkg, src)
+		if !ok {
+			continue
+		}
+		ext := filepath.Ext(srcFile)
+		if cfg.IsStubFile(filepath.Join(srcPkg, srcFile)) {
+			stubsRoot, _ := cfg.StubsRoot()
+			provide := importSpecFromSrc(cfg, stubsRoot, srcPkg, strings.TrimSuffix(srcFile, "i"))
+			py.recordIndexedImport(key, stubImport, provide.Imp)
+		} else if ext == ".pyi" && strings.HasSuffix(srcFile, "_pb2.pyi") {
+			pythonRoot := srcRoot(r, cfg, filepath.Join(srcPkg, srcFile))
+			provide := importSpecFromSrc(cfg, pythonRoot, srcPkg, strings.TrimSuffix(srcFile, "i"))
+			py.recordIndexedImport(key, protoStubImport, provide.Imp)
+		} else if ext == ".pyi" {
+			// A stub next to its module in the same target adds nothing to the
+			// runtime dependency on the target.
+			if _, ok := srcSet[strings.TrimSuffix(src, "i")]; ok {
+				continue
+			}
+			pythonRoot := srcRoot(r, cfg, filepath.Join(srcPkg, srcFile))
+			provide := importSpecFromSrc(cfg, pythonRoot, srcPkg, strings.TrimSuffix(srcFile, "i"))
+			if extensionSrcs[filepath.Join(srcPkg, strings.TrimSuffix(srcFile, "i"))] {
+				// The stub of a compiled extension module is resolved as a
+				// type-checking dependency too.
+				py.recordIndexedImport(key, stubImport, provide.Imp)
+				continue
+			}
+			// A stubs-only target provides the module itself, e.g. a pure
+			// interface.
+			addProvide(provide)
+		} else if (ext == ".pyx" || ext == ".pxd") && cfg.IndexCython() {
+			// The Cython sources are compiled into the modules of the same
+			// names, e.g. by a custom rule.
+			pythonRoot := srcRoot(r, cfg, filepath.Join(srcPkg, srcFile))
+			addProvide(importSpecFromSrc(cfg, pythonRoot, srcPkg, strings.TrimSuffix(srcFile, ext)+".py"))
+		} else if ext == ".py" {
+			pythonRoot := srcRoot(r, cfg, filepath.Join(srcPkg, srcFile))
+			provide := importSpecFromSrc(cfg, pythonRoot, srcPkg, srcFile)
+			if testHelpers != nil && testHelpers.Contains(src) {
+				// Test helpers embedded into a py_test resolve to the test
+				// itself, but aren't importable by other targets.
+				py.recordIndexedImport(key, privateImport, provide.Imp)
+				continue
+			}
+			if !cfg.IsPublicImport(provide.Imp) {
+				// Modules outside of the declared public API surface are only
+				// importable from the same Bazel package.
+				py.recordIndexedImport(key, privateImport, provide.Imp)
+				continue
+			}
+			if cfg.IndexExportedOnly() && isPrivateImport(provide.Imp) {
+				py.recordIndexedImport(key, privateImport, provide.Imp)
+				continue
+			}
+			addProvide(provide)
+			if cfg.NamespacePackages() {
+				if namespaceProvide, ok := namespacePackageImportSpec(c, cfg, pythonRoot, srcPkg, srcFile); ok {
+					addProvide(namespaceProvide)
+				}
+			}
+			if cfg.TracksMovedModules() {
+				if contentHash, ok := fileContentHash(filepath.Join(c.RepoRoot, srcPkg, srcFile)); ok {
+					py.recordIndexedImport(key, contentHashImport, contentHash)
+				}
+			}
+			if pkgutilNamespacePackages != nil && pkgutilNamespacePackages.Contains(src) {
+				py.recordIndexedImport(key, pkgutilNamespacePackageImport, provide.Imp)
+			}
+			for _, name := range reexportedNames[src] {
+				py.recordIndexedImport(key, reexportedNameImport, provide.Imp+"."+name)
+			}
+			if cfg.ResolveStarImports() {
+				for pythonPkg := provide.Imp; strings.Contains(pythonPkg, "."); {
+					pythonPkg = pythonPkg[:strings.LastIndex(pythonPkg, ".")]
+					py.recordIndexedImport(key, submoduleImport, pythonPkg)
+				}
+			}
 		}
 	}
-	if r.PrivateAttr(uuidKey) != nil {
-		provide := resolve.ImportSpec{
-			Lang: languageName,
-			Imp:  r.PrivateAttr(uuidKey).(string),
+	if hasTag(r, cfg.DeprioritizedTag()) {
+		if py.deprioritized == nil {
+			py.deprioritized = make(map[label.Label]bool)
 		}
-		provides = append(provides, provide)
+		py.deprioritized[key] = true
 	}
-	if len(provides) == 0 {
+	if len(provides) == 0 && len(py.indexedImports[key]) == 0 {
 		return nil
 	}
+	py.recordVisibility(r, f)
+	py.recordEmbedderImports(r, f, provides)
 	return provides
 }
 
+// recordEmbedderImports records the imports provided by the indexed rule if it
+// embeds its sibling py_library, so that they're told apart from the imports
+// of the library it inherits.
+func (py *Resolver) recordEmbedderImports(r *rule.Rule, f *rule.File, provides []resolve.ImportSpec) {
+	key := label.New("", f.Pkg, r.Name())
+	if _, ok := py.embeddedLibraries[key]; !ok {
+		return
+	}
+	imports := make(map[string]bool, len(provides))
+	for _, provide := range provides {
+		imports[provide.Imp] = true
+	}
+	if py.embedderImports == nil {
+		py.embedderImports = make(map[label.Label]map[string]bool)
+	}
+	py.embedderImports[key] = imports
+}
+
+// findRulesByImportWithConfig returns the rules indexed with the given import
+// by this extension, like RuleIndex.FindRulesByImportWithConfig. The
+// generated rules embedding their sibling py_library are indexed with the
+// imports of the library, which are resolved to the library itself.
+func (py *Resolver) findRulesByImportWithConfig(
+	c *config.Config,
+	ix *resolve.RuleIndex,
+	imp resolve.ImportSpec,
+) []resolve.FindResult {
+	matches := ix.FindRulesByImportWithConfig(c, imp, languageName)
+	if len(py.embeddedLibraries) == 0 {
+		return matches
+	}
+	results := make([]resolve.FindResult, 0, len(matches))
+	seen := make(map[label.Label]bool, len(matches))
+	for _, match := range matches {
+		if match.Label.Repo == "" || match.Label.Repo == c.RepoName {
+			key := label.New("", match.Label.Pkg, match.Label.Name)
+			if library, ok := py.embeddedLibraries[key]; ok && !py.embedderImports[key][imp.Imp] {
+				match = resolve.FindResult{Label: label.New(match.Label.Repo, library.Pkg, library.Name)}
+			}
+		}
+		if seen[match.Label] {
+			continue
+		}
+		seen[match.Label] = true
+		results = append(results, match)
+	}
+	return results
+}
+
+// recordVisibility records the visibility of the indexed rule, defaulting to
+// the default visibility of its package, which is private unless set.
+func (py *Resolver) recordVisibility(r *rule.Rule, f *rule.File) {
+	visibility := r.AttrStrings("visibility")
+	if len(visibility) == 0 {
+		visibility = []string{"//visibility:private"}
+		for _, fr := range f.Rules {
+			if fr.Kind() == "package" && len(fr.AttrStrings("default_visibility")) > 0 {
+				visibility = fr.AttrStrings("default_visibility")
+			}
+		}
+	}
+	if py.visibilities == nil {
+		py.visibilities = make(map[label.Label][]string)
+	}
+	py.visibilities[label.New("", f.Pkg, r.Name())] = visibility
+}
+
+// isVisibleTo returns whether a target of the given Bazel package with the
+// given visibility is visible to the other given Bazel package. The
+// package_group targets and the labels of external repositories can't be
+// evaluated, so they're assumed to grant the visibility.
+func isVisibleTo(visibility []string, targetPkg, fromPkg string) bool {
+	if targetPkg == fromPkg {
+		return true
+	}
+	for _, v := range visibility {
+		lbl, err := label.Parse(v)
+		if err != nil || lbl.Repo != "" {
+			return true
+		}
+		if lbl.Relative {
+			lbl.Pkg = targetPkg
+		}
+		switch {
+		case lbl.Pkg == "visibility" && lbl.Name == "public":
+			return true
+		case lbl.Pkg == "visibility" && lbl.Name == "private":
+		case lbl.Name == "__pkg__":
+			if fromPkg == lbl.Pkg {
+				return true
+			}
+		case lbl.Name == "__subpackages__":
+			if isUnderDir(fromPkg, lbl.Pkg) {
+				return true
+			}
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// generatedSrcs expands the srcs naming rules from the same BUILD file, e.g. a
+// genrule generating an __init__.py, to the outs of these rules, so that the
+// generated modules are indexed along with the hand-written ones.
+func generatedSrcs(srcs []string, f *rule.File) []string {
+	outs := make(map[string][]string)
+	for _, fr := range f.Rules {
+		if ruleOuts := fr.AttrStrings("outs"); len(ruleOuts) > 0 {
+			outs[fr.Name()] = ruleOuts
+		}
+	}
+	if len(outs) == 0 {
+		return srcs
+	}
+	expanded := make([]string, 0, len(srcs))
+	for _, src := range srcs {
+		lbl, err := label.Parse(src)
+		if err == nil && lbl.Repo == "" && (lbl.Relative || lbl.Pkg == f.Pkg) {
+			if ruleOuts, ok := outs[lbl.Name]; ok {
+				expanded = append(expanded, ruleOuts...)
+				continue
+			}
+		}
+		expanded = append(expanded, src)
+	}
+	return expanded
+}
+
+// extensionModuleSrc returns the path of the Python module provided by the
+// given compiled extension module, e.g. `_native.py` for
+// `_native.cpython-39-x86_64-linux-gnu.so`. It returns false if the file isn't
+// an extension module.
+func extensionModuleSrc(srcFile string) (string, bool) {
+	ext := filepath.Ext(srcFile)
+	if ext != ".so" && ext != ".pyd" {
+		return "", false
+	}
+	dir, filename := filepath.Split(srcFile)
+	return filepath.Join(dir, strings.SplitN(filename, ".", 2)[0]+".py"), true
+}
+
+// extensionModuleSrcs returns the paths of the modules compiled into the
+// extension modules provided by the targets of the BUILD file, e.g.
+// `pkg/_native.py` for `_native.so`, whichever target provides their stubs.
+func extensionModuleSrcs(f *rule.File) map[string]bool {
+	extensionSrcs := make(map[string]bool)
+	for _, fr := range f.Rules {
+		for _, src := range append(fr.AttrStrings("data"), fr.AttrStrings("srcs")...) {
+			srcPkg, srcFile, ok := srcPath(f.Pkg, src)
+			if !ok {
+				continue
+			}
+			if extensionSrc, ok := extensionModuleSrc(srcFile); ok {
+				extensionSrcs[filepath.Join(srcPkg, extensionSrc)] = true
+			}
+		}
+	}
+	return extensionSrcs
+}
+
+// srcPath returns the Bazel package and the path, relative to this package, of
+// the given src of a target in the given Bazel package. The src is either a
+// path relative to the package of the target or a label, e.g.
+// `//other:gen.py`, pulling the source from another package. It returns false
+// for the labels of external repositories.
+func srcPath(bzlPkg, src string) (string, string, bool) {
+	if !strings.HasPrefix(src, "//") && !strings.HasPrefix(src, ":") && !strings.HasPrefix(src, "@") {
+		return bzlPkg, src, true
+	}
+	lbl, err := label.Parse(src)
+	if err != nil || lbl.Repo != "" {
+		return "", "", false
+	}
+	if lbl.Relative {
+		return bzlPkg, lbl.Name, true
+	}
+	return lbl.Pkg, lbl.Name, true
+}
+
 // importSpecFromSrc determines the ImportSpec based on the target that contains the src so that
 // the target can be indexed for import statements that match the calculated src relative to the its
-// Python project root.
-func importSpecFromSrc(pythonProjectRoot, bzlPkg, src string) resolve.ImportSpec {
+// Python project root. Both __init__.py and the configured library entrypoint filename provide the
+// Python package itself. The srcs under a directory aliased by a top-level import alias are
+// relative to this directory instead, under the alias. The module name transforms of the config
+// are applied to the import.
+func importSpecFromSrc(cfg *pythonconfig.Config, pythonProjectRoot, bzlPkg, src string) resolve.ImportSpec {
 	pythonPkgDir := filepath.Join(bzlPkg, filepath.Dir(src))
+	alias, aliasDir, aliased := cfg.FindPackageAlias(pythonPkgDir)
+	if aliased {
+		pythonProjectRoot = aliasDir
+	}
 	relPythonPkgDir, err := filepath.Rel(pythonProjectRoot, pythonPkgDir)
 	if err != nil {
 		panic(fmt.Errorf("unexpected failure: %v", err))
@@ -83,12 +458,17 @@ func importSpecFromSrc(pythonProjectRoot, bzlPkg, src string) resolve.ImportSpec
 		relPythonPkgDir = ""
 	}
 	pythonPkg := strings.ReplaceAll(relPythonPkgDir, "/", ".")
+	if aliased && pythonPkg != "" {
+		pythonPkg = alias + "." + pythonPkg
+	} else if aliased {
+		pythonPkg = alias
+	}
 	filename := filepath.Base(src)
-	if filename == pyLibraryEntrypointFilename {
+	if filename == pyLibraryEntrypointFilename || filename == cfg.LibraryEntrypointFilename() {
 		if pythonPkg != "" {
 			return resolve.ImportSpec{
 				Lang: languageName,
-				Imp:  pythonPkg,
+				Imp:  cfg.TransformModuleName(pythonPkg),
 			}
 		}
 	}
@@ -101,17 +481,413 @@ func importSpecFromSrc(pythonProjectRoot, bzlPkg, src string) resolve.ImportSpec
 	}
 	return resolve.ImportSpec{
 		Lang: languageName,
-		Imp:  imp,
+		Imp:  cfg.TransformModuleName(imp),
+	}
+}
+
+// namespacePackageImportSpec returns the ImportSpec of the PEP 420 implicit
+// namespace package, i.e. the directory without __init__.py, containing the
+// given src. It returns false if the directory is the Python root or provides
+// a regular package.
+func namespacePackageImportSpec(c *config.Config, cfg *pythonconfig.Config, pythonRoot, bzlPkg, src string) (resolve.ImportSpec, bool) {
+	pythonPkgDir := filepath.Join(bzlPkg, filepath.Dir(src))
+	if relDir, err := filepath.Rel(pythonRoot, pythonPkgDir); err != nil || relDir == "." || strings.HasPrefix(relDir, "..") {
+		return resolve.ImportSpec{}, false
+	}
+	for _, filename := range []string{pyLibraryEntrypointFilename, cfg.LibraryEntrypointFilename()} {
+		if _, err := os.Stat(filepath.Join(c.RepoRoot, pythonPkgDir, filename)); err == nil {
+			return resolve.ImportSpec{}, false
+		}
+	}
+	return importSpecFromSrc(cfg, pythonRoot, bzlPkg, filepath.Join(filepath.Dir(src), pyLibraryEntrypointFilename)), true
+}
+
+// protoImports returns the ImportSpecs of the `_pb2` modules generated by a
+// py_proto_library from the srcs of the proto_library targets it depends on in
+// the same Bazel package.
+func protoImports(cfg *pythonconfig.Config, r *rule.Rule, f *rule.File) []resolve.ImportSpec {
+	protoLibraries := make(map[string]*rule.Rule)
+	for _, fr := range f.Rules {
+		if fr.Kind() == protoLibraryKind {
+			protoLibraries[fr.Name()] = fr
+		}
+	}
+	var provides []resolve.ImportSpec
+	for _, dep := range r.AttrStrings("deps") {
+		lbl, err := label.Parse(dep)
+		if err != nil || lbl.Repo != "" || (!lbl.Relative && lbl.Pkg != f.Pkg) {
+			continue
+		}
+		protoLibrary, ok := protoLibraries[lbl.Name]
+		if !ok {
+			continue
+		}
+		for _, src := range protoLibrary.AttrStrings("srcs") {
+			if filepath.Ext(src) != ".proto" {
+				continue
+			}
+			pyModule := strings.TrimSuffix(src, ".proto") + "_pb2.py"
+			provides = append(provides, importSpecFromSrc(cfg, cfg.PythonProjectRoot(), f.Pkg, pyModule))
+		}
+	}
+	return provides
+}
+
+// fileRoot returns the Python root of the given file path, relative to the
+// Bazel workspace root, which is the project root unless overridden for the
+// file via the python_file_root annotation.
+func fileRoot(r *rule.Rule, pythonProjectRoot, filePath string) string {
+	if fileRoots, ok := r.PrivateAttr(fileRootsKey).(map[string]string); ok {
+		if root, ok := fileRoots[filePath]; ok {
+			return root
+		}
+	}
+	return pythonProjectRoot
+}
+
+// srcRoot returns the Python root of the given source file, relative to the
+// workspace root, of a rule. The generated code roots take precedence over the
+// Python roots.
+func srcRoot(r *rule.Rule, cfg *pythonconfig.Config, filePath string) string {
+	if root, ok := cfg.FindGeneratedCodeRoot(filePath); ok {
+		return root
+	}
+	return fileRoot(r, cfg.PythonProjectRoot(), filePath)
+}
+
+// isPrivateImport returns whether the given import refers to a private
+// module, i.e. any of its components is prefixed with an underscore.
+func isPrivateImport(imp string) bool {
+	for _, component := range strings.Split(imp, ".") {
+		if strings.HasPrefix(component, "_") {
+			return true
+		}
+	}
+	return false
+}
+
+// privateModuleOwner returns the Python package defining the innermost private
+// component of the given module, i.e. prefixed with an underscore, e.g. `other`
+// for `other._internal.x`. The dunder components, e.g. `__about__`, aren't
+// private.
+func privateModuleOwner(imp string) (string, bool) {
+	components := strings.Split(imp, ".")
+	for i := len(components) - 1; i >= 0; i-- {
+		component := components[i]
+		if strings.HasPrefix(component, "_") && !(strings.HasPrefix(component, "__") && strings.HasSuffix(component, "__")) {
+			return strings.Join(components[:i], "."), true
+		}
+	}
+	return "", false
+}
+
+// findRulesByImport returns the rules indexed with the given import by this
+// extension or, if none, by the other extensions whose Python imports are
+// honored. The RuleIndex only finds the rules indexed by the extension named
+// after the given language, even for ImportSpecs of the same language.
+func (py *Resolver) findRulesByImport(
+	c *config.Config,
+	ix *resolve.RuleIndex,
+	cfg *pythonconfig.Config,
+	imp resolve.ImportSpec,
+) []resolve.FindResult {
+	matches := py.findRulesByImportWithConfig(c, ix, imp)
+	if len(matches) > 0 {
+		return matches
+	}
+	for _, lang := range cfg.CrossResolveLanguages() {
+		matches = append(matches, ix.FindRulesByImportWithConfig(c, imp, lang)...)
+	}
+	return matches
+}
+
+// implicitRelativeImport returns the import of the sibling module, i.e. from
+// the same Python package, of the file importing the given module. It returns
+// false if the file is at the Python root, where implicit relative imports
+// are absolute imports.
+func implicitRelativeImport(pythonRoot, filePath, imp string) (string, bool) {
+	relDir, err := filepath.Rel(pythonRoot, filepath.Dir(filePath))
+	if err != nil || relDir == "." || strings.HasPrefix(relDir, "..") {
+		return "", false
+	}
+	return strings.ReplaceAll(relDir, "/", ".") + "." + imp, true
+}
+
+// relativeImportCandidates returns the absolute module names the relative
+// import of the given module may refer to, from the most specific one, e.g.
+// `pkg.name` then `pkg` for `from . import name` in `pkg/__init__.py`. It
+// returns none if the file isn't under the Python root, and an error if the
+// import goes beyond its top-level package, e.g. `from .. import name` in a
+// top-level package.
+func relativeImportCandidates(pythonRoot string, mod module) ([]string, error) {
+	relModName := strings.TrimLeft(mod.Name, ".")
+	level := len(mod.Name) - len(relModName)
+	relDir, err := filepath.Rel(pythonRoot, filepath.Dir(mod.Filepath))
+	if err != nil || strings.HasPrefix(relDir, "..") {
+		return nil, nil
+	}
+	var parts []string
+	if relDir != "." {
+		parts = strings.Split(relDir, string(filepath.Separator))
+	}
+	if level > len(parts) {
+		// The Python root is a directory of the Python path, not a Python
+		// package, so the top-level package is the outermost importable one.
+		if pythonRoot == "" {
+			pythonRoot = "."
+		}
+		return nil, fmt.Errorf("the relative import %q at line %d in %q goes beyond the top-level package "+
+			"under the Python root %q", mod.Name, mod.LineNumber, mod.Filepath, pythonRoot)
+	}
+	base := parts[:len(parts)-(level-1)]
+	absParts := append(append([]string{}, base...), strings.Split(relModName, ".")...)
+	candidates := make([]string, 0, len(absParts))
+	for i := len(absParts); i > 0 && i >= len(base); i-- {
+		candidates = append(candidates, strings.Join(absParts[:i], "."))
+	}
+	return candidates, nil
+}
+
+// resolveRelativeImport returns the absolute name of the first-party module
+// imported relatively by the given module, e.g. `from .sibling import name`.
+// It returns false if none of the candidate modules is indexed, and an error if
+// the import goes beyond the Python root.
+func (py *Resolver) resolveRelativeImport(
+	c *config.Config,
+	ix *resolve.RuleIndex,
+	cfg *pythonconfig.Config,
+	pythonRoot string,
+	mod module,
+	from label.Label,
+) (string, bool, error) {
+	candidates, err := relativeImportCandidates(pythonRoot, mod)
+	if err != nil {
+		return "", false, err
+	}
+	for _, candidate := range candidates {
+		imp := resolve.ImportSpec{Lang: languageName, Imp: cfg.TransformModuleName(candidate)}
+		if len(py.findRulesByImport(c, ix, cfg, imp)) > 0 {
+			return candidate, true, nil
+		}
+		privateMatches := py.findIndexedImport(c, privateImport, imp.Imp)
+		if len(samePackageResults(privateMatches, from)) > 0 {
+			return candidate, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// fileContentHash returns the hex-encoded SHA-256 hash of the content of the
+// given file. It returns false if the file can't be read, e.g. if it's
+// generated.
+func fileContentHash(filePath string) (string, bool) {
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return "", false
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(content)), true
+}
+
+// reportMovedModule reports the import of a module that no longer resolves but
+// whose content, as recorded at the baseline, is now provided by other
+// targets.
+func (py *Resolver) reportMovedModule(
+	c *config.Config,
+	cfg *pythonconfig.Config,
+	report *sarifReport,
+	mod module,
+	from label.Label,
+) {
+	contentHash, ok := cfg.BaselineContentHash(mod.Name)
+	if !ok {
+		return
+	}
+	matches := py.findIndexedImport(c, contentHashImport, contentHash)
+	if len(matches) == 0 {
+		return
+	}
+	log.Printf("MIGRATION: in the target %q, the file %q imports %q at line %d, "+
+		"which no longer resolves but whose content at the baseline is now provided by %s\n",
+		from.String(), mod.Filepath, mod.Name, mod.LineNumber, targetListFromResults(matches))
+	report.record(resolutionIssue{
+		kind: movedModuleIssue,
+		message: fmt.Sprintf("%q no longer resolves but its content at the baseline is now provided by %s",
+			mod.Name, targetListFromResults(matches)),
+		filepath:   mod.Filepath,
+		lineNumber: mod.LineNumber,
+	})
+}
+
+// reportDeprecatedStdlibAliases reports the imports of the deprecated aliases of
+// the standard library, i.e. of the given module itself or of the names
+// imported from it, e.g. `from collections import Mapping`.
+func reportDeprecatedStdlibAliases(cfg *pythonconfig.Config, report *sarifReport, mod module) {
+	if replacement, ok := cfg.FindDeprecatedStdlibAlias(mod.Name); ok {
+		reportDeprecatedStdlibAlias(report, mod.Name, replacement, mod.Filepath, mod.LineNumber)
+	}
+	for _, name := range mod.Names {
+		alias := mod.Name + "." + name.Name
+		if replacement, ok := cfg.FindDeprecatedStdlibAlias(alias); ok {
+			reportDeprecatedStdlibAlias(report, alias, replacement, name.Filepath, name.LineNumber)
+		}
+	}
+}
+
+// reportDeprecatedStdlibAlias logs a warning for the import of the given
+// deprecated alias and records it in the report.
+func reportDeprecatedStdlibAlias(report *sarifReport, alias, replacement, file string, lineNumber uint32) {
+	err := fmt.Errorf("the file %q imports %q at line %d, a deprecated alias of %q",
+		file, alias, lineNumber, replacement)
+	log.Println("WARNING: ", err)
+	report.record(resolutionIssue{
+		kind:       deprecatedImportIssue,
+		message:    fmt.Sprintf("%q is a deprecated alias of %q", alias, replacement),
+		filepath:   file,
+		lineNumber: lineNumber,
+	})
+}
+
+// hasTag returns whether the rule has the given tag in its tags attribute.
+func hasTag(r *rule.Rule, tag string) bool {
+	if tag == "" {
+		return false
+	}
+	for _, t := range r.AttrStrings("tags") {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutDeprioritized returns the results without the targets tagged with
+// the deprioritized tag. All the results are returned if none of them would be
+// left.
+func (py *Resolver) withoutDeprioritized(c *config.Config, results []resolve.FindResult) []resolve.FindResult {
+	kept := make([]resolve.FindResult, 0, len(results))
+	for _, result := range results {
+		lbl := result.Label
+		if (lbl.Repo == "" || lbl.Repo == c.RepoName) && py.deprioritized[label.New("", lbl.Pkg, lbl.Name)] {
+			continue
+		}
+		kept = append(kept, result)
+	}
+	if len(kept) == 0 {
+		return results
+	}
+	return kept
+}
+
+// sameRootResults returns the results from the Bazel packages under the given
+// Python root. The packages under a nested Python root, e.g. `a/src` inside
+// `a`, belong to their nearest enclosing root only.
+func sameRootResults(cfgs pythonconfig.Configs, results []resolve.FindResult, pythonRoot string) []resolve.FindResult {
+	sameRoot := make([]resolve.FindResult, 0, len(results))
+	for _, result := range results {
+		if !isUnderDir(result.Label.Pkg, pythonRoot) {
+			continue
+		}
+		if cfg, ok := cfgs[result.Label.Pkg]; ok {
+			resultRoot := cfg.PythonProjectRoot()
+			if resultRoot != pythonRoot && isUnderDir(resultRoot, pythonRoot) {
+				continue
+			}
+		}
+		sameRoot = append(sameRoot, result)
+	}
+	return sameRoot
+}
+
+// isUnderDir returns whether the given slash-separated path is the given
+// directory or under it. Every path is under the empty directory.
+func isUnderDir(p, dir string) bool {
+	return dir == "" || p == dir || strings.HasPrefix(p, dir+"/")
+}
+
+// closestResults returns the results from the Bazel packages sharing the
+// longest path prefix, in path components, with the given Bazel package.
+func closestResults(results []resolve.FindResult, pkg string) []resolve.FindResult {
+	closest := make([]resolve.FindResult, 0, len(results))
+	longest := -1
+	for _, result := range results {
+		prefix := commonPathPrefixLen(result.Label.Pkg, pkg)
+		if prefix > longest {
+			closest, longest = closest[:0], prefix
+		}
+		if prefix == longest {
+			closest = append(closest, result)
+		}
+	}
+	return closest
+}
+
+// commonPathPrefixLen returns the number of leading path components shared by
+// the given slash-separated paths.
+func commonPathPrefixLen(a, b string) int {
+	if a == "" || b == "" {
+		return 0
+	}
+	aParts, bParts := strings.Split(a, "/"), strings.Split(b, "/")
+	n := 0
+	for n < len(aParts) && n < len(bParts) && aParts[n] == bParts[n] {
+		n++
+	}
+	return n
+}
+
+// samePackageResults returns the results from the same Bazel package as the
+// given label.
+func samePackageResults(results []resolve.FindResult, from label.Label) []resolve.FindResult {
+	samePackage := make([]resolve.FindResult, 0, len(results))
+	for _, result := range results {
+		if result.Label.Repo == from.Repo && result.Label.Pkg == from.Pkg {
+			samePackage = append(samePackage, result)
+		}
+	}
+	return samePackage
+}
+
+// pkgutilNamespacePackagePortions returns the given matches if all of them
+// are targets contributing to the same pkgutil-style namespace package, i.e.
+// the import is satisfied by the combined __path__ of all of them. Otherwise,
+// it returns nil.
+func (py *Resolver) pkgutilNamespacePackagePortions(
+	c *config.Config,
+	imp string,
+	matches []resolve.FindResult,
+) []resolve.FindResult {
+	if len(matches) < 2 {
+		return nil
+	}
+	for _, match := range matches {
+		if !py.providesIndexedImport(c, match.Label, pkgutilNamespacePackageImport, imp) {
+			return nil
+		}
 	}
+	return matches
 }
 
 // Embeds returns a list of labels of rules that the given rule embeds. If
 // a rule is embedded by another importable rule of the same language, only
 // the embedding rule will be indexed. The embedding rule will inherit
-// the imports of the embedded rule.
+// the imports of the embedded rule. The embedded rules are the ones listed
+// in the embed attribute, e.g. of a macro wrapping a py_binary and the
+// py_library it embeds, and the generated py_library imported through its
+// uuid by the other rules generated in its package, e.g. the py_binary.
 func (py *Resolver) Embeds(r *rule.Rule, from label.Label) []label.Label {
-	// TODO(f0rmiga): implement.
-	return make([]label.Label, 0)
+	embeds := r.AttrStrings("embed")
+	labels := make([]label.Label, 0, len(embeds)+1)
+	for _, embed := range embeds {
+		lbl, err := label.Parse(embed)
+		if err != nil {
+			continue
+		}
+		labels = append(labels, lbl.Abs(from.Repo, from.Pkg))
+	}
+	if library, ok := py.embeddedLibraries[label.New("", from.Pkg, from.Name)]; ok {
+		labels = append(labels, label.New(from.Repo, library.Pkg, library.Name))
+	}
+	return labels
 }
 
 // Resolve translates imported libraries for a given rule into Bazel
@@ -131,112 +907,508 @@ func (py *Resolver) Resolve(
 	// TODO(f0rmiga): may need to be defensive here once this Gazelle extension
 	// join with the main Gazelle binary with other rules. It may conflict with
 	// other generators that generate py_* targets.
+	// The fatal errors are reported once all the generated targets are
+	// resolved.
+	defer fatalErrors.resolved(from)
+	if r.Kind() == configSettingKind {
+		return
+	}
 	deps := treeset.NewWith(godsutils.StringComparator)
+	// typeDeps are the type-checking dependencies, i.e. on the targets
+	// providing the hand-written stubs of the imports.
+	typeDeps := treeset.NewWith(godsutils.StringComparator)
+	// platformDeps are the dependencies specific to some platforms, keyed by
+	// the selection of the platforms.
+	platformDeps := make(map[platformSelection]*treeset.Set)
+	// optionalModules are the optional imports dropped from the dependencies,
+	// listed in a comment on the target if enabled.
+	optionalModules := treeset.NewWith(godsutils.StringComparator)
+	// invisibleDeps are the first-party dependencies already reported as not
+	// visible to the target.
+	invisibleDeps := make(map[string]bool)
+	// thirdPartyDeps are the dependencies resolved from the third-party
+	// modules, told apart from the first-party ones when grouping the deps.
+	thirdPartyDeps := treeset.NewWith(godsutils.StringComparator)
 	if modulesRaw != nil {
 		cfgs := c.Exts[languageName].(pythonconfig.Configs)
 		cfg := cfgs[from.Pkg]
 		pythonProjectRoot := cfg.PythonProjectRoot()
 		modules := modulesRaw.(*treeset.Set)
 		it := modules.Iterator()
+		// EXPLAIN_DEPENDENCY matches either a dependency label, explaining why
+		// it's added, or an imported module name, explaining why the module
+		// adds no dependency.
 		explainDependency := os.Getenv("EXPLAIN_DEPENDENCY")
-		hasFatalError := false
+		report := resolutionReport(c)
 	MODULE_LOOP:
 		for it.Next() {
 			mod := it.Value().(module)
-			imp := resolve.ImportSpec{Lang: languageName, Imp: mod.Name}
-			if override, ok := resolve.FindRuleWithOverride(c, imp, languageName); ok {
-				if override.Repo == "" {
-					override.Repo = from.Repo
+			if library, ok := py.libraryUUIDs[mod.Name]; ok {
+				// The generated rules depend on the sibling py_library they
+				// embed through its uuid, which isn't an import.
+				deps.Add(label.New(from.Repo, library.Pkg, library.Name).Rel(from.Repo, from.Pkg).String())
+				continue MODULE_LOOP
+			}
+			if !conditionsHold(cfg.PythonVersion(), mod.Conditions) {
+				// The import is guarded by a condition that doesn't hold for the
+				// targeted Python version, e.g. `if sys.version_info[0] == 2:`.
+				continue MODULE_LOOP
+			}
+			if !alternativeResolved(cfg.ConditionalAlternatives(), mod.Alternative) {
+				// The import is from a branch of an if/else statement excluded
+				// by the policy, e.g. `else: import b`.
+				continue MODULE_LOOP
+			}
+			if mod.Confidence != "" && !dynamicImportResolved(cfg.DynamicImportsMinConfidence(), mod.Confidence) {
+				if cfg.DynamicImportsMinConfidence() != pythonconfig.DynamicImportsConfidenceNone {
+					log.Printf("INFO: in the target %q, the file %q dynamically imports %q at line %d "+
+						"with a %s confidence, below the minimum set by the %q directive\n",
+						from.String(), mod.Filepath, mod.Name, mod.LineNumber, mod.Confidence,
+						pythonconfig.DynamicImportsMinConfidenceDirective)
 				}
-				if !override.Equal(from) {
-					if override.Repo == from.Repo {
-						override.Repo = ""
-					}
-					dep := override.String()
-					deps.Add(dep)
-					if explainDependency == dep {
-						log.Printf("Explaining dependency (%s): "+
-							"in the target %q, the file %q imports %q at line %d, "+
-							"which resolves using the \"gazelle:resolve\" directive.\n",
-							explainDependency, from.String(), mod.Filepath, mod.Name, mod.LineNumber)
+				continue MODULE_LOOP
+			}
+			if strings.HasPrefix(mod.Name, ".") {
+				if !cfg.ResolveRelativeImports() {
+					continue MODULE_LOOP
+				}
+				// The relative imports that don't resolve to a first-party
+				// module, e.g. from a name defined by the Python package
+				// provided by the same target, add no dependency.
+				pythonRoot := fileRoot(r, pythonProjectRoot, mod.Filepath)
+				absModName, ok, err := py.resolveRelativeImport(c, ix, cfg, pythonRoot, mod, from)
+				if err != nil {
+					fatalErrors.add(from, err)
+					continue MODULE_LOOP
+				}
+				if !ok {
+					continue MODULE_LOOP
+				}
+				mod.RelativeName, mod.Name = mod.Name, absModName
+			}
+			// The imports of the deprecated aliases of the standard library
+			// are reported without changing the resolution.
+			reportDeprecatedStdlibAliases(cfg, report, mod)
+			// The imports with hand-written stubs under the stubs root depend
+			// on the stubs for type-checking only, in addition to the runtime
+			// dependencies, if any.
+			stubs := py.findIndexedImport(c, stubImport, cfg.TransformModuleName(mod.Name))
+			for _, stub := range stubs {
+				if stub.IsSelfImport(from) {
+					continue
+				}
+				dep := stub.Label.Rel(from.Repo, from.Pkg).String()
+				typeDeps.Add(dep)
+				explainAddedDependency(explainDependency, dep, from, mod,
+					"resolves from the first-party indexed labels providing its stub")
+			}
+			// The imports guarded by platform checks, e.g.
+			// `if platform.system() == "Linux":`, are dependencies on the
+			// platform only.
+			moduleDeps := deps
+			if mod.TypeOnly && cfg.TypeOnlyImportsAsTypeDeps() {
+				// The imports only happening for type-checking aren't needed
+				// at runtime.
+				moduleDeps = typeDeps
+			} else if platform, ok := platformConstraint(mod.Conditions); !ok {
+				explainModule(explainDependency, from, mod, "the import is guarded by a platform check no known platform passes")
+				continue MODULE_LOOP
+			} else if !platform.isAll() {
+				if _, ok := platformDeps[platform]; !ok {
+					platformDeps[platform] = treeset.NewWith(godsutils.StringComparator)
+				}
+				moduleDeps = platformDeps[platform]
+			}
+			if mod.StarImport && cfg.ResolveStarImports() {
+				// A star import of a package may load any of its submodules,
+				// e.g. plugins discovered dynamically.
+				submodules := py.findIndexedImport(c, submoduleImport, cfg.TransformModuleName(mod.Name))
+				for _, submodule := range submodules {
+					if submodule.IsSelfImport(from) {
+						continue
 					}
+					dep := submodule.Label.Rel(from.Repo, from.Pkg).String()
+					moduleDeps.Add(dep)
+					explainAddedDependency(explainDependency, dep, from, mod,
+						"resolves from the first-party indexed labels providing its submodules")
 				}
-			} else {
-				if dep, ok := cfg.FindThirdPartyDependency(mod.Name); ok {
-					deps.Add(dep)
-					if explainDependency == dep {
-						log.Printf("Explaining dependency (%s): "+
-							"in the target %q, the file %q imports %q at line %d, "+
-							"which resolves from the third-party module %q from the wheel %q.\n",
-							explainDependency, from.String(), mod.Filepath, mod.Name, mod.LineNumber, mod.Name, dep)
-					}
-				} else {
-					matches := ix.FindRulesByImportWithConfig(c, imp, languageName)
-					if len(matches) == 0 {
-						// Check if the imported module is part of the standard library.
-						if isStd, err := isStdModule(mod); err != nil {
-							log.Println("ERROR: ", err)
-							hasFatalError = true
-							continue MODULE_LOOP
-						} else if isStd {
+			}
+			if mod.StarImport && cfg.PropagateStarReexports() {
+				// The consumers of the re-exported names need the third-party
+				// dependencies of the re-exported module as well.
+				imp := resolve.ImportSpec{Lang: languageName, Imp: cfg.TransformModuleName(mod.Name)}
+				for _, match := range py.findRulesByImport(c, ix, cfg, imp) {
+					if match.IsSelfImport(from) {
+						continue
+					}
+					for _, dep := range py.starReexportedThirdPartyDeps(c, ix, match.Label, make(map[label.Label]bool), nil) {
+						moduleDeps.Add(dep)
+						thirdPartyDeps.Add(dep)
+						explainAddedDependency(explainDependency, dep, from, mod,
+							"re-exports from %q depending on the third-party dependency", match.Label.String())
+					}
+				}
+			}
+			// The strategies are tried in the resolution order until one of
+			// them resolves the import.
+			for _, strategy := range cfg.ResolutionOrder() {
+				switch strategy {
+				case pythonconfig.ResolutionStrategyOverride:
+					if labels, ok := cfg.FindResolveMany(mod.Name); ok {
+						for _, override := range labels {
+							if override.Repo == "" {
+								override.Repo = from.Repo
+							}
+							if override.Equal(from) {
+								continue
+							}
+							if override.Repo == from.Repo {
+								override.Repo = ""
+							}
+							dep := override.String()
+							moduleDeps.Add(dep)
+							explainAddedDependency(explainDependency, dep, from, mod,
+								"resolves using the %q directive", pythonconfig.ResolveManyDirective)
+						}
+						continue MODULE_LOOP
+					}
+					imp := resolve.ImportSpec{Lang: languageName, Imp: mod.Name}
+					override, ok := resolve.FindRuleWithOverride(c, imp, languageName)
+					if !ok {
+						override, ok = cfg.FindResolveFileOverride(mod.Name)
+					}
+					if !ok {
+						override, ok = cfg.FindResolveOverride(mod.Name)
+					}
+					if !ok {
+						break
+					}
+					if override.Repo == "" {
+						override.Repo = from.Repo
+					}
+					if override.Equal(from) {
+						explainModule(explainDependency, from, mod, "skipped self-import")
+					} else {
+						if override.Repo == from.Repo {
+							override.Repo = ""
+						}
+						dep := override.String()
+						moduleDeps.Add(dep)
+						explainAddedDependency(explainDependency, dep, from, mod,
+							"resolves using the \"gazelle:resolve\" directive")
+					}
+					continue MODULE_LOOP
+				case pythonconfig.ResolutionStrategyMapping:
+					// The modules under the first-party namespaces never resolve
+					// to third-party distributions, e.g. an editable install of
+					// the project itself.
+					if cfg.IsFirstPartyNamespace(mod.Name) {
+						break
+					}
+					// The modules under a third-party facade namespace, e.g.
+					// `company.third_party.requests`, resolve to the distribution
+					// providing the remainder, e.g. `requests`.
+					thirdPartyModName := cfg.TrimThirdPartyPrefix(mod.Name)
+					if distributions, ok := cfg.FindConflictingDistributions(thirdPartyModName); ok {
+						err := fmt.Errorf(
+							"multiple distributions (%s) may provide %q imported at line %d in %q "+
+								"- this must be fixed using the %q directive",
+							strings.Join(distributions, ", "), mod.Name, mod.LineNumber, mod.Filepath,
+							pythonconfig.ModuleDistributionDirective)
+						fatalErrors.add(from, err)
+						continue MODULE_LOOP
+					}
+					if distribution, ok := cfg.FindThirdPartyDistribution(thirdPartyModName); ok && cfg.IsDistributionIgnored(distribution) {
+						// The modules of the ignored distributions, e.g.
+						// provided by the runtime, add no dependency.
+						explainModule(explainDependency, from, mod, fmt.Sprintf("the distribution %q is ignored using the %q directive",
+							distribution, pythonconfig.IgnoreDistributionDirective))
+						continue MODULE_LOOP
+					}
+					if osDeps, ok := cfg.FindPlatformThirdPartyDependencies(thirdPartyModName); ok {
+						if err := checkThirdPartyAllowed(cfg, from, mod, thirdPartyModName); err != nil {
+							fatalErrors.add(from, err)
 							continue MODULE_LOOP
 						}
-						if cfg.ValidateImportStatements() {
-							err := fmt.Errorf(
-								"%[1]q at line %[2]d from %[3]q is an invalid dependency: possible solutions:\n"+
-									"\t1. Add it as a dependency in the requirements.txt file.\n"+
-									"\t2. Instruct Gazelle to resolve to a known dependency using the gazelle:resolve directive.\n"+
-									"\t3. Ignore it with a comment '# gazelle:ignore %[1]s' in the Python file.\n",
-								mod.Name, mod.LineNumber, mod.Filepath,
-							)
-							log.Printf("ERROR: failed to validate dependencies for target %q: %v\n", from.String(), err)
-							hasFatalError = true
+						for goos, dep := range osDeps {
+							platform := platformSelection{Platform: rule.Platform{OS: goos}}
+							if _, ok := platformDeps[platform]; !ok {
+								platformDeps[platform] = treeset.NewWith(godsutils.StringComparator)
+							}
+							platformDeps[platform].Add(dep)
+							explainAddedDependency(explainDependency, dep, from, mod,
+								"resolves from the third-party module %q from the %s-specific wheel %q", thirdPartyModName, goos, dep)
+						}
+						continue MODULE_LOOP
+					}
+					if dep, ok := cfg.FindThirdPartyDependency(from.Pkg, thirdPartyModName); ok {
+						if err := checkThirdPartyAllowed(cfg, from, mod, thirdPartyModName); err != nil {
+							fatalErrors.add(from, err)
 							continue MODULE_LOOP
 						}
+						moduleDeps.Add(dep)
+						thirdPartyDeps.Add(dep)
+						explainAddedDependency(explainDependency, dep, from, mod,
+							"resolves from the third-party module %q from the wheel %q", thirdPartyModName, dep)
+						continue MODULE_LOOP
+					}
+				case pythonconfig.ResolutionStrategyFirstParty:
+					// The first-party targets are indexed with the transformed
+					// module names.
+					imp := resolve.ImportSpec{Lang: languageName, Imp: cfg.TransformModuleName(mod.Name)}
+					matches := py.findRulesByImport(c, ix, cfg, imp)
+					if len(matches) == 0 {
+						// Private modules not indexed as importable are still
+						// resolvable from the same Bazel package.
+						privateMatches := py.findIndexedImport(c, privateImport, imp.Imp)
+						matches = samePackageResults(privateMatches, from)
+					}
+					if len(matches) == 0 && cfg.ImplicitRelativeImports() {
+						// Python 2 implicitly imports the siblings of the module,
+						// i.e. the modules from its own Python package.
+						pythonRoot := fileRoot(r, pythonProjectRoot, mod.Filepath)
+						if siblingImp, ok := implicitRelativeImport(pythonRoot, mod.Filepath, imp.Imp); ok {
+							matches = py.findRulesByImport(c, ix, cfg, resolve.ImportSpec{Lang: languageName, Imp: siblingImp})
+							if len(matches) == 0 {
+								privateMatches := py.findIndexedImport(c, privateImport, siblingImp)
+								matches = samePackageResults(privateMatches, from)
+							}
+						}
+					}
+					if len(matches) == 0 {
+						// The names re-exported by a Python package, i.e. in
+						// its `__all__` or bound by its imports, are imported
+						// like submodules, e.g. `mypkg.Thing`, so the innermost
+						// package re-exporting them provides them.
+						for name := mod.Name; strings.Contains(name, ".") && len(matches) == 0; name = name[:strings.LastIndex(name, ".")] {
+							reexportedName := cfg.TransformModuleName(name)
+							matches = py.findIndexedImport(c, reexportedNameImport, reexportedName)
+							if len(matches) > 0 {
+								imp = resolve.ImportSpec{Lang: languageName, Imp: reexportedName[:strings.LastIndex(reexportedName, ".")]}
+							}
+						}
+					}
+					if len(matches) == 0 {
+						if cfg.TracksMovedModules() {
+							py.reportMovedModule(c, cfg, report, mod, from)
+						}
+						break
+					}
+					if preferred, ok := cfg.FindMigrationShim(mod.Name); ok {
+						// The imports through a migration shim resolve to its
+						// preferred backing target rather than the shim itself.
+						if preferred.Repo == "" {
+							preferred.Repo = from.Repo
+						}
+						if !preferred.Equal(from) {
+							dep := preferred.Rel(from.Repo, from.Pkg).String()
+							moduleDeps.Add(dep)
+							explainAddedDependency(explainDependency, dep, from, mod,
+								"resolves through a migration shim to its preferred backing target")
+						}
+						continue MODULE_LOOP
+					}
+					if portions := py.pkgutilNamespacePackagePortions(c, imp.Imp, matches); portions != nil {
+						// The submodules of a pkgutil-style namespace package can
+						// come from any of the contributing targets, so all of them
+						// are added as dependencies, whichever Python roots they
+						// are under.
+						for _, portion := range portions {
+							if portion.IsSelfImport(from) {
+								continue
+							}
+							dep := portion.Label.Rel(from.Repo, from.Pkg).String()
+							moduleDeps.Add(dep)
+							explainAddedDependency(explainDependency, dep, from, mod,
+								"resolves from the first-party indexed labels contributing to a pkgutil-style namespace package")
+						}
+						continue MODULE_LOOP
 					}
 					filteredMatches := make([]resolve.FindResult, 0, len(matches))
 					for _, match := range matches {
 						if match.IsSelfImport(from) {
 							// Prevent from adding itself as a dependency.
+							explainModule(explainDependency, from, mod, "skipped self-import")
 							continue MODULE_LOOP
 						}
 						filteredMatches = append(filteredMatches, match)
 					}
 					if len(filteredMatches) == 0 {
-						continue
+						continue MODULE_LOOP
 					}
 					if len(filteredMatches) > 1 {
-						sameRootMatches := make([]resolve.FindResult, 0, len(filteredMatches))
-						for _, match := range filteredMatches {
-							if strings.HasPrefix(match.Label.Pkg, pythonProjectRoot) {
-								sameRootMatches = append(sameRootMatches, match)
-							}
+						// The targets under the Python root of the importing
+						// file win over the ones under other roots before any
+						// other tie-break, so that the targets of another root,
+						// e.g. of another service of a monorepo, never leak in.
+						sameRootMatches := sameRootResults(cfgs, filteredMatches, fileRoot(r, pythonProjectRoot, mod.Filepath))
+						if len(sameRootMatches) > 0 {
+							filteredMatches = sameRootMatches
 						}
-						if len(sameRootMatches) != 1 {
-							err := fmt.Errorf(
-								"multiple targets (%s) may be imported with %q at line %d in %q "+
-									"- this must be fixed using the \"gazelle:resolve\" directive",
-								targetListFromResults(filteredMatches), mod.Name, mod.LineNumber, mod.Filepath)
-							log.Println("ERROR: ", err)
-							hasFatalError = true
-							continue MODULE_LOOP
+					}
+					if len(filteredMatches) > 1 {
+						// The targets tagged with the deprioritized tag lose
+						// against the other targets, e.g. hand-written ones.
+						filteredMatches = py.withoutDeprioritized(c, filteredMatches)
+					}
+					if len(filteredMatches) > 1 && cfg.ResolvePreferClosest() {
+						// The target closest to the importing one wins, e.g. a
+						// test double next to it over the real library.
+						filteredMatches = closestResults(filteredMatches, from.Pkg)
+					}
+					if len(filteredMatches) > 1 {
+						err := fmt.Errorf(
+							"multiple targets (%s) may be imported with %q at line %d in %q "+
+								"- this must be fixed using the \"gazelle:resolve\" directive",
+							targetListFromResults(filteredMatches), mod.Name, mod.LineNumber, mod.Filepath)
+						fatalErrors.add(from, err)
+						report.record(resolutionIssue{
+							kind: ambiguousImportIssue,
+							message: fmt.Sprintf("%q resolves to multiple targets (%s)",
+								mod.Name, targetListFromResults(filteredMatches)),
+							filepath:   mod.Filepath,
+							lineNumber: mod.LineNumber,
+						})
+						continue MODULE_LOOP
+					}
+					if enforcement := cfg.EnforcePrivateImports(); enforcement != pythonconfig.EnforcePrivateImportsOff {
+						pythonRoot := fileRoot(r, pythonProjectRoot, mod.Filepath)
+						importer := importSpecFromSrc(cfg, pythonRoot, filepath.Dir(mod.Filepath), filepath.Base(mod.Filepath)).Imp
+						if owner, ok := privateModuleOwner(mod.Name); ok && owner != "" && importer != owner && !strings.HasPrefix(importer, owner+".") {
+							err := fmt.Errorf("the file %q imports the private module %q at line %d from outside of its package %q",
+								mod.Filepath, mod.Name, mod.LineNumber, owner)
+							if enforcement == pythonconfig.EnforcePrivateImportsError {
+								fatalErrors.add(from, err)
+								continue MODULE_LOOP
+							}
+							log.Println("WARNING: ", err)
 						}
-						filteredMatches = sameRootMatches
+					}
+					if matchCfg, ok := cfgs[filteredMatches[0].Label.Pkg]; ok && matchCfg.TestFixtures() &&
+						!py.isTestRule(c, r, from) && !cfg.TestFixtures() {
+						// The test fixtures, and their own dependencies, must not
+						// leak into the non-test targets.
+						err := fmt.Errorf("the target %q isn't a test but the file %q imports %q at line %d "+
+							"from the test fixtures %s", from.String(), mod.Filepath, mod.Name, mod.LineNumber,
+							filteredMatches[0].Label.String())
+						fatalErrors.add(from, err)
+						continue MODULE_LOOP
 					}
 					matchLabel := filteredMatches[0].Label.Rel(from.Repo, from.Pkg)
 					dep := matchLabel.String()
-					deps.Add(dep)
-					if explainDependency == dep {
-						log.Printf("Explaining dependency (%s): "+
-							"in the target %q, the file %q imports %q at line %d, "+
-							"which resolves from the first-party indexed labels.\n",
-							explainDependency, from.String(), mod.Filepath, mod.Name, mod.LineNumber)
+					moduleDeps.Add(dep)
+					if matchPkg := filteredMatches[0].Label.Pkg; matchPkg != from.Pkg && !invisibleDeps[dep] {
+						visibility, ok := py.visibilities[label.New("", matchPkg, filteredMatches[0].Label.Name)]
+						if ok && !isVisibleTo(visibility, matchPkg, from.Pkg) {
+							// The dependency is reported once per target, whichever
+							// import it's resolved from.
+							invisibleDeps[dep] = true
+							log.Printf("WARNING: in the target %q, the file %q imports %q at line %d "+
+								"from %s, which isn't visible to the package %q - add \"//%s:__pkg__\" "+
+								"to its visibility, e.g. using the %q directive\n",
+								from.String(), mod.Filepath, mod.Name, mod.LineNumber,
+								filteredMatches[0].Label.String(), from.Pkg, from.Pkg,
+								pythonconfig.DefaultVisibilityDirective)
+						}
+					}
+					explainAddedDependency(explainDependency, dep, from, mod,
+						"resolves from the first-party indexed labels")
+					if strings.HasSuffix(mod.Name, "_pb2") {
+						// The companion targets providing the stub of a generated
+						// protobuf module are needed along with the generated code.
+						stubs := py.findIndexedImport(c, protoStubImport, imp.Imp)
+						for _, stub := range stubs {
+							if stub.IsSelfImport(from) {
+								continue
+							}
+							dep := stub.Label.Rel(from.Repo, from.Pkg).String()
+							moduleDeps.Add(dep)
+							explainAddedDependency(explainDependency, dep, from, mod,
+								"resolves from the first-party indexed labels providing the stub of the protobuf module")
+						}
+					}
+					continue MODULE_LOOP
+				case pythonconfig.ResolutionStrategyStdlib:
+					if cfg.IsFrozenModule(mod.Name) {
+						// The modules frozen into the interpreter are always
+						// present, like the standard library.
+						explainModule(explainDependency, from, mod, "resolved as a frozen module")
+						continue MODULE_LOOP
+					}
+					// Check if the imported module is part of the standard library.
+					// The backports, e.g. typing_extensions, may be importable
+					// from the interpreter but are never part of it.
+					if cfg.IsBackport(mod.Name) {
+						break
+					}
+					if isStd, err := isStdModule(mod); err != nil {
+						fatalErrors.add(from, err)
+						continue MODULE_LOOP
+					} else if isStd {
+						explainModule(explainDependency, from, mod, "resolved as standard library")
+						continue MODULE_LOOP
 					}
 				}
 			}
-		}
-		if hasFatalError {
-			os.Exit(1)
+			if prefix, ok := cfg.FindFirstPartyPrefix(mod.Name); ok {
+				// The first-party modules not indexed yet, e.g. generated by
+				// another rule, depend on the target of their directory.
+				prefixLabel := firstPartyPrefixLabel(pythonProjectRoot, prefix, mod.Name)
+				if prefixLabel.Pkg != from.Pkg || prefixLabel.Name != from.Name {
+					dep := prefixLabel.Rel(from.Repo, from.Pkg).String()
+					moduleDeps.Add(dep)
+					explainAddedDependency(explainDependency, dep, from, mod,
+						"resolves using the %q directive", pythonconfig.FirstPartyPrefixDirective)
+				}
+				continue MODULE_LOOP
+			}
+			if cfg.ResolveWithRemoteCache() {
+				if dep, ok := resolveWithRemoteCache(c, rc, mod.Name); ok {
+					moduleDeps.Add(dep)
+					thirdPartyDeps.Add(dep)
+					explainAddedDependency(explainDependency, dep, from, mod,
+						"resolves from the external repository found in the remote cache")
+					continue MODULE_LOOP
+				}
+			}
+			if len(stubs) == 0 {
+				explainModule(explainDependency, from, mod, "no matching rule found")
+				if mod.Optional && cfg.OptionalImportsComment() {
+					optionalModules.Add(mod.Name)
+				}
+			}
+			// The packages of the f-strings with a literal prefix are
+			// only guessed, so they aren't validated. The imports
+			// with hand-written stubs may only be used for
+			// type-checking.
+			if cfg.ValidateImportStatements() && mod.Confidence != confidenceMedium && len(stubs) == 0 {
+				err := fmt.Errorf(
+					"%[1]q at line %[2]d from %[3]q is an invalid dependency: possible solutions:\n"+
+						"\t1. Add it as a dependency in the requirements.txt file.\n"+
+						"\t2. Instruct Gazelle to resolve to a known dependency using the gazelle:resolve directive.\n"+
+						"\t3. Ignore it with a comment '# gazelle:ignore %[1]s' in the Python file.\n",
+					mod.Name, mod.LineNumber, mod.Filepath,
+				)
+				if mod.Optional {
+					// The imports guarded by an ImportError handler are
+					// expected to be missing in some environments. They're
+					// already surfaced by the comment on the target, if
+					// enabled.
+					if cfg.OptionalImportsComment() {
+						continue MODULE_LOOP
+					}
+					log.Printf("WARNING: failed to validate the optional dependencies for target %q: %v\n", from.String(), err)
+					continue MODULE_LOOP
+				}
+				fatalErrors.add(from, fmt.Errorf("failed to validate dependencies for target %q: %w", from.String(), err))
+				report.record(resolutionIssue{
+					kind:       unresolvedImportIssue,
+					message:    fmt.Sprintf("%q doesn't resolve to any target", mod.Name),
+					filepath:   mod.Filepath,
+					lineNumber: mod.LineNumber,
+				})
+				continue MODULE_LOOP
+			}
 		}
 	}
 	resolvedDeps := r.PrivateAttr(resolvedDepsKey).(*treeset.Set)
@@ -246,9 +1418,578 @@ func (py *Resolver) Resolve(
 			deps.Add(it.Value())
 		}
 	}
-	if !deps.Empty() {
-		r.SetAttr("deps", convertDependencySetToExpr(deps))
+	for platform, depsOnPlatform := range platformDeps {
+		// The platform-specific dependencies already added for all the
+		// platforms, or for the operating system or the architecture of the
+		// platform, are only listed once.
+		for _, dep := range depsOnPlatform.Values() {
+			if deps.Contains(dep) {
+				depsOnPlatform.Remove(dep)
+				continue
+			}
+			if platform.OS == "" || platform.Arch == "" {
+				continue
+			}
+			osDeps, osOk := platformDeps[platformSelection{Platform: rule.Platform{OS: platform.OS}}]
+			archDeps, archOk := platformDeps[platformSelection{Platform: rule.Platform{Arch: platform.Arch}}]
+			if (osOk && osDeps.Contains(dep)) || (archOk && archDeps.Contains(dep)) {
+				depsOnPlatform.Remove(dep)
+			}
+		}
+	}
+	for platform, depsOnPlatform := range platformDeps {
+		// The platform-specific imports may not add any dependency, e.g. if
+		// they are part of the standard library.
+		if depsOnPlatform.Empty() {
+			delete(platformDeps, platform)
+		}
+	}
+	depsAttr := "deps"
+	groupDeps := false
+	if modulesRaw != nil {
+		cfgs := c.Exts[languageName].(pythonconfig.Configs)
+		checkMaxDeps(cfgs[from.Pkg], from, deps, platformDeps)
+		depsAttr = cfgs[from.Pkg].DepsAttribute(r.Kind())
+		groupDeps = cfgs[from.Pkg].GroupDeps()
+	}
+	if isDryRun() {
+		py.reportDepsChanges(r, from, depsAttr, deps, platformDeps)
+	}
+	if len(platformDeps) > 0 {
+		r.SetAttr(depsAttr, convertPlatformDependenciesToExpr(deps, platformDeps))
+	} else if !deps.Empty() && groupDeps {
+		r.SetAttr(depsAttr, convertGroupedDependencySetToExpr(deps, thirdPartyDeps))
+		py.setGroupedDeps(r, from, depsAttr, deps, thirdPartyDeps)
+	} else if !deps.Empty() {
+		r.SetAttr(depsAttr, convertDependencySetToExpr(deps))
+	}
+	if !typeDeps.Empty() {
+		r.SetAttr(pyiDepsAttr, convertDependencySetToExpr(typeDeps))
+	}
+	if modulesRaw != nil {
+		cfgs := c.Exts[languageName].(pythonconfig.Configs)
+		if cfgs[from.Pkg].OptionalImportsComment() {
+			py.setOptionalImportsComment(r, from, optionalModules)
+		}
+	}
+	data := treeset.NewWith(godsutils.StringComparator)
+	if resourcesRaw := r.PrivateAttr(resourcesKey); resourcesRaw != nil {
+		cfgs := c.Exts[languageName].(pythonconfig.Configs)
+		cfg := cfgs[from.Pkg]
+		it := resourcesRaw.(*treeset.Set).Iterator()
+		for it.Next() {
+			res := it.Value().(module)
+			pythonRoot := fileRoot(r, cfg.PythonProjectRoot(), res.Filepath)
+			dep, err := py.resolveResource(c, ix, cfg, pythonRoot, res, from)
+			if err != nil {
+				fatalErrors.add(from, err)
+				continue
+			}
+			if dep != "" {
+				data.Add(dep)
+			}
+		}
+	}
+	if !data.Empty() {
+		r.SetAttr("data", convertDependencySetToExpr(data))
+	}
+	py.mergeResourceData(r, from, data)
+}
+
+// isTestRule returns whether the rule with the given label is a test, i.e. a
+// py_test, possibly mapped to another kind with the map_kind directive, or a
+// target marked as testonly in the existing BUILD file.
+func (py *Resolver) isTestRule(c *config.Config, r *rule.Rule, from label.Label) bool {
+	if r.Kind() == pyTestKind {
+		return true
+	}
+	if mapped, ok := c.KindMap[pyTestKind]; ok && mapped.KindName == r.Kind() {
+		return true
 	}
+	if f, ok := py.buildFiles[from.Pkg]; ok {
+		for _, fr := range f.Rules {
+			if fr.Name() != from.Name || fr == r {
+				continue
+			}
+			if testonly, ok := fr.Attr("testonly").(*bzl.Ident); ok && testonly.Name == "True" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mergeResourceData merges the resolved resource dependencies into the data of
+// the existing rule, which Gazelle doesn't merge since it also lists the
+// hand-written files. The labels of the Python targets that no longer provide
+// resources are removed, while the other files and labels are kept, along with
+// the ones marked with a "# keep" comment.
+func (py *Resolver) mergeResourceData(r *rule.Rule, from label.Label, data *treeset.Set) {
+	f, ok := py.buildFiles[from.Pkg]
+	if !ok {
+		return
+	}
+	for _, fr := range f.Rules {
+		if fr.Name() != from.Name || fr == r {
+			continue
+		}
+		if fr.ShouldKeep() || attrKept(f, from.Name, "data") {
+			return
+		}
+		existing, ok := fr.Attr("data").(*bzl.ListExpr)
+		if !ok {
+			return
+		}
+		merged := &bzl.ListExpr{ForceMultiLine: existing.ForceMultiLine}
+		listed := make(map[string]bool)
+		for _, elem := range existing.List {
+			if str, ok := elem.(*bzl.StringExpr); ok {
+				if !data.Contains(str.Value) && !rule.ShouldKeep(elem) && py.isPythonTarget(str.Value, from) {
+					continue
+				}
+				listed[str.Value] = true
+			}
+			merged.List = append(merged.List, elem)
+		}
+		for _, dep := range data.Values() {
+			if !listed[dep.(string)] {
+				merged.List = append(merged.List, &bzl.StringExpr{Value: dep.(string)})
+			}
+		}
+		if len(merged.List) == 0 {
+			fr.DelAttr("data")
+		} else {
+			fr.SetAttr("data", merged)
+		}
+		return
+	}
+}
+
+// isPythonTarget returns whether the given label, relative to the package of
+// the rule, is the label of a rule indexed by the Python extension.
+func (py *Resolver) isPythonTarget(dep string, from label.Label) bool {
+	lbl, err := label.Parse(dep)
+	if err != nil {
+		return false
+	}
+	lbl = lbl.Abs(from.Repo, from.Pkg)
+	if lbl.Repo != "" && lbl.Repo != from.Repo {
+		return false
+	}
+	_, ok := py.visibilities[label.New("", lbl.Pkg, lbl.Name)]
+	return ok
+}
+
+// starReexportedThirdPartyDeps returns the third-party dependencies of the
+// generated target with the given label, along with the ones of the targets
+// it star re-exports from, recursively. The chain holds the targets being
+// followed, so that a circular re-export chain is reported and stops there.
+func (py *Resolver) starReexportedThirdPartyDeps(
+	c *config.Config,
+	ix *resolve.RuleIndex,
+	lbl label.Label,
+	visited map[label.Label]bool,
+	chain []label.Label,
+) []string {
+	key := label.New("", lbl.Pkg, lbl.Name)
+	for i, chained := range chain {
+		if chained == key {
+			py.reportStarReexportCycle(chain[i:])
+			return nil
+		}
+	}
+	modules, ok := py.generatedModules[key]
+	if !ok || visited[key] {
+		return nil
+	}
+	visited[key] = true
+	chain = append(chain, key)
+	cfgs := c.Exts[languageName].(pythonconfig.Configs)
+	cfg, ok := cfgs[lbl.Pkg]
+	if !ok {
+		return nil
+	}
+	var deps []string
+	it := modules.Iterator()
+	for it.Next() {
+		mod := it.Value().(module)
+		if strings.HasPrefix(mod.Name, ".") {
+			if !mod.StarImport {
+				continue
+			}
+			// The relative imports beyond the Python root are reported when
+			// resolving the target importing them.
+			absModName, ok, _ := py.resolveRelativeImport(c, ix, cfg, cfg.PythonProjectRoot(), mod, lbl)
+			if !ok {
+				continue
+			}
+			mod.RelativeName, mod.Name = mod.Name, absModName
+		}
+		if mod.StarImport {
+			imp := resolve.ImportSpec{Lang: languageName, Imp: cfg.TransformModuleName(mod.Name)}
+			for _, match := range py.findRulesByImport(c, ix, cfg, imp) {
+				deps = append(deps, py.starReexportedThirdPartyDeps(c, ix, match.Label, visited, chain)...)
+			}
+		}
+		if cfg.IsFirstPartyNamespace(mod.Name) {
+			continue
+		}
+		thirdPartyModName := cfg.TrimThirdPartyPrefix(mod.Name)
+		if distribution, ok := cfg.FindThirdPartyDistribution(thirdPartyModName); ok && cfg.IsDistributionIgnored(distribution) {
+			continue
+		}
+		if dep, ok := cfg.FindThirdPartyDependency(lbl.Pkg, thirdPartyModName); ok {
+			deps = append(deps, dep)
+		}
+	}
+	return deps
+}
+
+// reportStarReexportCycle logs a warning for the given circular star re-export
+// chain, once per cycle whichever target it's entered from.
+func (py *Resolver) reportStarReexportCycle(cycle []label.Label) {
+	// The cycle is rotated to start from its smallest label, so that it's
+	// identified regardless of the target it's entered from.
+	start := 0
+	for i, lbl := range cycle {
+		if lbl.String() < cycle[start].String() {
+			start = i
+		}
+	}
+	labels := make([]string, 0, len(cycle)+1)
+	for i := range cycle {
+		labels = append(labels, cycle[(start+i)%len(cycle)].String())
+	}
+	labels = append(labels, labels[0])
+	key := strings.Join(labels, " -> ")
+	if py.reportedStarReexportCycles == nil {
+		py.reportedStarReexportCycles = make(map[string]bool)
+	}
+	if py.reportedStarReexportCycles[key] {
+		return
+	}
+	py.reportedStarReexportCycles[key] = true
+	log.Printf("WARNING: the star re-exports form a cycle, followed once: %s\n", key)
+}
+
+// firstPartyPrefixLabel returns the label of the target providing the given
+// module under a first-party prefix, named after its directory under the Python
+// project root, e.g. `//gen/protos` for `gen.protos.users_pb2`. The prefix
+// itself names a Python package, e.g. `//gen/protos` for `gen.protos`.
+func firstPartyPrefixLabel(pythonProjectRoot, prefix, modName string) label.Label {
+	components := strings.Split(modName, ".")
+	if modName != prefix {
+		components = components[:len(components)-1]
+	}
+	pkg := path.Join(append([]string{pythonProjectRoot}, components...)...)
+	return label.New("", pkg, path.Base(pkg))
+}
+
+// explainModule explains why the imported module adds no dependency when it
+// matches the module name set in EXPLAIN_DEPENDENCY.
+func explainModule(explainDependency string, from label.Label, mod module, reason string) {
+	if explainDependency != mod.Name && (mod.RelativeName == "" || explainDependency != mod.RelativeName) {
+		return
+	}
+	log.Printf("Explaining module (%s): "+
+		"in the target %q, the file %q imports %q at line %d, "+
+		"which adds no dependency: %s.\n",
+		explainDependency, from.String(), mod.Filepath, mod.Name, mod.LineNumber, reason)
+}
+
+// explainAddedDependency explains why the imported module adds the given
+// dependency, for the reason formatted from the given format and arguments,
+// when it matches the dependency label set in EXPLAIN_DEPENDENCY.
+func explainAddedDependency(explainDependency, dep string, from label.Label, mod module, format string, args ...interface{}) {
+	if explainDependency != dep {
+		return
+	}
+	verb := "imports"
+	if mod.StarImport {
+		verb = "star imports"
+	}
+	log.Printf("Explaining dependency (%s): "+
+		"in the target %q, the file %q %s %q at line %d, "+
+		"which %s.\n",
+		explainDependency, from.String(), mod.Filepath, verb, mod.Name, mod.LineNumber, fmt.Sprintf(format, args...))
+}
+
+// setOptionalImportsComment lists the dropped optional imports in a comment on
+// the rule, replacing the outdated one, if any. The comments of the generated
+// rules aren't merged into the existing rules, so the existing rule is updated
+// in place.
+func (py *Resolver) setOptionalImportsComment(r *rule.Rule, from label.Label, optionalModules *treeset.Set) {
+	var comment string
+	if !optionalModules.Empty() {
+		names := make([]string, 0, optionalModules.Size())
+		it := optionalModules.Iterator()
+		for it.Next() {
+			names = append(names, it.Value().(string))
+		}
+		comment = optionalImportsCommentPrefix + strings.Join(names, ", ")
+	}
+	if f, ok := py.buildFiles[from.Pkg]; ok {
+		for _, fr := range f.Rules {
+			if fr.Name() != from.Name || fr == r {
+				continue
+			}
+			if fr.ShouldKeep() {
+				return
+			}
+			if call, ok := ruleCallExpr(f, from.Name); ok {
+				before := make([]bzl.Comment, 0, len(call.Comment().Before)+1)
+				for _, c := range call.Comment().Before {
+					if !strings.HasPrefix(c.Token, optionalImportsCommentPrefix) {
+						before = append(before, c)
+					}
+				}
+				if comment != "" {
+					before = append(before, bzl.Comment{Token: comment})
+				}
+				call.Comment().Before = before
+				return
+			}
+		}
+	}
+	// The rule is new, i.e. inserted as generated.
+	if comment != "" {
+		r.AddComment(comment)
+	}
+}
+
+// setGroupedDeps replaces the deps of the existing rule with the grouped ones.
+// Gazelle keeps the existing elements of a list when merging, along with their
+// comments, so the comments leading the groups would be outdated otherwise.
+// The deps, or any of them, marked with a "# keep" comment are left as is.
+func (py *Resolver) setGroupedDeps(r *rule.Rule, from label.Label, depsAttr string, deps, thirdPartyDeps *treeset.Set) {
+	f, ok := py.buildFiles[from.Pkg]
+	if !ok {
+		return
+	}
+	for _, fr := range f.Rules {
+		if fr.Name() != from.Name || fr == r {
+			continue
+		}
+		if fr.ShouldKeep() {
+			return
+		}
+		existing, ok := fr.Attr(depsAttr).(*bzl.ListExpr)
+		if !ok {
+			return
+		}
+		for _, elem := range existing.List {
+			if _, ok := elem.(*bzl.StringExpr); !ok || rule.ShouldKeep(elem) {
+				return
+			}
+		}
+		if attrKept(f, from.Name, depsAttr) {
+			return
+		}
+		fr.SetAttr(depsAttr, convertGroupedDependencySetToExpr(deps, thirdPartyDeps))
+		return
+	}
+}
+
+// attrKept returns whether the attribute of the rule with the given name in the
+// BUILD file is marked with a "# keep" comment.
+func attrKept(f *rule.File, name, attr string) bool {
+	call, ok := ruleCallExpr(f, name)
+	if !ok {
+		return false
+	}
+	for _, arg := range call.List {
+		assign, ok := arg.(*bzl.AssignExpr)
+		if !ok {
+			continue
+		}
+		if key, ok := assign.LHS.(*bzl.Ident); ok && key.Name == attr {
+			return rule.ShouldKeep(assign)
+		}
+	}
+	return false
+}
+
+// ruleCallExpr returns the call expression of the rule with the given name in
+// the syntax tree of the BUILD file.
+func ruleCallExpr(f *rule.File, name string) (*bzl.CallExpr, bool) {
+	for _, stmt := range f.File.Stmt {
+		call, ok := stmt.(*bzl.CallExpr)
+		if !ok {
+			continue
+		}
+		for _, arg := range call.List {
+			assign, ok := arg.(*bzl.AssignExpr)
+			if !ok {
+				continue
+			}
+			key, ok := assign.LHS.(*bzl.Ident)
+			if !ok || key.Name != "name" {
+				continue
+			}
+			if value, ok := assign.RHS.(*bzl.StringExpr); ok && value.Value == name {
+				return call, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// checkThirdPartyAllowed returns an error if the target may not import the
+// given third-party module according to the allowlist of its package, or to
+// its own requirements subset.
+func checkThirdPartyAllowed(cfg *pythonconfig.Config, from label.Label, mod module, thirdPartyModName string) error {
+	if cfg.IsThirdPartyAllowed(thirdPartyModName) {
+		distribution, ok := cfg.FindThirdPartyDistribution(thirdPartyModName)
+		if !ok || cfg.IsRequirementInSubset(from.Name, distribution) {
+			return nil
+		}
+		return fmt.Errorf("the target %q imports the third-party module %q in %q at line %d "+
+			"from the distribution %q, which isn't in its subset set by the %q directive",
+			from.String(), thirdPartyModName, mod.Filepath, mod.LineNumber, distribution,
+			pythonconfig.TargetRequirementsSubsetDirective)
+	}
+	return fmt.Errorf("the target %q imports the third-party module %q in %q at line %d, "+
+		"which isn't allowed by the %q directive", from.String(), thirdPartyModName, mod.Filepath,
+		mod.LineNumber, pythonconfig.AllowedThirdPartyDirective)
+}
+
+// alternativeResolved returns whether an import from the given branch of an
+// if/else statement is resolved according to the given policy.
+func alternativeResolved(policy pythonconfig.ConditionalAlternativesType, alternative string) bool {
+	switch {
+	case alternative == "":
+		return true
+	case policy == pythonconfig.ConditionalAlternativesFirst:
+		return alternative == alternativeFirst
+	case policy == pythonconfig.ConditionalAlternativesNone:
+		return false
+	default:
+		return true
+	}
+}
+
+// dynamicImportResolved returns whether a dynamic import with the given
+// confidence in its module name is resolved according to the given minimum
+// confidence.
+func dynamicImportResolved(minConfidence pythonconfig.DynamicImportsConfidenceType, confidence string) bool {
+	switch minConfidence {
+	case pythonconfig.DynamicImportsConfidenceHigh:
+		return confidence == confidenceHigh
+	case pythonconfig.DynamicImportsConfidenceMedium:
+		return confidence == confidenceHigh || confidence == confidenceMedium
+	default:
+		return false
+	}
+}
+
+// checkMaxDeps reports the target whose dependencies, including the
+// platform-specific ones, exceed the maximum number of dependencies. It exits
+// if the excess is configured as an error.
+func checkMaxDeps(cfg *pythonconfig.Config, from label.Label, deps *treeset.Set, platformDeps map[platformSelection]*treeset.Set) {
+	maxDeps, isError := cfg.MaxDeps()
+	if maxDeps <= 0 {
+		return
+	}
+	allDeps := treeset.NewWith(godsutils.StringComparator, deps.Values()...)
+	for _, depsOnPlatform := range platformDeps {
+		allDeps.Add(depsOnPlatform.Values()...)
+	}
+	if allDeps.Size() <= maxDeps {
+		return
+	}
+	err := fmt.Errorf("the target %q has %d dependencies, more than the maximum of %d set by the %q directive "+
+		"- consider splitting the target", from.String(), allDeps.Size(), maxDeps, pythonconfig.MaxDepsDirective)
+	if isError {
+		fatalErrors.add(from, err)
+		return
+	}
+	log.Println("WARNING: ", err)
+}
+
+// resolveResource resolves the package accessed as a resource via
+// importlib.resources to the label of the target providing its data. It
+// returns an empty label if the package isn't provided by any known target,
+// e.g. if it's part of the standard library.
+func (py *Resolver) resolveResource(
+	c *config.Config,
+	ix *resolve.RuleIndex,
+	cfg *pythonconfig.Config,
+	pythonRoot string,
+	res module,
+	from label.Label,
+) (string, error) {
+	imp := resolve.ImportSpec{Lang: languageName, Imp: res.Name}
+	if override, ok := resolve.FindRuleWithOverride(c, imp, languageName); ok {
+		if override.Repo == "" {
+			override.Repo = from.Repo
+		}
+		if override.Equal(from) {
+			return "", nil
+		}
+		if override.Repo == from.Repo {
+			override.Repo = ""
+		}
+		return override.String(), nil
+	}
+	if dep, ok := cfg.FindThirdPartyDependency(from.Pkg, res.Name); ok {
+		return dep, nil
+	}
+	matches := py.findRulesByImportWithConfig(c, ix, imp)
+	if len(matches) > 1 {
+		cfgs := c.Exts[languageName].(pythonconfig.Configs)
+		sameRootMatches := sameRootResults(cfgs, matches, pythonRoot)
+		if len(sameRootMatches) != 1 {
+			return "", fmt.Errorf(
+				"multiple targets (%s) may provide the resources of %q at line %d in %q "+
+					"- this must be fixed using the \"gazelle:resolve\" directive",
+				targetListFromResults(matches), res.Name, res.LineNumber, res.Filepath)
+		}
+		matches = sameRootMatches
+	}
+	if len(matches) == 0 || matches[0].IsSelfImport(from) {
+		return "", nil
+	}
+	return matches[0].Label.Rel(from.Repo, from.Pkg).String(), nil
+}
+
+// resolveWithRemoteCache looks up the external repository providing the
+// module in the RemoteCache, using the module as a slash-separated import
+// path. The RemoteCache only knows the repositories declared in the WORKSPACE
+// with an importpath, e.g. go_repository, and looks up the other import paths
+// with the Go tooling over the network, which can't locate a Python module. So
+// the modules outside of the declared repositories are skipped. The module is
+// expected to be a Python package of the external repository, generated with
+// the default naming convention.
+func resolveWithRemoteCache(c *config.Config, rc *repo.RemoteCache, modName string) (string, bool) {
+	if rc == nil {
+		return "", false
+	}
+	importPath := strings.ReplaceAll(modName, ".", "/")
+	if !hasDeclaredRepositoryPrefix(c, importPath) {
+		return "", false
+	}
+	root, name, err := rc.Root(importPath)
+	if err != nil {
+		return "", false
+	}
+	pkg := strings.TrimPrefix(strings.TrimPrefix(importPath, root), "/")
+	targetName := name
+	if pkg != "" {
+		targetName = path.Base(pkg)
+	}
+	return label.New(name, pkg, targetName).String(), true
+}
+
+// hasDeclaredRepositoryPrefix returns whether the import path is within the
+// importpath of a repository declared in the WORKSPACE, which the RemoteCache
+// knows without accessing the network.
+func hasDeclaredRepositoryPrefix(c *config.Config, importPath string) bool {
+	for _, r := range c.Repos {
+		if prefix := r.AttrString("importpath"); prefix != "" && pathtools.HasPrefix(importPath, prefix) {
+			return true
+		}
+	}
+	return false
 }
 
 // targetListFromResults returns a string with the human-readable list of
@@ -272,3 +2013,170 @@ func convertDependencySetToExpr(set *treeset.Set) bzl.Expr {
 	}
 	return &bzl.ListExpr{List: deps}
 }
+
+// Leading comments of the groups of dependencies.
+const (
+	firstPartyDepsComment = "# First-party dependencies."
+	thirdPartyDepsComment = "# Third-party dependencies."
+)
+
+// convertGroupedDependencySetToExpr returns the expression of the dependencies
+// with the first-party ones and the third-party ones in separate groups, each
+// led by a comment. The groups are kept in a single list, which Gazelle can
+// still merge into the existing rules, so they are only separated if the
+// third-party dependencies sort after the first-party ones, as Gazelle sorts
+// the labels of the lists, e.g. when they are from external repositories.
+func convertGroupedDependencySetToExpr(set, thirdPartySet *treeset.Set) bzl.Expr {
+	var firstParty, thirdParty []string
+	it := set.Iterator()
+	for it.Next() {
+		dep := it.Value().(string)
+		if thirdPartySet.Contains(dep) {
+			thirdParty = append(thirdParty, dep)
+		} else {
+			firstParty = append(firstParty, dep)
+		}
+	}
+	if len(firstParty) == 0 || len(thirdParty) == 0 {
+		return convertDependencySetToExpr(set)
+	}
+	sort.Slice(firstParty, func(i, j int) bool { return lessLabel(firstParty[i], firstParty[j]) })
+	sort.Slice(thirdParty, func(i, j int) bool { return lessLabel(thirdParty[i], thirdParty[j]) })
+	if !lessLabel(firstParty[len(firstParty)-1], thirdParty[0]) {
+		return convertDependencySetToExpr(set)
+	}
+	deps := make([]bzl.Expr, 0, len(firstParty)+len(thirdParty))
+	for i, dep := range append(firstParty, thirdParty...) {
+		expr := &bzl.StringExpr{Value: dep}
+		switch i {
+		case 0:
+			expr.Comments.Before = []bzl.Comment{{Token: firstPartyDepsComment}}
+		case len(firstParty):
+			expr.Comments.Before = []bzl.Comment{{Token: thirdPartyDepsComment}}
+		}
+		deps = append(deps, expr)
+	}
+	return &bzl.ListExpr{List: deps, ForceMultiLine: true}
+}
+
+// lessLabel reports whether the label a sorts before the label b in the lists
+// sorted by Gazelle, i.e. the local labels, then the ones of the main
+// repository, then the external ones, compared by their components.
+func lessLabel(a, b string) bool {
+	phase := func(s string) int {
+		switch {
+		case strings.HasPrefix(s, ":"):
+			return 1
+		case strings.HasPrefix(s, "//"):
+			return 2
+		case strings.HasPrefix(s, "@"):
+			return 3
+		}
+		return 0
+	}
+	if phaseA, phaseB := phase(a), phase(b); phaseA != phaseB {
+		return phaseA < phaseB
+	}
+	splitA := strings.Split(strings.Replace(a, ":", ".", -1), ".")
+	splitB := strings.Split(strings.Replace(b, ":", ".", -1), ".")
+	for k := 0; k < len(splitA) && k < len(splitB); k++ {
+		if splitA[k] != splitB[k] {
+			return splitA[k] < splitB[k]
+		}
+	}
+	if len(splitA) != len(splitB) {
+		return len(splitA) < len(splitB)
+	}
+	return a < b
+}
+
+// convertPlatformDependenciesToExpr returns the expression of the dependencies
+// with the platform-specific ones in selects on the constraint values of the
+// operating systems or the architectures, e.g.
+// `[":lib"] + select({"@platforms//os:linux": [...]})`, or on the
+// config_settings generated for the platforms, e.g. `":windows_amd64"`. The
+// dependencies excluded from some operating systems or architectures are
+// selected on the other known ones, as Gazelle drops the empty cases of the
+// selects when merging them.
+func convertPlatformDependenciesToExpr(deps *treeset.Set, platformDeps map[platformSelection]*treeset.Set) bzl.Expr {
+	osDeps := make(map[string]*treeset.Set)
+	archDeps := make(map[string]*treeset.Set)
+	pairDeps := make(map[string]*treeset.Set)
+	for platform, depsOnPlatform := range platformDeps {
+		switch {
+		case platform.OS != "" && platform.Arch != "":
+			addPlatformDeps(pairDeps, ":"+platform.String(), depsOnPlatform)
+		case platform.OS != "":
+			addPlatformDeps(osDeps, osConstraint(platform.OS), depsOnPlatform)
+		case platform.Arch != "":
+			addPlatformDeps(archDeps, cpuConstraint(platform.Arch), depsOnPlatform)
+		case platform.ExcludedOS != "":
+			for _, goos := range otherPlatforms(knownOSes(), platform.excludedOS()) {
+				addPlatformDeps(osDeps, osConstraint(goos), depsOnPlatform)
+			}
+		default:
+			for _, goarch := range otherPlatforms(knownArchs(), platform.excludedArch()) {
+				addPlatformDeps(archDeps, cpuConstraint(goarch), depsOnPlatform)
+			}
+		}
+	}
+	var pieces []bzl.Expr
+	if !deps.Empty() {
+		pieces = append(pieces, convertDependencySetToExpr(deps))
+	}
+	for _, keyedDeps := range []map[string]*treeset.Set{osDeps, archDeps, pairDeps} {
+		if len(keyedDeps) == 0 {
+			continue
+		}
+		value := rule.SelectStringListValue{"//conditions:default": nil}
+		for key, depsOnPlatform := range keyedDeps {
+			value[key] = setStrings(depsOnPlatform)
+		}
+		pieces = append(pieces, value.BzlExpr())
+	}
+	if len(pieces) == 0 {
+		return &bzl.ListExpr{}
+	}
+	if list, ok := pieces[0].(*bzl.ListExpr); ok && len(pieces) > 1 {
+		list.ForceMultiLine = true
+	}
+	expr := pieces[0]
+	for _, piece := range pieces[1:] {
+		expr = &bzl.BinaryExpr{X: expr, Op: "+", Y: piece}
+	}
+	return expr
+}
+
+// addPlatformDeps adds the dependencies to the ones selected by the key.
+func addPlatformDeps(keyedDeps map[string]*treeset.Set, key string, deps *treeset.Set) {
+	if _, ok := keyedDeps[key]; !ok {
+		keyedDeps[key] = treeset.NewWith(godsutils.StringComparator)
+	}
+	keyedDeps[key].Add(deps.Values()...)
+}
+
+// otherPlatforms returns the known operating systems or architectures except
+// the excluded ones.
+func otherPlatforms(known, excluded []string) []string {
+	var others []string
+KNOWN_LOOP:
+	for _, platform := range known {
+		for _, excludedPlatform := range excluded {
+			if platform == excludedPlatform {
+				continue KNOWN_LOOP
+			}
+		}
+		others = append(others, platform)
+	}
+	return others
+}
+
+// setStrings returns the sorted strings of the set.
+func setStrings(set *treeset.Set) []string {
+	strs := make([]string, 0, set.Size())
+	it := set.Iterator()
+	for it.Next() {
+		strs = append(strs, it.Value().(string))
+	}
+	return strs
+}
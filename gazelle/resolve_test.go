@@ -0,0 +1,572 @@
+package python
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/repo"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+	"github.com/emirpasic/gods/sets/treeset"
+	godsutils "github.com/emirpasic/gods/utils"
+	"golang.org/x/tools/go/vcs"
+
+	"github.com/bazelbuild/rules_python/gazelle/manifest"
+	"github.com/bazelbuild/rules_python/gazelle/pythonconfig"
+)
+
+// newTestConfig returns a config.Config with the Python extension configured
+// for the given Bazel packages.
+func newTestConfig(pkgs ...string) *config.Config {
+	c := config.New()
+	resolveConfigurer := &resolve.Configurer{}
+	resolveConfigurer.RegisterFlags(flag.NewFlagSet("test", flag.ContinueOnError), "update", c)
+	rootConfig := pythonconfig.New(c.RepoRoot, "")
+	cfgs := pythonconfig.Configs{"": rootConfig}
+	for _, pkg := range pkgs {
+		cfgs[pkg] = rootConfig.NewChild()
+	}
+	c.Exts[languageName] = cfgs
+	return c
+}
+
+func TestImports(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		pkg  string
+		// configure, if set, configures the Python extension for pkg.
+		configure func(cfg *pythonconfig.Config)
+		// insertRules, if set, inserts the other rules of the BUILD file.
+		insertRules func(f *rule.File)
+		srcs        []string
+		want        []string
+	}{
+		{
+			name: "deduplicates ImportSpecs",
+			pkg:  "pkg",
+			srcs: []string{"__init__.py", "bar.py", "foo.py", "foo/__init__.py"},
+			want: []string{"pkg", "pkg.bar", "pkg.foo"},
+		},
+		{
+			name: "indexes the library entrypoint filename as the package",
+			pkg:  "pkg",
+			configure: func(cfg *pythonconfig.Config) {
+				cfg.SetLibraryEntrypointFilename("_package.py")
+			},
+			srcs: []string{"_package.py", "bar.py"},
+			want: []string{"pkg", "pkg.bar"},
+		},
+		{
+			name: "indexes label srcs relative to their package",
+			pkg:  "pkg",
+			srcs: []string{":bar.py", "//other:gen.py", "//other/nested:__init__.py", "@external//pkg:ext.py"},
+			want: []string{"pkg.bar", "other.gen", "other.nested"},
+		},
+		{
+			name: "indexes the modules generated by rules from the same BUILD file",
+			pkg:  "pkg",
+			insertRules: func(f *rule.File) {
+				genrule := rule.NewRule("genrule", "gen_init")
+				genrule.SetAttr("outs", []string{"__init__.py"})
+				genrule.Insert(f)
+			},
+			srcs: []string{":gen_init", "bar.py"},
+			want: []string{"pkg", "pkg.bar"},
+		},
+		{
+			name: "indexes modules through directories without __init__.py",
+			pkg:  "src/company",
+			configure: func(cfg *pythonconfig.Config) {
+				cfg.SetPythonProjectRoot("src")
+			},
+			srcs: []string{"team/lib/helpers.py", "team/util/__init__.py"},
+			want: []string{"company.team.lib.helpers", "company.team.util"},
+		},
+		{
+			name: "doesn't index the Cython sources by default",
+			pkg:  "pkg",
+			srcs: []string{"__init__.pyx", "foo.pxd", "foo.pyx", "bar.py"},
+			want: []string{"pkg.bar"},
+		},
+		{
+			name: "indexes the Cython sources if enabled",
+			pkg:  "pkg",
+			configure: func(cfg *pythonconfig.Config) {
+				cfg.SetIndexCython(true)
+			},
+			srcs: []string{"__init__.pyx", "foo.pxd", "foo.pyx", "bar.py"},
+			want: []string{"pkg", "pkg.foo", "pkg.bar"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newTestConfig(tc.pkg)
+			if tc.configure != nil {
+				tc.configure(c.Exts[languageName].(pythonconfig.Configs)[tc.pkg])
+			}
+			f := rule.EmptyFile(path.Join(tc.pkg, "BUILD"), tc.pkg)
+			if tc.insertRules != nil {
+				tc.insertRules(f)
+			}
+			r := rule.NewRule(pyLibraryKind, path.Base(tc.pkg))
+			r.SetAttr("srcs", tc.srcs)
+			r.Insert(f)
+			var py Resolver
+			compareImportSpecs(t, py.Imports(c, r, f), tc.want)
+		})
+	}
+}
+
+// compareImportSpecs reports the differences between the Python ImportSpecs
+// and the wanted imports, in order.
+func compareImportSpecs(t *testing.T, got []resolve.ImportSpec, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("expected %d ImportSpecs, got %d: %v", len(want), len(got), got)
+	}
+	for i, imp := range want {
+		if wantSpec := (resolve.ImportSpec{Lang: languageName, Imp: imp}); got[i] != wantSpec {
+			t.Errorf("expected ImportSpec %v at index %d, got %v", wantSpec, i, got[i])
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	// The RemoteCache is mocked with the repository declared in the WORKSPACE,
+	// and fails the test if it accesses the network.
+	rc, cleanup := repo.NewRemoteCache([]repo.Repo{
+		{Name: "com_example_remote", GoPrefix: "example_remote"},
+	})
+	defer cleanup()
+	rc.RepoRootForImportPath = func(importPath string, verbose bool) (*vcs.RepoRoot, error) {
+		t.Errorf("expected no lookup of %q over the network", importPath)
+		return nil, fmt.Errorf("no network")
+	}
+	remoteConfig := func() *config.Config {
+		c := newTestConfig("app")
+		declared := rule.NewRule("go_repository", "com_example_remote")
+		declared.SetAttr("importpath", "example_remote")
+		c.Repos = []*rule.Rule{declared}
+		cfg := c.Exts[languageName].(pythonconfig.Configs)["app"]
+		cfg.SetResolveWithRemoteCache(true)
+		cfg.SetValidateImportStatements(false)
+		return c
+	}
+	resolveRemoteModule := func(c *config.Config, modName string) []string {
+		ix := resolve.NewRuleIndex(nil)
+		ix.Finish()
+		r := rule.NewRule(pyLibraryKind, "app")
+		r.SetPrivateAttr(resolvedDepsKey, treeset.NewWith(godsutils.StringComparator))
+		modules := treeset.NewWith(moduleComparator)
+		modules.Add(module{Name: modName, LineNumber: 1, Filepath: "app/__init__.py"})
+		var py Resolver
+		py.Resolve(c, ix, rc, r, modules, label.New("", "app", "app"))
+		return r.AttrStrings("deps")
+	}
+
+	t.Run("resolves with the remote cache", func(t *testing.T) {
+		got := resolveRemoteModule(remoteConfig(), "example_remote.client")
+		want := []string{"@com_example_remote//client"}
+		if len(got) != len(want) || got[0] != want[0] {
+			t.Errorf("expected deps %v, got %v", want, got)
+		}
+	})
+	t.Run("doesn't look up the modules outside of the declared repositories", func(t *testing.T) {
+		if got := resolveRemoteModule(remoteConfig(), "undeclared.client"); len(got) != 0 {
+			t.Errorf("expected no deps, got %v", got)
+		}
+	})
+	t.Run("doesn't resolve with the remote cache by default", func(t *testing.T) {
+		c := remoteConfig()
+		c.Exts[languageName].(pythonconfig.Configs)["app"].SetResolveWithRemoteCache(false)
+		if got := resolveRemoteModule(c, "example_remote.client"); len(got) != 0 {
+			t.Errorf("expected no deps, got %v", got)
+		}
+	})
+
+	resolveOtherExtensionModule := func(c *config.Config) []string {
+		other := &otherResolver{imps: []resolve.ImportSpec{{Lang: languageName, Imp: "gen.api"}}}
+		ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver {
+			if r.Kind() == "other_py_library" {
+				return other
+			}
+			return nil
+		})
+		ix.AddRule(c, rule.NewRule("other_py_library", "api"), rule.EmptyFile("gen/BUILD", "gen"))
+		ix.Finish()
+		r := rule.NewRule(pyLibraryKind, "app")
+		r.SetPrivateAttr(resolvedDepsKey, treeset.NewWith(godsutils.StringComparator))
+		modules := treeset.NewWith(moduleComparator)
+		modules.Add(module{Name: "gen.api", LineNumber: 1, Filepath: "app/__init__.py"})
+		var py Resolver
+		py.Resolve(c, ix, nil, r, modules, label.New("", "app", "app"))
+		return r.AttrStrings("deps")
+	}
+
+	t.Run("resolves with the Python imports of other extensions", func(t *testing.T) {
+		c := newTestConfig("app")
+		c.Exts[languageName].(pythonconfig.Configs)["app"].SetCrossResolveLanguages([]string{"other"})
+		got := resolveOtherExtensionModule(c)
+		want := []string{"//gen:api"}
+		if len(got) != len(want) || got[0] != want[0] {
+			t.Errorf("expected deps %v, got %v", want, got)
+		}
+	})
+	t.Run("doesn't resolve with the Python imports of other extensions by default", func(t *testing.T) {
+		c := newTestConfig("app")
+		c.Exts[languageName].(pythonconfig.Configs)["app"].SetValidateImportStatements(false)
+		if got := resolveOtherExtensionModule(c); len(got) != 0 {
+			t.Errorf("expected no deps, got %v", got)
+		}
+	})
+
+	t.Run("resolves services sharing a pip repository within their own roots", func(t *testing.T) {
+		c := newTestConfig(
+			"services/a", "services/a/app", "services/a/common", "services/a/gen",
+			"services/b", "services/b/app", "services/b/common", "services/b/gen",
+		)
+		cfgs := c.Exts[languageName].(pythonconfig.Configs)
+		cfgs[""].SetGazelleManifest(&manifest.Manifest{
+			ModulesMapping: map[string]string{"requests": "requests"},
+			PipRepository:  &manifest.PipRepository{Name: "pip"},
+		})
+		for _, service := range []string{"services/a", "services/b"} {
+			for _, pkg := range []string{"", "/app", "/common", "/gen"} {
+				cfgs[service+pkg].SetPythonProjectRoot(service)
+			}
+		}
+		ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver {
+			return &Resolver{}
+		})
+		addRule := func(pkg string, srcs []string, tags ...string) {
+			r := rule.NewRule(pyLibraryKind, path.Base(pkg))
+			r.SetAttr("srcs", srcs)
+			if len(tags) > 0 {
+				r.SetAttr("tags", tags)
+			}
+			ix.AddRule(c, r, rule.EmptyFile(pkg+"/BUILD", pkg))
+		}
+		for _, service := range []string{"services/a", "services/b"} {
+			addRule(service+"/common", []string{"__init__.py", "settings.py"})
+		}
+		// The generated client of the first service loses against the
+		// hand-written one of the second service, but the latter isn't on
+		// the path of the first service.
+		addRule("services/a/gen", []string{"client.py"}, "gazelle-generated")
+		addRule("services/b/gen", []string{"client.py"})
+		ix.Finish()
+		for _, tc := range []struct {
+			service string
+			want    []string
+		}{
+			{service: "services/a", want: []string{"//services/a/common", "//services/a/gen", "@pip//pypi__requests"}},
+			{service: "services/b", want: []string{"//services/b/common", "//services/b/gen", "@pip//pypi__requests"}},
+		} {
+			pkg := tc.service + "/app"
+			r := rule.NewRule(pyLibraryKind, "app")
+			r.SetPrivateAttr(resolvedDepsKey, treeset.NewWith(godsutils.StringComparator))
+			modules := treeset.NewWith(moduleComparator)
+			for i, name := range []string{"common.settings", "gen.client", "requests"} {
+				modules.Add(module{Name: name, LineNumber: uint32(i + 1), Filepath: pkg + "/__init__.py"})
+			}
+			var py Resolver
+			py.Resolve(c, ix, nil, r, modules, label.New("", pkg, "app"))
+			got := r.AttrStrings("deps")
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("expected deps %v for %q, got %v", tc.want, tc.service, got)
+			}
+		}
+	})
+}
+
+func TestResolvePreferClosest(t *testing.T) {
+	resolveClient := func(c *config.Config, pkg string) []string {
+		ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver {
+			return &Resolver{}
+		})
+		// The test double provides the same module as the real library.
+		lib := rule.NewRule(pyLibraryKind, "lib")
+		lib.SetAttr("srcs", []string{"client.py"})
+		ix.AddRule(c, lib, rule.EmptyFile("lib/BUILD", "lib"))
+		fake := rule.NewRule(pyLibraryKind, "fake_client")
+		fake.SetAttr("srcs", []string{"//lib:client.py"})
+		ix.AddRule(c, fake, rule.EmptyFile("app/testing/BUILD", "app/testing"))
+		ix.Finish()
+		r := rule.NewRule(pyLibraryKind, path.Base(pkg))
+		r.SetPrivateAttr(resolvedDepsKey, treeset.NewWith(godsutils.StringComparator))
+		modules := treeset.NewWith(moduleComparator)
+		modules.Add(module{Name: "lib.client", LineNumber: 1, Filepath: pkg + "/__init__.py"})
+		var py Resolver
+		py.Resolve(c, ix, nil, r, modules, label.New("", pkg, path.Base(pkg)))
+		return r.AttrStrings("deps")
+	}
+
+	t.Run("resolves to the closest target", func(t *testing.T) {
+		c := newTestConfig("app", "app/testing", "lib")
+		c.Exts[languageName].(pythonconfig.Configs)["app"].SetResolvePreferClosest(true)
+		got := resolveClient(c, "app")
+		want := []string{"//app/testing:fake_client"}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("expected deps %v, got %v", want, got)
+		}
+	})
+	t.Run("keeps the equally close targets", func(t *testing.T) {
+		results := []resolve.FindResult{
+			{Label: label.New("", "lib", "lib")},
+			{Label: label.New("", "app/testing", "fake_client")},
+		}
+		if got := closestResults(results, "other"); len(got) != len(results) {
+			t.Errorf("expected %d results, got %v", len(results), got)
+		}
+	})
+}
+
+func TestFindRulesByImportWithConfig(t *testing.T) {
+	c := newTestConfig("app")
+	py := &Resolver{
+		embeddedLibraries: map[label.Label]label.Label{
+			label.New("", "app", "app_bin"): label.New("", "app", "app"),
+		},
+	}
+	ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver {
+		return py
+	})
+	f := rule.EmptyFile("app/BUILD", "app")
+	lib := rule.NewRule(pyLibraryKind, "app")
+	lib.SetAttr("srcs", []string{"__init__.py", "helpers.py"})
+	ix.AddRule(c, lib, f)
+	bin := rule.NewRule(pyBinaryKind, "app_bin")
+	bin.SetAttr("srcs", []string{"__main__.py"})
+	ix.AddRule(c, bin, f)
+	ix.Finish()
+
+	for _, tc := range []struct {
+		name string
+		imp  string
+		want string
+	}{
+		{name: "resolves the embedded imports to the library", imp: "app.helpers", want: "//app"},
+		{name: "resolves the own imports to the embedding rule", imp: "app.__main__", want: "//app:app_bin"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			matches := py.findRulesByImportWithConfig(c, ix, resolve.ImportSpec{Lang: languageName, Imp: tc.imp})
+			if len(matches) != 1 || matches[0].Label.String() != tc.want {
+				t.Errorf("expected %q to resolve to %s, got %v", tc.imp, tc.want, matches)
+			}
+		})
+	}
+}
+
+func TestIsTestRule(t *testing.T) {
+	f, err := rule.LoadData("testutils/BUILD", "testutils", []byte(`py_library(
+    name = "testutils",
+    testonly = True,
+)
+`))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var py Resolver
+	py.buildFiles = map[string]*rule.File{"testutils": f}
+	c := newTestConfig()
+	c.KindMap = map[string]config.MappedKind{
+		pyTestKind: {FromKind: pyTestKind, KindName: "pytest_test", KindLoad: "//tools:pytest.bzl"},
+	}
+	for _, tc := range []struct {
+		name string
+		kind string
+		from label.Label
+		want bool
+	}{
+		{name: "test", kind: pyTestKind, from: label.New("", "tests", "tests_test"), want: true},
+		{name: "mapped test", kind: "pytest_test", from: label.New("", "tests", "tests_test"), want: true},
+		{name: "library", kind: pyLibraryKind, from: label.New("", "app", "app"), want: false},
+		{name: "testonly library", kind: pyLibraryKind, from: label.New("", "testutils", "testutils"), want: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := rule.NewRule(tc.kind, tc.from.Name)
+			if got := py.isTestRule(c, r, tc.from); got != tc.want {
+				t.Errorf("expected %s to be a test: %v, got %v", tc.from, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestIsVisibleTo(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		visibility []string
+		fromPkg    string
+		want       bool
+	}{
+		{name: "same package", visibility: []string{"//visibility:private"}, fromPkg: "lib", want: true},
+		{name: "private", visibility: []string{"//visibility:private"}, fromPkg: "app", want: false},
+		{name: "public", visibility: []string{"//visibility:public"}, fromPkg: "app", want: true},
+		{name: "package", visibility: []string{"//app:__pkg__"}, fromPkg: "app", want: true},
+		{name: "sub-package of a package", visibility: []string{"//app:__pkg__"}, fromPkg: "app/sub", want: false},
+		{name: "sub-packages", visibility: []string{"//app:__subpackages__"}, fromPkg: "app/sub", want: true},
+		{name: "relative sub-packages", visibility: []string{":__subpackages__"}, fromPkg: "lib/sub", want: true},
+		{name: "root sub-packages", visibility: []string{"//:__subpackages__"}, fromPkg: "app", want: true},
+		{name: "other sub-packages", visibility: []string{"//lib:__subpackages__"}, fromPkg: "app", want: false},
+		{name: "package group", visibility: []string{"//groups:app"}, fromPkg: "app", want: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isVisibleTo(tc.visibility, "lib", tc.fromPkg); got != tc.want {
+				t.Errorf("expected %v to be visible to %q: %v, got %v", tc.visibility, tc.fromPkg, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestConvertGroupedDependencySetToExpr(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		deps       []string
+		thirdParty []string
+		want       string
+	}{
+		{
+			name:       "groups",
+			deps:       []string{"//lib", ":helpers", "@pip//pypi__requests"},
+			thirdParty: []string{"@pip//pypi__requests"},
+			want: `[
+    # First-party dependencies.
+    ":helpers",
+    "//lib",
+    # Third-party dependencies.
+    "@pip//pypi__requests",
+]`,
+		},
+		{
+			name:       "first-party only",
+			deps:       []string{"//lib", ":helpers"},
+			thirdParty: nil,
+			want: `[
+    "//lib",
+    ":helpers",
+]`,
+		},
+		{
+			name:       "interleaved",
+			deps:       []string{"//lib", "//third_party:requests", "//vendored"},
+			thirdParty: []string{"//third_party:requests"},
+			want: `[
+    "//lib",
+    "//third_party:requests",
+    "//vendored",
+]`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			deps := treeset.NewWith(godsutils.StringComparator)
+			for _, dep := range tc.deps {
+				deps.Add(dep)
+			}
+			thirdPartyDeps := treeset.NewWith(godsutils.StringComparator)
+			for _, dep := range tc.thirdParty {
+				thirdPartyDeps.Add(dep)
+			}
+			got := bzl.FormatString(convertGroupedDependencySetToExpr(deps, thirdPartyDeps))
+			if got != tc.want {
+				t.Errorf("expected:\n%s\ngot:\n%s", tc.want, got)
+			}
+		})
+	}
+}
+
+// otherResolver is the resolve.Resolver of another Gazelle extension indexing
+// its rules with Python imports.
+type otherResolver struct {
+	imps []resolve.ImportSpec
+}
+
+func (*otherResolver) Name() string { return "other" }
+
+func (o *otherResolver) Imports(c *config.Config, r *rule.Rule, f *rule.File) []resolve.ImportSpec {
+	return o.imps
+}
+
+func (*otherResolver) Embeds(r *rule.Rule, from label.Label) []label.Label { return nil }
+
+func (*otherResolver) Resolve(
+	c *config.Config,
+	ix *resolve.RuleIndex,
+	rc *repo.RemoteCache,
+	r *rule.Rule,
+	imports interface{},
+	from label.Label,
+) {
+}
+
+func TestReportDeprecatedStdlibAliases(t *testing.T) {
+	output := log.Writer()
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(output)
+
+	cfg := pythonconfig.New("", "")
+	cfg.AddDeprecatedStdlibAlias("imp", "importlib")
+	report := &sarifReport{path: filepath.Join(t.TempDir(), "report.sarif")}
+	reportDeprecatedStdlibAliases(cfg, report, module{
+		Name:       "imp",
+		LineNumber: 1,
+		Filepath:   "app/__init__.py",
+	})
+	reportDeprecatedStdlibAliases(cfg, report, module{
+		Name:       "collections",
+		LineNumber: 2,
+		Filepath:   "app/__init__.py",
+		Names: []importedName{
+			{Name: "OrderedDict", LineNumber: 2, Filepath: "app/__init__.py"},
+			{Name: "Mapping", LineNumber: 3, Filepath: "app/__init__.py"},
+		},
+	})
+	want := []resolutionIssue{
+		{
+			kind:       deprecatedImportIssue,
+			message:    `"imp" is a deprecated alias of "importlib"`,
+			filepath:   "app/__init__.py",
+			lineNumber: 1,
+		},
+		{
+			kind:       deprecatedImportIssue,
+			message:    `"collections.Mapping" is a deprecated alias of "collections.abc.Mapping"`,
+			filepath:   "app/__init__.py",
+			lineNumber: 3,
+		},
+	}
+	if len(report.issues) != len(want) {
+		t.Fatalf("expected %d issues, got %d: %v", len(want), len(report.issues), report.issues)
+	}
+	for i, issue := range want {
+		if report.issues[i] != issue {
+			t.Errorf("expected issue %v at index %d, got %v", issue, i, report.issues[i])
+		}
+	}
+}
+
+func BenchmarkImports(b *testing.B) {
+	c := newTestConfig("pkg")
+	f := rule.EmptyFile("pkg/BUILD", "pkg")
+	r := rule.NewRule(pyLibraryKind, "pkg")
+	// A large coarse-grained target where every module is provided both as a
+	// file and as a package.
+	srcs := make([]string, 0, 20000)
+	for i := 0; i < 10000; i++ {
+		srcs = append(srcs, fmt.Sprintf("mod%d.py", i), fmt.Sprintf("mod%d/__init__.py", i))
+	}
+	r.SetAttr("srcs", srcs)
+	var py Resolver
+	var specs []resolve.ImportSpec
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		specs = py.Imports(c, r, f)
+	}
+	b.ReportMetric(float64(len(specs)), "specs/op")
+}
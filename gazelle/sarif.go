@@ -0,0 +1,210 @@
+package python
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+)
+
+// sarifReportEnv is the environment variable setting the path, relative to the
+// workspace root if not absolute, of the SARIF report of the resolution
+// issues, e.g. for code-scanning dashboards.
+const sarifReportEnv = "GAZELLE_PYTHON_SARIF_REPORT"
+
+// resolutionIssueKind represents the kind of a resolution issue. It is used as
+// the rule ID of the SARIF results.
+type resolutionIssueKind string
+
+const (
+	// unresolvedImportIssue is an import that doesn't resolve to any target.
+	unresolvedImportIssue resolutionIssueKind = "unresolved-import"
+	// ambiguousImportIssue is an import that resolves to multiple targets.
+	ambiguousImportIssue resolutionIssueKind = "ambiguous-import"
+	// movedModuleIssue is an import of a module moved since the baseline set
+	// by the python_moved_modules_baseline directive.
+	movedModuleIssue resolutionIssueKind = "moved-module"
+	// deprecatedImportIssue is an import of a deprecated alias of the standard
+	// library, declared by the python_deprecated_stdlib_alias directive.
+	deprecatedImportIssue resolutionIssueKind = "deprecated-import"
+)
+
+// resolutionIssueKinds describes the kinds of resolution issues, in the order
+// of the rules of the SARIF report.
+var resolutionIssueKinds = []struct {
+	kind        resolutionIssueKind
+	level       string
+	description string
+}{
+	{unresolvedImportIssue, "error", "The import doesn't resolve to any target."},
+	{ambiguousImportIssue, "error", "The import resolves to multiple targets."},
+	{movedModuleIssue, "note", "The imported module moved since the baseline."},
+	{deprecatedImportIssue, "warning", "The import is a deprecated alias of the standard library."},
+}
+
+// resolutionIssue represents an issue resolving an import at a location.
+type resolutionIssue struct {
+	kind    resolutionIssueKind
+	message string
+	// The path to the file relative to the Bazel workspace root.
+	filepath   string
+	lineNumber uint32
+}
+
+// sarifReport collects the resolution issues into a SARIF report. The report
+// is written again on each issue, since the resolution may exit on errors.
+type sarifReport struct {
+	mu     sync.Mutex
+	path   string
+	issues []resolutionIssue
+}
+
+var (
+	sarifReportOnce sync.Once
+	sarifReportInst *sarifReport
+)
+
+// resolutionReport returns the SARIF report set by the sarifReportEnv
+// environment variable, writing it empty the first time. It returns nil if the
+// variable isn't set.
+func resolutionReport(c *config.Config) *sarifReport {
+	sarifReportOnce.Do(func() {
+		reportPath := os.Getenv(sarifReportEnv)
+		if reportPath == "" {
+			return
+		}
+		if !filepath.IsAbs(reportPath) {
+			reportPath = filepath.Join(c.RepoRoot, reportPath)
+		}
+		sarifReportInst = &sarifReport{path: reportPath}
+		if err := sarifReportInst.write(); err != nil {
+			log.Printf("ERROR: %v\n", err)
+		}
+	})
+	return sarifReportInst
+}
+
+// record adds the issue to the report and writes it. It does nothing on a nil
+// report.
+func (r *sarifReport) record(issue resolutionIssue) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.issues = append(r.issues, issue)
+	r.mu.Unlock()
+	if err := r.write(); err != nil {
+		log.Printf("ERROR: %v\n", err)
+	}
+}
+
+func (r *sarifReport) write() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	file, err := os.Create(r.path)
+	if err != nil {
+		return fmt.Errorf("failed to write the SARIF report: %w", err)
+	}
+	defer file.Close()
+	if err := encodeSarif(file, r.issues); err != nil {
+		return fmt.Errorf("failed to write the SARIF report: %w", err)
+	}
+	return nil
+}
+
+// The subset of the SARIF 2.1.0 format used by the report.
+type (
+	sarifLog struct {
+		Schema  string     `json:"$schema"`
+		Version string     `json:"version"`
+		Runs    []sarifRun `json:"runs"`
+	}
+	sarifRun struct {
+		Tool    sarifTool     `json:"tool"`
+		Results []sarifResult `json:"results"`
+	}
+	sarifTool struct {
+		Driver sarifDriver `json:"driver"`
+	}
+	sarifDriver struct {
+		Name  string      `json:"name"`
+		Rules []sarifRule `json:"rules"`
+	}
+	sarifRule struct {
+		ID                   string             `json:"id"`
+		ShortDescription     sarifMessage       `json:"shortDescription"`
+		DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+	}
+	sarifConfiguration struct {
+		Level string `json:"level"`
+	}
+	sarifResult struct {
+		RuleID    string          `json:"ruleId"`
+		RuleIndex int             `json:"ruleIndex"`
+		Level     string          `json:"level"`
+		Message   sarifMessage    `json:"message"`
+		Locations []sarifLocation `json:"locations"`
+	}
+	sarifMessage struct {
+		Text string `json:"text"`
+	}
+	sarifLocation struct {
+		PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	}
+	sarifPhysicalLocation struct {
+		ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+		Region           sarifRegion           `json:"region"`
+	}
+	sarifArtifactLocation struct {
+		URI string `json:"uri"`
+	}
+	sarifRegion struct {
+		StartLine uint32 `json:"startLine"`
+	}
+)
+
+// encodeSarif encodes the issues as a SARIF log to the given writer.
+func encodeSarif(w io.Writer, issues []resolutionIssue) error {
+	driver := sarifDriver{Name: "gazelle-python"}
+	ruleIndexes := make(map[resolutionIssueKind]int, len(resolutionIssueKinds))
+	levels := make(map[resolutionIssueKind]string, len(resolutionIssueKinds))
+	for i, issueKind := range resolutionIssueKinds {
+		driver.Rules = append(driver.Rules, sarifRule{
+			ID:                   string(issueKind.kind),
+			ShortDescription:     sarifMessage{Text: issueKind.description},
+			DefaultConfiguration: sarifConfiguration{Level: issueKind.level},
+		})
+		ruleIndexes[issueKind.kind] = i
+		levels[issueKind.kind] = issueKind.level
+	}
+	results := make([]sarifResult, 0, len(issues))
+	for _, issue := range issues {
+		results = append(results, sarifResult{
+			RuleID:    string(issue.kind),
+			RuleIndex: ruleIndexes[issue.kind],
+			Level:     levels[issue.kind],
+			Message:   sarifMessage{Text: issue.message},
+			Locations: []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(issue.filepath)},
+					Region:           sarifRegion{StartLine: issue.lineNumber},
+				},
+			}},
+		})
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool:    sarifTool{Driver: driver},
+			Results: results,
+		}},
+	})
+}
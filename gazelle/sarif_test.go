@@ -0,0 +1,86 @@
+package python
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestEncodeSarif(t *testing.T) {
+	t.Run("encodes the issues as SARIF results", func(t *testing.T) {
+		issues := []resolutionIssue{
+			{
+				kind:       unresolvedImportIssue,
+				message:    `"foo" doesn't resolve to any target`,
+				filepath:   "app/__main__.py",
+				lineNumber: 3,
+			},
+			{
+				kind:       ambiguousImportIssue,
+				message:    `"bar" resolves to multiple targets (//a:bar, //b:bar)`,
+				filepath:   "app/lib.py",
+				lineNumber: 7,
+			},
+		}
+		var buf bytes.Buffer
+		if err := encodeSarif(&buf, issues); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		var got sarifLog
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatalf("expected valid JSON, got %v", err)
+		}
+		if got.Version != "2.1.0" {
+			t.Errorf("expected version 2.1.0, got %q", got.Version)
+		}
+		if len(got.Runs) != 1 {
+			t.Fatalf("expected 1 run, got %d", len(got.Runs))
+		}
+		run := got.Runs[0]
+		if len(run.Tool.Driver.Rules) != len(resolutionIssueKinds) {
+			t.Errorf("expected %d rules, got %d", len(resolutionIssueKinds), len(run.Tool.Driver.Rules))
+		}
+		if len(run.Results) != len(issues) {
+			t.Fatalf("expected %d results, got %d", len(issues), len(run.Results))
+		}
+		for i, issue := range issues {
+			result := run.Results[i]
+			if result.RuleID != string(issue.kind) {
+				t.Errorf("expected rule ID %q at index %d, got %q", issue.kind, i, result.RuleID)
+			}
+			if rule := run.Tool.Driver.Rules[result.RuleIndex]; rule.ID != result.RuleID {
+				t.Errorf("expected rule index %d to point to %q, got %q", result.RuleIndex, result.RuleID, rule.ID)
+			}
+			if result.Level != "error" {
+				t.Errorf("expected level error at index %d, got %q", i, result.Level)
+			}
+			if result.Message.Text != issue.message {
+				t.Errorf("expected message %q at index %d, got %q", issue.message, i, result.Message.Text)
+			}
+			if len(result.Locations) != 1 {
+				t.Fatalf("expected 1 location at index %d, got %d", i, len(result.Locations))
+			}
+			location := result.Locations[0].PhysicalLocation
+			if location.ArtifactLocation.URI != issue.filepath {
+				t.Errorf("expected URI %q at index %d, got %q", issue.filepath, i, location.ArtifactLocation.URI)
+			}
+			if location.Region.StartLine != issue.lineNumber {
+				t.Errorf("expected start line %d at index %d, got %d", issue.lineNumber, i, location.Region.StartLine)
+			}
+		}
+	})
+	t.Run("encodes an empty report without results", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := encodeSarif(&buf, nil); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		var got map[string]interface{}
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatalf("expected valid JSON, got %v", err)
+		}
+		results := got["runs"].([]interface{})[0].(map[string]interface{})["results"]
+		if results == nil || len(results.([]interface{})) != 0 {
+			t.Errorf("expected an empty results array, got %v", results)
+		}
+	})
+}
@@ -20,11 +20,13 @@ var (
 	stdModulesStdin  io.Writer
 	stdModulesStdout io.Reader
 	stdModulesMutex  sync.Mutex
-	stdModulesSeen   map[string]struct{}
+	// stdModulesCache memoizes the answers of std_modules for the whole run,
+	// guarded by stdModulesMutex.
+	stdModulesCache map[string]bool
 )
 
 func init() {
-	stdModulesSeen = make(map[string]struct{})
+	stdModulesCache = make(map[string]bool)
 
 	stdModulesScriptRunfile, err := bazel.Runfile("gazelle/std_modules")
 	if err != nil {
@@ -68,11 +70,11 @@ func init() {
 }
 
 func isStdModule(m module) (bool, error) {
-	if _, seen := stdModulesSeen[m.Name]; seen {
-		return true, nil
-	}
 	stdModulesMutex.Lock()
 	defer stdModulesMutex.Unlock()
+	if isStd, ok := stdModulesCache[m.Name]; ok {
+		return isStd, nil
+	}
 
 	fmt.Fprintf(stdModulesStdin, "%s\n", m.Name)
 
@@ -90,9 +92,6 @@ func isStdModule(m module) (bool, error) {
 		return false, err
 	}
 
-	if isStd {
-		stdModulesSeen[m.Name] = struct{}{}
-		return true, nil
-	}
-	return false, nil
+	stdModulesCache[m.Name] = isStd
+	return isStd, nil
 }
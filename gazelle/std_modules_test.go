@@ -0,0 +1,44 @@
+package python
+
+import (
+	"fmt"
+	"testing"
+)
+
+func BenchmarkIsStdModule(b *testing.B) {
+	// A synthetic set of imports from a large repository, where the same
+	// standard and third-party modules are imported by many files.
+	stdNames := []string{"os", "sys", "json", "json.decoder", "collections.abc", "typing"}
+	mods := make([]module, 0, 10000)
+	for i := 0; i < 10000; i++ {
+		name := fmt.Sprintf("third_party%d", i%100)
+		if i%2 == 0 {
+			name = stdNames[i%len(stdNames)]
+		}
+		mods = append(mods, module{Name: name})
+	}
+	isStdModules := func(b *testing.B, resetCache bool) {
+		for _, mod := range mods {
+			if resetCache {
+				stdModulesMutex.Lock()
+				stdModulesCache = make(map[string]bool)
+				stdModulesMutex.Unlock()
+			}
+			if _, err := isStdModule(mod); err != nil {
+				b.Fatalf("expected no error, got %v", err)
+			}
+		}
+	}
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			isStdModules(b, true)
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		isStdModules(b, false)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			isStdModules(b, false)
+		}
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"path/filepath"
 
 	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
 	"github.com/bazelbuild/bazel-gazelle/rule"
 	"github.com/emirpasic/gods/sets/treeset"
 	godsutils "github.com/emirpasic/gods/utils"
@@ -18,10 +19,21 @@ type targetBuilder struct {
 	uuid              string
 	srcs              *treeset.Set
 	deps              *treeset.Set
+	resources         *treeset.Set
 	resolvedDeps      *treeset.Set
 	visibility        *treeset.Set
 	main              *string
 	imports           []string
+	// The srcs that are __init__.py files of pkgutil-style namespace packages.
+	pkgutilNamespacePackages *treeset.Set
+	// The names re-exported by the srcs that are __init__.py files, keyed by
+	// the srcs.
+	reexportedNames map[string][]string
+	// The Python roots overridden for single srcs, keyed by the file path
+	// relative to the Bazel workspace root.
+	fileRoots map[string]string
+	// The srcs that are test helpers embedded into the target.
+	testHelpers *treeset.Set
 }
 
 // newTargetBuilder constructs a new targetBuilder.
@@ -33,8 +45,14 @@ func newTargetBuilder(kind, name, pythonProjectRoot, bzlPackage string) *targetB
 		bzlPackage:        bzlPackage,
 		srcs:              treeset.NewWith(godsutils.StringComparator),
 		deps:              treeset.NewWith(moduleComparator),
+		resources:         treeset.NewWith(moduleComparator),
 		resolvedDeps:      treeset.NewWith(godsutils.StringComparator),
 		visibility:        treeset.NewWith(godsutils.StringComparator),
+
+		pkgutilNamespacePackages: treeset.NewWith(godsutils.StringComparator),
+		reexportedNames:          make(map[string][]string),
+		fileRoots:                make(map[string]string),
+		testHelpers:              treeset.NewWith(godsutils.StringComparator),
 	}
 }
 
@@ -64,7 +82,7 @@ func (t *targetBuilder) addSrcs(srcs *treeset.Set) *targetBuilder {
 
 // addModuleDependency adds a single module dep to the target.
 func (t *targetBuilder) addModuleDependency(dep module) *targetBuilder {
-	t.deps.Add(dep)
+	addModule(t.deps, dep)
 	return t
 }
 
@@ -72,7 +90,55 @@ func (t *targetBuilder) addModuleDependency(dep module) *targetBuilder {
 func (t *targetBuilder) addModuleDependencies(deps *treeset.Set) *targetBuilder {
 	it := deps.Iterator()
 	for it.Next() {
-		t.deps.Add(it.Value().(module))
+		addModule(t.deps, it.Value().(module))
+	}
+	return t
+}
+
+// addResourceDependencies copies all values from the provided resources to the
+// target. The packages providing them are resolved as data dependencies.
+func (t *targetBuilder) addResourceDependencies(resources *treeset.Set) *targetBuilder {
+	it := resources.Iterator()
+	for it.Next() {
+		t.resources.Add(it.Value().(module))
+	}
+	return t
+}
+
+// addPkgutilNamespacePackages copies all values from the provided srcs that are
+// pkgutil-style namespace package __init__.py files to the target.
+func (t *targetBuilder) addPkgutilNamespacePackages(srcs *treeset.Set) *targetBuilder {
+	it := srcs.Iterator()
+	for it.Next() {
+		t.pkgutilNamespacePackages.Add(it.Value().(string))
+	}
+	return t
+}
+
+// addReexportedNames copies the names re-exported by the provided srcs that are
+// __init__.py files to the target.
+func (t *targetBuilder) addReexportedNames(reexportedNames map[string][]string) *targetBuilder {
+	for src, names := range reexportedNames {
+		t.reexportedNames[src] = names
+	}
+	return t
+}
+
+// addTestHelpers copies all values from the provided srcs that are test
+// helpers embedded into the target.
+func (t *targetBuilder) addTestHelpers(srcs *treeset.Set) *targetBuilder {
+	it := srcs.Iterator()
+	for it.Next() {
+		t.testHelpers.Add(it.Value().(string))
+	}
+	return t
+}
+
+// addFileRoots copies all the Python roots overridden for single srcs to the
+// target.
+func (t *targetBuilder) addFileRoots(fileRoots map[string]string) *targetBuilder {
+	for path, root := range fileRoots {
+		t.fileRoots[path] = root
 	}
 	return t
 }
@@ -84,9 +150,27 @@ func (t *targetBuilder) addResolvedDependency(dep string) *targetBuilder {
 	return t
 }
 
-// addVisibility adds a visibility to the target.
-func (t *targetBuilder) addVisibility(visibility string) *targetBuilder {
-	t.visibility.Add(visibility)
+// addInjectedGlobalDependencies adds the targets providing the globals
+// injected at runtime, as found by the given function, referenced by the
+// target.
+func (t *targetBuilder) addInjectedGlobalDependencies(
+	injectedGlobals *treeset.Set,
+	findInjectedGlobal func(name string) (label.Label, bool),
+) *targetBuilder {
+	it := injectedGlobals.Iterator()
+	for it.Next() {
+		if lbl, ok := findInjectedGlobal(it.Value().(module).Name); ok {
+			t.resolvedDeps.Add(lbl.Rel("", t.bzlPackage).String())
+		}
+	}
+	return t
+}
+
+// addVisibilities adds the given visibilities to the target.
+func (t *targetBuilder) addVisibilities(visibilities []string) *targetBuilder {
+	for _, visibility := range visibilities {
+		t.visibility.Add(visibility)
+	}
 	return t
 }
 
@@ -99,14 +183,23 @@ func (t *targetBuilder) setMain(main string) *targetBuilder {
 // generateImportsAttribute generates the imports attribute.
 // These are a list of import directories to be added to the PYTHONPATH. In our
 // case, the value we add is on Bazel sub-packages to be able to perform imports
-// relative to the root project package.
+// relative to the root project package, as well as the Python roots
+// overridden for single srcs.
 func (t *targetBuilder) generateImportsAttribute() *targetBuilder {
-	p, _ := filepath.Rel(t.bzlPackage, t.pythonProjectRoot)
-	p = filepath.Clean(p)
-	if p == "." {
-		return t
+	imports := treeset.NewWith(godsutils.StringComparator)
+	imports.Add(t.pythonProjectRoot)
+	for _, root := range t.fileRoots {
+		imports.Add(root)
+	}
+	it := imports.Iterator()
+	for it.Next() {
+		p, _ := filepath.Rel(t.bzlPackage, it.Value().(string))
+		p = filepath.Clean(p)
+		if p == "." {
+			continue
+		}
+		t.imports = append(t.imports, p)
 	}
-	t.imports = []string{p}
 	return t
 }
 
@@ -131,6 +224,21 @@ func (t *targetBuilder) build() *rule.Rule {
 	if !t.deps.Empty() {
 		r.SetPrivateAttr(config.GazelleImportsKey, t.deps)
 	}
+	if !t.resources.Empty() {
+		r.SetPrivateAttr(resourcesKey, t.resources)
+	}
+	if !t.pkgutilNamespacePackages.Empty() {
+		r.SetPrivateAttr(pkgutilNamespacePackagesKey, t.pkgutilNamespacePackages)
+	}
+	if len(t.reexportedNames) > 0 {
+		r.SetPrivateAttr(reexportedNamesKey, t.reexportedNames)
+	}
+	if !t.testHelpers.Empty() {
+		r.SetPrivateAttr(testHelpersKey, t.testHelpers)
+	}
+	if len(t.fileRoots) > 0 {
+		r.SetPrivateAttr(fileRootsKey, t.fileRoots)
+	}
 	r.SetPrivateAttr(resolvedDepsKey, t.resolvedDeps)
 	return r
 }
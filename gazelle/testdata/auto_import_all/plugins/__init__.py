@@ -0,0 +1,5 @@
+import importlib
+import pkgutil
+
+for mod in pkgutil.iter_modules(__path__):
+    importlib.import_module(f".{mod.name}", __name__)
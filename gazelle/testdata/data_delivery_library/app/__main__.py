@@ -0,0 +1,3 @@
+import assets
+
+print(assets.LOGO)
@@ -0,0 +1,5 @@
+from mypkg import core
+
+
+def expected_answer():
+    return core.answer()
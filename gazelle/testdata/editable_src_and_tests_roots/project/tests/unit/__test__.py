@@ -0,0 +1,9 @@
+import unittest
+
+from mypkg.core import answer
+from tests.helpers import expected_answer
+
+
+class CoreTest(unittest.TestCase):
+    def test_answer(self):
+        self.assertEqual(answer(), expected_answer())
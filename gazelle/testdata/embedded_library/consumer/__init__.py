@@ -0,0 +1 @@
+import tool.helpers
@@ -0,0 +1,3 @@
+from tool import helpers
+
+helpers.run()
@@ -0,0 +1,3 @@
+import native._native
+
+native._native.add(1, 2)
@@ -0,0 +1 @@
+#include <Python.h>
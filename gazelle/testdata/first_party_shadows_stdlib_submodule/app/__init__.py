@@ -0,0 +1,4 @@
+import os.path
+from json.encoder import JSONEncoder
+
+_ = os.path, JSONEncoder
@@ -0,0 +1 @@
+import app.helpers
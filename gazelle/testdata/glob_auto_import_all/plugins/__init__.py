@@ -0,0 +1,8 @@
+import glob
+import importlib
+import os
+
+for path in glob.glob(os.path.join(os.path.dirname(__file__), "*.py")):
+    name = os.path.splitext(os.path.basename(path))[0]
+    if name != "__init__":
+        importlib.import_module(f".{name}", __name__)
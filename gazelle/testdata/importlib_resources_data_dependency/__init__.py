@@ -0,0 +1,3 @@
+from importlib.resources import files
+
+SCHEMA = files("schemas").joinpath("schema.json").read_text()
@@ -0,0 +1 @@
+import other.gen
@@ -0,0 +1 @@
+GENERATED = True
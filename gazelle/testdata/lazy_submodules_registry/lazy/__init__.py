@@ -0,0 +1,12 @@
+import importlib
+
+_lazy_modules = {
+    "heavy": "impl.heavy",
+    "other": "extra.other",
+}
+
+
+def __getattr__(name):
+    if name in _lazy_modules:
+        return importlib.import_module(_lazy_modules[name])
+    raise AttributeError(name)
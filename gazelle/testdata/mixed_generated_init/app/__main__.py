@@ -0,0 +1,4 @@
+import pkg
+import pkg.helpers
+
+print(pkg.VERSION, pkg.helpers.helper())
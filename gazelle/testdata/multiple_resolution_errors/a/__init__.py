@@ -0,0 +1 @@
+import missing_three
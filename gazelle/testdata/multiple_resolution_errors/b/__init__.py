@@ -0,0 +1,2 @@
+import missing_one
+import missing_two
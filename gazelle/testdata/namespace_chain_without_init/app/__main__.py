@@ -0,0 +1,5 @@
+import company.team.lib.helpers
+import company.team.util.strings
+
+print(company.team.lib.helpers.helper())
+print(company.team.util.strings.slugify("A"))
@@ -0,0 +1,3 @@
+import pkg.util
+
+print(pkg.util.helper())
@@ -0,0 +1,13 @@
+try:
+    import ujson as json
+except ImportError:
+    import json
+
+try:
+    import yaml
+except (ImportError, ModuleNotFoundError):
+    yaml = None
+
+
+def dumps(value):
+    return json.dumps(value)
@@ -0,0 +1,6 @@
+import ns.two
+from ns import one, two
+
+_ = ns
+_ = one
+_ = two
@@ -0,0 +1,3 @@
+from ns import two
+
+_ = two
@@ -0,0 +1,27 @@
+import platform
+import sys
+
+import requests
+
+if platform.system() == "Linux":
+    import distro
+
+if "Windows" == platform.system():
+    import winloop
+else:
+    import uvloop
+
+if sys.platform == "darwin":
+    import pyobjc
+
+if platform.machine() == "arm64":
+    import tensorflow_macos
+
+if platform.system() == "Windows" and platform.machine() == "AMD64":
+    import colorama
+
+if platform.machine() == "riscv64":
+    import riscv_accel
+
+if platform.system() == "Linux":
+    import os
@@ -0,0 +1,4 @@
+import platform
+
+if platform.system() == "Linux":
+    import fcntl
@@ -0,0 +1,12 @@
+import platform
+import sys
+
+import yaml
+
+if sys.platform == "win32":
+    import _yaml
+    import win32api
+
+if platform.system() == "Windows" and platform.machine() == "AMD64":
+    import win32con
+    import winloop
@@ -0,0 +1,4 @@
+import numpy
+import requests
+
+print(numpy.zeros(3), requests.__version__)
@@ -0,0 +1,3 @@
+import proto.greeting_pb2
+
+print(proto.greeting_pb2.Greeting(text="hello"))
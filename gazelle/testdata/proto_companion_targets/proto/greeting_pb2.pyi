@@ -0,0 +1,4 @@
+from google.protobuf import message
+
+class Greeting(message.Message):
+    text: str
@@ -0,0 +1,4 @@
+import mixed.bar
+import stubs.foo
+
+_ = mixed.bar, stubs.foo
@@ -0,0 +1 @@
+def bar() -> int: ...
@@ -0,0 +1 @@
+def foo() -> int: ...
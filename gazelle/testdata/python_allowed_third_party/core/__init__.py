@@ -0,0 +1,3 @@
+import json
+
+from requests import adapters
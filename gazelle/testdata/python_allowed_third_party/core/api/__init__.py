@@ -0,0 +1,3 @@
+import pydantic
+
+import core
@@ -0,0 +1,4 @@
+import typing
+
+import importlib_metadata
+import typing_extensions
@@ -0,0 +1,8 @@
+import os
+
+import requests
+
+if os.environ.get("FAST_JSON"):
+    import ujson as json
+else:
+    import simplejson as json
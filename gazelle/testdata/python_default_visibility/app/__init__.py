@@ -0,0 +1,2 @@
+import internal
+import lib
@@ -0,0 +1 @@
+def secret(): pass
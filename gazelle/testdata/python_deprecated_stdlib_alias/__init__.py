@@ -0,0 +1,2 @@
+import optparse
+from collections import Mapping, OrderedDict
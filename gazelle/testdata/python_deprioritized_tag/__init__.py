@@ -0,0 +1 @@
+import gen.models
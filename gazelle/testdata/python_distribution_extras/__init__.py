@@ -0,0 +1,3 @@
+import OpenSSL
+import requests
+import socks
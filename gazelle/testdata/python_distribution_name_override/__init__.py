@@ -0,0 +1,2 @@
+import yaml
+import zope.interface
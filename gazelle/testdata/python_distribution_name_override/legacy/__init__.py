@@ -0,0 +1,2 @@
+import ruamel.yaml
+import yaml
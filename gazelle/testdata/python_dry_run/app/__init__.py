@@ -0,0 +1,3 @@
+import requests
+
+from lib import helper
@@ -0,0 +1,9 @@
+import importlib
+
+name = "impl"
+
+importlib.import_module("plugins.alpha")
+importlib.import_module(f"plugins.beta.{name}")
+importlib.import_module(name)
+__import__("plugins.gamma")
+__import__(name)
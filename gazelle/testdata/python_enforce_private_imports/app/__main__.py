@@ -0,0 +1,3 @@
+from other._internal import helper
+
+print(helper())
@@ -0,0 +1 @@
+from other._internal import helper
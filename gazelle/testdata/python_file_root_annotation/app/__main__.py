@@ -0,0 +1,4 @@
+import gen.generated
+import src.gen.helpers
+
+print(gen.generated.VERSION, src.gen.helpers.version())
@@ -0,0 +1,3 @@
+# gazelle:python_file_root src
+
+VERSION = "1.0.0"
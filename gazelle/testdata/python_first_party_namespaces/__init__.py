@@ -0,0 +1,4 @@
+import requests
+
+from myproject import models
+import myproject.models
@@ -0,0 +1,3 @@
+import gen.protos
+import gen.protos.users.users_pb2
+from gen.protos import orders_pb2
@@ -0,0 +1,4 @@
+import os
+
+import embedded_config
+import vendor_runtime.hooks
@@ -0,0 +1,3 @@
+import a.b
+
+print(a.b.VALUE)
@@ -0,0 +1,4 @@
+import requests
+import yaml
+
+from lib import helpers
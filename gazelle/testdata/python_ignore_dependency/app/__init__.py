@@ -0,0 +1,4 @@
+import awslambdaric
+import boto3
+import botocore.exceptions
+import requests
@@ -0,0 +1,2 @@
+import sibling
+import utils
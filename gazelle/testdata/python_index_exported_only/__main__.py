@@ -0,0 +1,5 @@
+import lib._private
+from lib import public
+
+_ = lib
+_ = public
@@ -0,0 +1 @@
+# For test purposes only.
@@ -0,0 +1,3 @@
+from lib import _private
+
+_ = _private
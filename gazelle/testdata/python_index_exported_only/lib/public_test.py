@@ -0,0 +1,4 @@
+import lib._private
+import lib.public
+
+_ = lib
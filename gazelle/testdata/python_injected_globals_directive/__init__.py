@@ -0,0 +1,2 @@
+def migrate(db):
+    db.migrate()
@@ -0,0 +1,2 @@
+def run():
+    return db.query(settings.QUERY)
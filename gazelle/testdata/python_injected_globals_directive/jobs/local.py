@@ -0,0 +1,5 @@
+settings = {"QUERY": "SELECT 1"}
+
+
+def run_locally():
+    return settings["QUERY"]
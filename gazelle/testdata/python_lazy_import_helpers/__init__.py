@@ -0,0 +1,4 @@
+import lazy_loader
+
+scipy = lazy_loader.load("scipy")
+unknown = lazy_loader.load(name)
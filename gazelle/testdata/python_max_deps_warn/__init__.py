@@ -0,0 +1,3 @@
+import boto3
+import numpy
+import requests
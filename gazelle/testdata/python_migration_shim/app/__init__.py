@@ -0,0 +1,3 @@
+import old.api
+
+client = old.api.Client()
@@ -0,0 +1,2 @@
+# A shim re-exporting the API from its new location.
+from new.api import Client
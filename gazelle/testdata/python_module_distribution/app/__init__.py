@@ -0,0 +1,3 @@
+import yaml
+
+import Crypto
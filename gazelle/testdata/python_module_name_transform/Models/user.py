@@ -0,0 +1 @@
+class User: pass
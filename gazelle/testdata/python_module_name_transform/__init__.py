@@ -0,0 +1,2 @@
+import models
+from models.user import User
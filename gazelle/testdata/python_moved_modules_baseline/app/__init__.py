@@ -0,0 +1 @@
+import utils.strings
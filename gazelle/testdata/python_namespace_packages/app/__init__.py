@@ -0,0 +1,4 @@
+import mynamespace.sub
+import regular
+
+_ = mynamespace.sub, regular
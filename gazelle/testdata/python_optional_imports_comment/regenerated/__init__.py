@@ -0,0 +1,11 @@
+try:
+    import ujson as json
+except ImportError:
+    import json
+
+try:
+    import msgspec
+    import yaml
+except (ImportError, ModuleNotFoundError):
+    msgspec = None
+    yaml = None
@@ -0,0 +1 @@
+import app.models.user
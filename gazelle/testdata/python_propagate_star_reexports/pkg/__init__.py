@@ -0,0 +1 @@
+from .compat import *
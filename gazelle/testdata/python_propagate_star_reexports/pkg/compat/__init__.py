@@ -0,0 +1,5 @@
+import six
+
+from .extra import *
+
+string_types = six.string_types
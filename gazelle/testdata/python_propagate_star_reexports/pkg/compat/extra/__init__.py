@@ -0,0 +1,6 @@
+import os
+
+import attr
+
+define = attr.define
+sep = os.sep
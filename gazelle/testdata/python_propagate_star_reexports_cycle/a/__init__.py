@@ -0,0 +1,5 @@
+import requests
+
+from b import *
+
+get = requests.get
@@ -0,0 +1 @@
+from a import *
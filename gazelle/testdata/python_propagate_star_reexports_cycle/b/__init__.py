@@ -0,0 +1,5 @@
+import yaml
+
+from a import *
+
+load = yaml.safe_load
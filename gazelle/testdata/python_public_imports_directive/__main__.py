@@ -0,0 +1,5 @@
+import pkg.api
+import pkg.internal
+
+pkg.api.greet()
+print(pkg.internal.greeting())
@@ -0,0 +1,5 @@
+import pkg.internal
+
+
+def greet():
+    print(pkg.internal.greeting())
@@ -0,0 +1 @@
+# A vendored fork of requests.
@@ -0,0 +1,5 @@
+import auth
+import legacy.compat
+import platform_core.io.files
+import platform_core.models
+import platform_core.models.user
@@ -0,0 +1,3 @@
+from vendored.shim import shim
+
+shim()
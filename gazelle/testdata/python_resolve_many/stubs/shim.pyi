@@ -0,0 +1 @@
+def shim() -> None: ...
@@ -0,0 +1 @@
+import vendored.shim
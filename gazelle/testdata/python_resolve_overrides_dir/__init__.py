@@ -0,0 +1,4 @@
+import alpha
+import beta
+import gamma.client
+import gamma.server
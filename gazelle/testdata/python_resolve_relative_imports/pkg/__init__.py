@@ -0,0 +1,5 @@
+from . import VERSION
+from .other import helper
+from .same import function
+
+VERSION = "1.0"
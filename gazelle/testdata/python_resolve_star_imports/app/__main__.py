@@ -0,0 +1,4 @@
+from plugins import *
+
+for plugin in __all__:
+    print(plugin)
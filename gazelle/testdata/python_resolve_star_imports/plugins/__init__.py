@@ -0,0 +1,3 @@
+import pkgutil
+
+__all__ = [name for _, name, _ in pkgutil.iter_modules(__path__)]
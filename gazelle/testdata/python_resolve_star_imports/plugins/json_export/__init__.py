@@ -0,0 +1,5 @@
+import json
+
+
+def export(rows):
+    return json.dumps(rows)
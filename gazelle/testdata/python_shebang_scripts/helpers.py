@@ -0,0 +1 @@
+def greet(): pass
@@ -0,0 +1,2 @@
+import legacy
+import requests
@@ -0,0 +1 @@
+def run() -> None: ...
@@ -0,0 +1,2 @@
+class Session:
+    def get(self, url: str) -> bytes: ...
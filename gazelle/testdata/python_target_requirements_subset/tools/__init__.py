@@ -0,0 +1,2 @@
+import pydantic
+import requests
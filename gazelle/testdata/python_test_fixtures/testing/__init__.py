@@ -0,0 +1,7 @@
+import factory
+import pytest
+
+
+@pytest.fixture
+def user():
+    return factory.Faker("name")
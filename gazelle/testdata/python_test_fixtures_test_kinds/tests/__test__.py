@@ -0,0 +1,6 @@
+import unittest
+
+import testing
+
+if __name__ == "__main__":
+    unittest.main()
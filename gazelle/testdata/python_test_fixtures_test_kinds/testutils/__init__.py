@@ -0,0 +1,5 @@
+import testing
+
+
+def make_user():
+    return testing.user()
@@ -0,0 +1,14 @@
+import unittest
+
+from __init__ import add
+from _fixtures import NUMBERS
+
+
+class AddTest(unittest.TestCase):
+    def test_add(self):
+        for a, b, expected in NUMBERS:
+            self.assertEqual(add(a, b), expected)
+
+
+if __name__ == "__main__":
+    unittest.main()
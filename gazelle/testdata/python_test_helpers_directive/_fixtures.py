@@ -0,0 +1 @@
+NUMBERS = [(1, 2, 3), (2, 3, 5)]
@@ -0,0 +1,2 @@
+import company.third_party.requests
+from company.third_party.yaml import safe_load
@@ -0,0 +1,18 @@
+from __future__ import annotations
+
+from typing import TYPE_CHECKING
+
+import yaml
+from helpers import format_name
+from models import User
+
+if TYPE_CHECKING:
+    import requests
+
+
+def greet(user: User) -> str:
+    return format_name(user)
+
+
+def fetch(session: requests.Session) -> dict:
+    return yaml.safe_load(session.get("/").text)
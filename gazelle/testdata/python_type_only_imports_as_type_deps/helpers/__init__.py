@@ -0,0 +1,2 @@
+def format_name(user):
+    return user.name.title()
@@ -0,0 +1,5 @@
+from models import User
+
+
+def greet(user: User) -> str:
+    return user.name
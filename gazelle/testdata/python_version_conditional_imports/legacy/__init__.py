@@ -0,0 +1,16 @@
+import sys
+
+if sys.version_info >= (3, 11):
+    import tomllib
+else:
+    import tomli as tomllib
+
+if sys.version_info[0] == 2:
+    import urllib2
+else:
+    import urllib.request
+
+if sys.version_info.minor < 8:
+    import importlib_metadata
+else:
+    import importlib.metadata
@@ -0,0 +1,3 @@
+import importlib
+
+Thing = importlib.import_module("mypkg.Thing")
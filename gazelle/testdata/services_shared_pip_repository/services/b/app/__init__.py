@@ -0,0 +1,3 @@
+import requests
+
+from common import helper